@@ -22,6 +22,70 @@ type Expression interface {
 	expressionNode()
 }
 
+// StatementPosition returns the position of the first token of a statement.
+func StatementPosition(statement Statement) token.Position {
+	switch statement := statement.(type) {
+	case *LetStatement:
+		return statement.Token.Position
+	case *ReturnStatement:
+		return statement.Token.Position
+	case *ExpressionStatement:
+		return statement.Token.Position
+	case *BlockStatement:
+		return statement.Token.Position
+	default:
+		return token.Position{}
+	}
+}
+
+// ExpressionPosition returns the position of the first token of an
+// expression. The tokens of infix, call, index and slice expressions come
+// after their first operands, so the positions of those operands are used.
+func ExpressionPosition(expression Expression) token.Position {
+	switch expression := expression.(type) {
+	case *InfixExpression:
+		return ExpressionPosition(expression.Left)
+	case *CallExpression:
+		return ExpressionPosition(expression.Function)
+	case *IndexExpression:
+		return ExpressionPosition(expression.Left)
+	case *SliceExpression:
+		return ExpressionPosition(expression.Left)
+	case *NamedArgument:
+		return expression.Name.Token.Position
+	case *Identifier:
+		return expression.Token.Position
+	case *IntegerLiteral:
+		return expression.Token.Position
+	case *FloatLiteral:
+		return expression.Token.Position
+	case *BooleanLiteral:
+		return expression.Token.Position
+	case *StringLiteral:
+		return expression.Token.Position
+	case *InterpolatedString:
+		return expression.Token.Position
+	case *PrefixExpression:
+		return expression.Token.Position
+	case *IfExpression:
+		return expression.Token.Position
+	case *FunctionLiteral:
+		return expression.Token.Position
+	case *MacroLiteral:
+		return expression.Token.Position
+	case *SpreadExpression:
+		return expression.Token.Position
+	case *ArrayExpression:
+		return expression.Token.Position
+	case *HashExpression:
+		return expression.Token.Position
+	case *MatchExpression:
+		return expression.Token.Position
+	default:
+		return token.Position{}
+	}
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -45,10 +109,13 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// LetStatement binds a Name, or destructures its value with an array or
+// hash Pattern, in which case Name is nil.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -60,7 +127,11 @@ func (ls *LetStatement) String() string {
 
 	out.WriteString(ls.Token.Literal)
 	out.WriteString(" ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -71,6 +142,14 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Names returns the names bound by the statement, in source order.
+func (ls *LetStatement) Names() []*Identifier {
+	if ls.Pattern != nil {
+		return Bindings(ls.Pattern)
+	}
+	return []*Identifier{ls.Name}
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -131,6 +210,14 @@ func (e *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Resolved is set by the evaluator's resolver when the identifier
+	// refers to, or declares, a binding in a function call's or match arm's
+	// environment. The binding is then in slot Slot of the environment
+	// Depth levels out from the one the identifier is evaluated in. Other
+	// identifiers, such as globals, are looked up by name.
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 func (i *Identifier) expressionNode() {}
@@ -154,6 +241,19 @@ func (i *IntegerLiteral) String() string {
 	return i.TokenLiteral()
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode() {}
+func (f *FloatLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+func (f *FloatLiteral) String() string {
+	return f.TokenLiteral()
+}
+
 type BooleanLiteral struct {
 	Token token.Token
 	Value bool
@@ -180,6 +280,35 @@ func (s *StringLiteral) String() string {
 	return fmt.Sprintf("\"%s\"", s.Value)
 }
 
+// InterpolatedString is a string literal with embedded expressions. Parts
+// holds StringLiterals for the text between the embedded expressions.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString("${")
+			out.WriteString(part.String())
+			out.WriteString("}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -259,10 +388,46 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// Parameter is a parameter of a function literal: a Name, or an array or
+// hash Pattern destructuring the argument, in which case Name is nil.
+// Default, if not nil, is evaluated when no argument is given for it.
+type Parameter struct {
+	Name    *Identifier
+	Pattern Pattern
+	Default Expression
+}
+
+func (p Parameter) String() string {
+	var text string
+	if p.Pattern != nil {
+		text = p.Pattern.String()
+	} else {
+		text = p.Name.String()
+	}
+	if p.Default != nil {
+		text += " = " + p.Default.String()
+	}
+	return text
+}
+
+// Names returns the names bound by the parameter, in source order.
+func (p Parameter) Names() []*Identifier {
+	if p.Pattern != nil {
+		return Bindings(p.Pattern)
+	}
+	return []*Identifier{p.Name}
+}
+
+// FunctionLiteral is a fn(params) { body } literal. Rest, if not nil, is
+// the ...name parameter taking the arguments after the others as an array.
 type FunctionLiteral struct {
 	Token      token.Token
-	Parameters []Identifier
+	Parameters []Parameter
+	Rest       *Identifier
 	Body       *BlockStatement
+	// Slots are the names bound in the environment of a call, in slot
+	// order, set by the resolver
+	Slots []string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -279,12 +444,46 @@ func (fl *FunctionLiteral) String() string {
 		}
 		out.WriteString(param.String())
 	}
+	if fl.Rest != nil {
+		if len(fl.Parameters) > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("..." + fl.Rest.String())
+	}
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// MacroLiteral is a macro(params) { body } literal. Macros are defined and
+// expanded before evaluation.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("macro(")
+	for i, param := range ml.Parameters {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(param.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -311,6 +510,36 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// SpreadExpression is a ...value argument of a call, passing the elements
+// of an array as separate arguments.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
+// NamedArgument is a name: value argument of a call, passing the value to
+// the parameter with that name.
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode() {}
+func (na *NamedArgument) TokenLiteral() string {
+	return na.Name.Token.Literal
+}
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
+
 type ArrayExpression struct {
 	Token    token.Token
 	Elements []Expression
@@ -386,3 +615,37 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+
+type SliceExpression struct {
+	Token token.Token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
@@ -0,0 +1,684 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"danielmcm.com/interpreterbook/token"
+)
+
+// EncodeJSON encodes a node as JSON. Each node is an object with a "kind"
+// naming its type, a "position" (except for programs, named arguments, and
+// binding and literal patterns, which hold a node with a position), and a
+// field for each of its children or values. Missing children are null, so
+// let statements have a null "name" or "pattern". Function parameters are
+// identifiers or patterns, with their "defaults" in a separate list. Hash
+// entries and hash pattern entries are objects with "key" and "value"
+// fields, and match arms are objects with "pattern", "guard" and "body"
+// fields.
+//
+// Integer and float literals also record their source text in "literal".
+// Other tokens are not encoded, and are reconstructed from the kind by
+// DecodeJSON.
+func EncodeJSON(node Node) ([]byte, error) {
+	value, err := encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(value, "", "  ")
+}
+
+type jsonObject map[string]interface{}
+
+func encodeNode(node Node) (jsonObject, error) {
+	var err error
+	object := jsonObject{"kind": nodeKind(node)}
+	field := func(name string, child Node) {
+		if err == nil {
+			object[name], err = encodeChild(child)
+		}
+	}
+	list := func(name string, children []Node) {
+		values := make([]interface{}, len(children))
+		for i, child := range children {
+			if err == nil {
+				values[i], err = encodeChild(child)
+			}
+		}
+		object[name] = values
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		list("statements", statementNodes(node.Statements))
+	case *LetStatement:
+		object["position"] = node.Token.Position
+		field("name", identifierNode(node.Name))
+		field("pattern", node.Pattern)
+		field("value", node.Value)
+	case *ReturnStatement:
+		object["position"] = node.Token.Position
+		field("value", node.ReturnValue)
+	case *BlockStatement:
+		object["position"] = node.Token.Position
+		list("statements", statementNodes(node.Statements))
+	case *ExpressionStatement:
+		object["position"] = node.Token.Position
+		field("expression", node.Expression)
+	case *Identifier:
+		object["position"] = node.Token.Position
+		object["name"] = node.Value
+	case *IntegerLiteral:
+		object["position"] = node.Token.Position
+		object["value"] = node.Value
+		object["literal"] = node.Token.Literal
+	case *FloatLiteral:
+		object["position"] = node.Token.Position
+		object["value"] = node.Value
+		object["literal"] = node.Token.Literal
+	case *BooleanLiteral:
+		object["position"] = node.Token.Position
+		object["value"] = node.Value
+	case *StringLiteral:
+		object["position"] = node.Token.Position
+		object["value"] = node.Value
+	case *InterpolatedString:
+		object["position"] = node.Token.Position
+		list("parts", expressionNodes(node.Parts))
+	case *PrefixExpression:
+		object["position"] = node.Token.Position
+		object["operator"] = node.Operator
+		field("right", node.Right)
+	case *InfixExpression:
+		object["position"] = node.Token.Position
+		field("left", node.Left)
+		object["operator"] = node.Operator
+		field("right", node.Right)
+	case *IfExpression:
+		object["position"] = node.Token.Position
+		field("condition", node.Condition)
+		field("consequence", blockNode(node.Consequence))
+		field("alternative", blockNode(node.Alternative))
+	case *FunctionLiteral:
+		object["position"] = node.Token.Position
+		parameters := make([]Node, len(node.Parameters))
+		for i, parameter := range node.Parameters {
+			parameters[i] = parameter.Pattern
+			if parameter.Pattern == nil {
+				parameters[i] = parameter.Name
+			}
+		}
+		list("parameters", parameters)
+		defaults := make([]Node, len(node.Parameters))
+		for i, parameter := range node.Parameters {
+			if parameter.Default != nil {
+				defaults[i] = parameter.Default
+			}
+		}
+		list("defaults", defaults)
+		field("rest", identifierNode(node.Rest))
+		field("body", blockNode(node.Body))
+	case *MacroLiteral:
+		object["position"] = node.Token.Position
+		parameters := make([]Node, len(node.Parameters))
+		for i := range node.Parameters {
+			parameters[i] = &node.Parameters[i]
+		}
+		list("parameters", parameters)
+		field("body", blockNode(node.Body))
+	case *CallExpression:
+		object["position"] = node.Token.Position
+		field("function", node.Function)
+		list("arguments", expressionNodes(node.Arguments))
+	case *SpreadExpression:
+		object["position"] = node.Token.Position
+		field("value", node.Value)
+	case *NamedArgument:
+		field("name", node.Name)
+		field("value", node.Value)
+	case *ArrayExpression:
+		object["position"] = node.Token.Position
+		list("elements", expressionNodes(node.Elements))
+	case *HashExpression:
+		object["position"] = node.Token.Position
+		entries := make([]jsonObject, len(node.Entries))
+		for i, entry := range node.Entries {
+			entries[i] = jsonObject{}
+			if err == nil {
+				entries[i]["key"], err = encodeChild(entry.Key)
+			}
+			if err == nil {
+				entries[i]["value"], err = encodeChild(entry.Value)
+			}
+		}
+		object["entries"] = entries
+	case *IndexExpression:
+		object["position"] = node.Token.Position
+		field("left", node.Left)
+		field("index", node.Index)
+	case *SliceExpression:
+		object["position"] = node.Token.Position
+		field("left", node.Left)
+		field("start", node.Start)
+		field("end", node.End)
+		field("step", node.Step)
+	case *MatchExpression:
+		object["position"] = node.Token.Position
+		field("value", node.Value)
+		arms := make([]jsonObject, len(node.Arms))
+		for i, arm := range node.Arms {
+			arms[i] = jsonObject{}
+			if err == nil {
+				arms[i]["pattern"], err = encodeChild(arm.Pattern)
+			}
+			if err == nil {
+				arms[i]["guard"], err = encodeChild(arm.Guard)
+			}
+			if err == nil {
+				arms[i]["body"], err = encodeChild(arm.Body)
+			}
+		}
+		object["arms"] = arms
+	case *WildcardPattern:
+		object["position"] = node.Token.Position
+	case *BindingPattern:
+		field("name", node.Name)
+	case *LiteralPattern:
+		field("value", node.Value)
+	case *ArrayPattern:
+		object["position"] = node.Token.Position
+		elements := make([]Node, len(node.Elements))
+		for i, element := range node.Elements {
+			elements[i] = element
+		}
+		list("elements", elements)
+		field("rest", identifierNode(node.Rest))
+	case *HashPattern:
+		object["position"] = node.Token.Position
+		entries := make([]jsonObject, len(node.Entries))
+		for i, entry := range node.Entries {
+			entries[i] = jsonObject{}
+			if err == nil {
+				entries[i]["key"], err = encodeChild(entry.Key)
+			}
+			if err == nil {
+				entries[i]["value"], err = encodeChild(entry.Value)
+			}
+		}
+		object["entries"] = entries
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node of type %T", node)
+	}
+	return object, err
+}
+
+// encodeChild encodes a child node, or null if it is missing.
+func encodeChild(node Node) (interface{}, error) {
+	if node == nil {
+		return nil, nil
+	}
+	return encodeNode(node)
+}
+
+// nodeKind returns the name of the type of a node.
+func nodeKind(node Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func statementNodes(statements []Statement) []Node {
+	nodes := make([]Node, len(statements))
+	for i, statement := range statements {
+		if statement != nil {
+			nodes[i] = statement
+		}
+	}
+	return nodes
+}
+
+func expressionNodes(expressions []Expression) []Node {
+	nodes := make([]Node, len(expressions))
+	for i, expression := range expressions {
+		if expression != nil {
+			nodes[i] = expression
+		}
+	}
+	return nodes
+}
+
+// blockNode converts a possibly nil block to a Node without creating a
+// non-nil interface holding a nil pointer.
+func blockNode(block *BlockStatement) Node {
+	if block == nil {
+		return nil
+	}
+	return block
+}
+
+// identifierNode converts a possibly nil identifier to a Node, like
+// blockNode.
+func identifierNode(identifier *Identifier) Node {
+	if identifier == nil {
+		return nil
+	}
+	return identifier
+}
+
+// DecodeJSON decodes a node encoded by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// jsonFields holds the fields of an encoded node, decoding them on demand.
+// The first error is kept in err, after which decoding does nothing.
+type jsonFields struct {
+	kind   string
+	fields map[string]json.RawMessage
+	err    error
+}
+
+func (f *jsonFields) decode(name string, value interface{}) {
+	if f.err != nil {
+		return
+	}
+	raw, ok := f.fields[name]
+	if !ok {
+		f.err = fmt.Errorf("ast: %s is missing field %q", f.kind, name)
+		return
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		f.err = fmt.Errorf("ast: decoding %s field %q: %w", f.kind, name, err)
+	}
+}
+
+func (f *jsonFields) position() token.Position {
+	var position token.Position
+	f.decode("position", &position)
+	return position
+}
+
+func (f *jsonFields) string(name string) string {
+	var value string
+	f.decode(name, &value)
+	return value
+}
+
+func (f *jsonFields) child(name string) Node {
+	if f.err != nil {
+		return nil
+	}
+	raw, ok := f.fields[name]
+	if !ok {
+		f.err = fmt.Errorf("ast: %s is missing field %q", f.kind, name)
+		return nil
+	}
+	node, err := decodeNode(raw)
+	f.err = err
+	return node
+}
+
+func (f *jsonFields) children(name string) []Node {
+	var raws []json.RawMessage
+	f.decode(name, &raws)
+	nodes := make([]Node, 0, len(raws))
+	for _, raw := range raws {
+		if f.err != nil {
+			break
+		}
+		var node Node
+		node, f.err = decodeNode(raw)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// expression decodes a required expression field.
+func (f *jsonFields) expression(name string) Expression {
+	expression := f.optionalExpression(name)
+	if expression == nil && f.err == nil {
+		f.err = fmt.Errorf("ast: %s field %q is null, expected an expression", f.kind, name)
+	}
+	return expression
+}
+
+func (f *jsonFields) optionalExpression(name string) Expression {
+	return f.asExpression(f.child(name))
+}
+
+func (f *jsonFields) expressions(name string) []Expression {
+	nodes := f.children(name)
+	expressions := make([]Expression, len(nodes))
+	for i, node := range nodes {
+		expressions[i] = f.asExpression(node)
+		if expressions[i] == nil && f.err == nil {
+			f.err = fmt.Errorf("ast: %s field %q contains null, expected an expression", f.kind, name)
+		}
+	}
+	return expressions
+}
+
+func (f *jsonFields) statements(name string) []Statement {
+	nodes := f.children(name)
+	statements := make([]Statement, len(nodes))
+	for i, node := range nodes {
+		statement, ok := node.(Statement)
+		if !ok && f.err == nil {
+			f.err = fmt.Errorf("ast: %s field %q contains %s, expected a statement", f.kind, name, describeNode(node))
+		}
+		statements[i] = statement
+	}
+	return statements
+}
+
+func (f *jsonFields) block(name string) *BlockStatement {
+	node := f.child(name)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok && f.err == nil {
+		f.err = fmt.Errorf("ast: %s field %q contains %s, expected a BlockStatement", f.kind, name, describeNode(node))
+	}
+	return block
+}
+
+func (f *jsonFields) identifier(node Node, name string) *Identifier {
+	identifier, ok := node.(*Identifier)
+	if !ok && f.err == nil {
+		f.err = fmt.Errorf("ast: %s field %q contains %s, expected an Identifier", f.kind, name, describeNode(node))
+	}
+	return identifier
+}
+
+// pattern decodes a required pattern field.
+func (f *jsonFields) pattern(name string) Pattern {
+	node := f.child(name)
+	pattern, ok := node.(Pattern)
+	if !ok && f.err == nil {
+		f.err = fmt.Errorf("ast: %s field %q contains %s, expected a pattern", f.kind, name, describeNode(node))
+	}
+	return pattern
+}
+
+func (f *jsonFields) patterns(name string) []Pattern {
+	nodes := f.children(name)
+	patterns := make([]Pattern, len(nodes))
+	for i, node := range nodes {
+		pattern, ok := node.(Pattern)
+		if !ok && f.err == nil {
+			f.err = fmt.Errorf("ast: %s field %q contains %s, expected a pattern", f.kind, name, describeNode(node))
+		}
+		patterns[i] = pattern
+	}
+	return patterns
+}
+
+func (f *jsonFields) asExpression(node Node) Expression {
+	if node == nil {
+		return nil
+	}
+	expression, ok := node.(Expression)
+	if !ok && f.err == nil {
+		f.err = fmt.Errorf("ast: %s contains %s, expected an expression", f.kind, describeNode(node))
+	}
+	return expression
+}
+
+func describeNode(node Node) string {
+	if node == nil {
+		return "null"
+	}
+	return nodeKind(node)
+}
+
+func decodeNode(data []byte) (Node, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ast: %w", err)
+	}
+	if fields == nil {
+		return nil, nil
+	}
+	f := &jsonFields{kind: "node", fields: fields}
+	f.kind = f.string("kind")
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var node Node
+	switch f.kind {
+	case "Program":
+		node = &Program{Statements: f.statements("statements")}
+	case "LetStatement":
+		position := f.position()
+		let := &LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Position: position}}
+		if name := f.child("name"); name != nil {
+			let.Name = f.identifier(name, "name")
+		} else {
+			let.Pattern = f.pattern("pattern")
+		}
+		let.Value = f.expression("value")
+		node = let
+	case "ReturnStatement":
+		position := f.position()
+		node = &ReturnStatement{
+			Token:       token.Token{Type: token.RETURN, Literal: "return", Position: position},
+			ReturnValue: f.optionalExpression("value"),
+		}
+	case "BlockStatement":
+		position := f.position()
+		node = &BlockStatement{
+			Token:      token.Token{Type: token.LBRACE, Literal: "{", Position: position},
+			Statements: f.statements("statements"),
+		}
+	case "ExpressionStatement":
+		position := f.position()
+		node = &ExpressionStatement{
+			Token:      token.Token{Position: position},
+			Expression: f.expression("expression"),
+		}
+	case "Identifier":
+		position := f.position()
+		name := f.string("name")
+		node = &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Position: position}, Value: name}
+	case "IntegerLiteral":
+		position := f.position()
+		var value int64
+		f.decode("value", &value)
+		literal := f.string("literal")
+		node = &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Position: position}, Value: value}
+	case "FloatLiteral":
+		position := f.position()
+		var value float64
+		f.decode("value", &value)
+		literal := f.string("literal")
+		node = &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: literal, Position: position}, Value: value}
+	case "BooleanLiteral":
+		position := f.position()
+		var value bool
+		f.decode("value", &value)
+		literal := fmt.Sprint(value)
+		node = &BooleanLiteral{
+			Token: token.Token{Type: token.LookupIdentifier(literal), Literal: literal, Position: position},
+			Value: value,
+		}
+	case "StringLiteral":
+		position := f.position()
+		value := f.string("value")
+		node = &StringLiteral{Token: token.Token{Type: token.STRING, Literal: value, Position: position}, Value: value}
+	case "InterpolatedString":
+		position := f.position()
+		node = &InterpolatedString{
+			Token: token.Token{Type: token.INTERPOLATED_STRING, Position: position},
+			Parts: f.expressions("parts"),
+		}
+	case "PrefixExpression":
+		position := f.position()
+		operator := f.string("operator")
+		node = &PrefixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator, Position: position},
+			Operator: operator,
+			Right:    f.expression("right"),
+		}
+	case "InfixExpression":
+		position := f.position()
+		operator := f.string("operator")
+		node = &InfixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator, Position: position},
+			Left:     f.expression("left"),
+			Operator: operator,
+			Right:    f.expression("right"),
+		}
+	case "IfExpression":
+		position := f.position()
+		node = &IfExpression{
+			Token:       token.Token{Type: token.IF, Literal: "if", Position: position},
+			Condition:   f.expression("condition"),
+			Consequence: f.block("consequence"),
+			Alternative: f.block("alternative"),
+		}
+	case "FunctionLiteral":
+		position := f.position()
+		function := &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn", Position: position}}
+		function.Parameters = make([]Parameter, 0)
+		for _, parameter := range f.children("parameters") {
+			if pattern, ok := parameter.(Pattern); ok {
+				function.Parameters = append(function.Parameters, Parameter{Pattern: pattern})
+			} else if identifier := f.identifier(parameter, "parameters"); identifier != nil {
+				function.Parameters = append(function.Parameters, Parameter{Name: identifier})
+			}
+		}
+		defaults := f.children("defaults")
+		if len(defaults) != len(function.Parameters) && f.err == nil {
+			f.err = fmt.Errorf("ast: FunctionLiteral has %d defaults for %d parameters", len(defaults), len(function.Parameters))
+		}
+		for i, value := range defaults {
+			if i < len(function.Parameters) {
+				function.Parameters[i].Default = f.asExpression(value)
+			}
+		}
+		if rest := f.child("rest"); rest != nil {
+			function.Rest = f.identifier(rest, "rest")
+		}
+		function.Body = f.block("body")
+		node = function
+	case "MacroLiteral":
+		position := f.position()
+		macro := &MacroLiteral{Token: token.Token{Type: token.MACRO, Literal: "macro", Position: position}}
+		macro.Parameters = make([]Identifier, 0)
+		for _, parameter := range f.children("parameters") {
+			if identifier := f.identifier(parameter, "parameters"); identifier != nil {
+				macro.Parameters = append(macro.Parameters, *identifier)
+			}
+		}
+		macro.Body = f.block("body")
+		node = macro
+	case "CallExpression":
+		position := f.position()
+		node = &CallExpression{
+			Token:     token.Token{Type: token.LPAREN, Literal: "(", Position: position},
+			Function:  f.expression("function"),
+			Arguments: f.expressions("arguments"),
+		}
+	case "SpreadExpression":
+		position := f.position()
+		node = &SpreadExpression{
+			Token: token.Token{Type: token.ELLIPSIS, Literal: "...", Position: position},
+			Value: f.expression("value"),
+		}
+	case "NamedArgument":
+		node = &NamedArgument{
+			Name:  f.identifier(f.child("name"), "name"),
+			Value: f.expression("value"),
+		}
+	case "ArrayExpression":
+		position := f.position()
+		node = &ArrayExpression{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Elements: f.expressions("elements"),
+		}
+	case "HashExpression":
+		position := f.position()
+		hash := &HashExpression{Token: token.Token{Type: token.LBRACE, Literal: "{", Position: position}}
+		var entries []map[string]json.RawMessage
+		f.decode("entries", &entries)
+		hash.Entries = make([]HashEntry, 0, len(entries))
+		for _, entry := range entries {
+			fields := &jsonFields{kind: "HashEntry", fields: entry, err: f.err}
+			hash.Entries = append(hash.Entries, HashEntry{Key: fields.expression("key"), Value: fields.expression("value")})
+			f.err = fields.err
+		}
+		node = hash
+	case "IndexExpression":
+		position := f.position()
+		node = &IndexExpression{
+			Token: token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Left:  f.expression("left"),
+			Index: f.expression("index"),
+		}
+	case "SliceExpression":
+		position := f.position()
+		node = &SliceExpression{
+			Token: token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Left:  f.expression("left"),
+			Start: f.optionalExpression("start"),
+			End:   f.optionalExpression("end"),
+			Step:  f.optionalExpression("step"),
+		}
+	case "MatchExpression":
+		position := f.position()
+		match := &MatchExpression{
+			Token: token.Token{Type: token.MATCH, Literal: "match", Position: position},
+			Value: f.expression("value"),
+		}
+		var arms []map[string]json.RawMessage
+		f.decode("arms", &arms)
+		match.Arms = make([]MatchArm, 0, len(arms))
+		for _, arm := range arms {
+			fields := &jsonFields{kind: "MatchArm", fields: arm, err: f.err}
+			match.Arms = append(match.Arms, MatchArm{
+				Pattern: fields.pattern("pattern"),
+				Guard:   fields.optionalExpression("guard"),
+				Body:    fields.expression("body"),
+			})
+			f.err = fields.err
+		}
+		node = match
+	case "WildcardPattern":
+		position := f.position()
+		node = &WildcardPattern{Token: token.Token{Type: token.IDENT, Literal: "_", Position: position}}
+	case "BindingPattern":
+		node = &BindingPattern{Name: f.identifier(f.child("name"), "name")}
+	case "LiteralPattern":
+		node = &LiteralPattern{Value: f.expression("value")}
+	case "ArrayPattern":
+		position := f.position()
+		array := &ArrayPattern{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Elements: f.patterns("elements"),
+		}
+		if rest := f.child("rest"); rest != nil {
+			array.Rest = f.identifier(rest, "rest")
+		}
+		node = array
+	case "HashPattern":
+		position := f.position()
+		hash := &HashPattern{Token: token.Token{Type: token.LBRACE, Literal: "{", Position: position}}
+		var entries []map[string]json.RawMessage
+		f.decode("entries", &entries)
+		hash.Entries = make([]HashPatternEntry, 0, len(entries))
+		for _, entry := range entries {
+			fields := &jsonFields{kind: "HashPatternEntry", fields: entry, err: f.err}
+			hash.Entries = append(hash.Entries, HashPatternEntry{Key: fields.expression("key"), Value: fields.pattern("value")})
+			f.err = fields.err
+		}
+		node = hash
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", f.kind)
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return node, nil
+}
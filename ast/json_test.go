@@ -0,0 +1,146 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/token"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	node := &ExpressionStatement{
+		Token: token.Token{Type: token.IDENT, Literal: "x", Position: token.Position{Line: 1, Column: 1}},
+		Expression: &InfixExpression{
+			Token:    token.Token{Type: token.PLUS, Literal: "+", Position: token.Position{Line: 1, Column: 3}},
+			Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Position: token.Position{Line: 1, Column: 1}}, Value: "x"},
+			Operator: "+",
+			Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0x1", Position: token.Position{Line: 1, Column: 5}}, Value: 1},
+		},
+	}
+	expected := `{
+  "expression": {
+    "kind": "InfixExpression",
+    "left": {
+      "kind": "Identifier",
+      "name": "x",
+      "position": {
+        "line": 1,
+        "column": 1
+      }
+    },
+    "operator": "+",
+    "position": {
+      "line": 1,
+      "column": 3
+    },
+    "right": {
+      "kind": "IntegerLiteral",
+      "literal": "0x1",
+      "position": {
+        "line": 1,
+        "column": 5
+      },
+      "value": 1
+    }
+  },
+  "kind": "ExpressionStatement",
+  "position": {
+    "line": 1,
+    "column": 1
+  }
+}`
+
+	data, err := EncodeJSON(node)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("wrong encoding.\nexpected=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := sampleProgram()
+	data, err := EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %v", err)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("decoded program differs.\nexpected=%q\ngot=%q", program.String(), decoded.String())
+	}
+	again, err := EncodeJSON(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error encoding decoded program %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("encoding differs after round trip.\nexpected=%s\ngot=%s", data, again)
+	}
+
+	float := &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "2.5e-3"}, Value: 2.5e-3}
+	data, err = EncodeJSON(float)
+	if err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	decoded, err = DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %v", err)
+	}
+	if decodedFloat, ok := decoded.(*FloatLiteral); !ok || decodedFloat.Value != float.Value || decodedFloat.String() != "2.5e-3" {
+		t.Errorf("expected %s, got %#v", float, decoded)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[]`, "cannot unmarshal array"},
+		{`{}`, `node is missing field "kind"`},
+		{`{"kind": "Widget"}`, `unknown node kind "Widget"`},
+		{`{"kind": "Identifier", "name": "x"}`, `Identifier is missing field "position"`},
+		{
+			`{"kind": "PrefixExpression", "position": {"line": 1, "column": 1}, "operator": "-", "right": null}`,
+			`PrefixExpression field "right" is null, expected an expression`,
+		},
+		{
+			`{"kind": "Program", "statements": [{"kind": "Identifier", "position": {"line": 1, "column": 1}, "name": "x"}]}`,
+			`Program field "statements" contains Identifier, expected a statement`,
+		},
+		{
+			`{"kind": "LetStatement", "position": {"line": 1, "column": 1}, "name": {"kind": "Program", "statements": []}, "value": null}`,
+			`LetStatement field "name" contains Program, expected an Identifier`,
+		},
+		{
+			`{"kind": "LetStatement", "position": {"line": 1, "column": 1}, "name": null, "pattern": null, "value": null}`,
+			`LetStatement field "pattern" contains null, expected a pattern`,
+		},
+		{
+			`{"kind": "HashExpression", "position": {"line": 1, "column": 1}, "entries": [{"key": null, "value": null}]}`,
+			`HashEntry field "key" is null`,
+		},
+		{
+			`{"kind": "FunctionLiteral", "position": {"line": 1, "column": 1}, "parameters": [], "defaults": [null], "rest": null, "body": null}`,
+			`FunctionLiteral has 1 defaults for 0 parameters`,
+		},
+		{
+			`{"kind": "ArrayPattern", "position": {"line": 1, "column": 1}, "elements": [{"kind": "Identifier", "position": {"line": 1, "column": 2}, "name": "x"}], "rest": null}`,
+			`ArrayPattern field "elements" contains Identifier, expected a pattern`,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package ast
+
+import (
+	"bytes"
+
+	"danielmcm.com/interpreterbook/token"
+)
+
+// Pattern is matched against a value, binding names to parts of it.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, which matches any value without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode() {}
+func (wp *WildcardPattern) TokenLiteral() string {
+	return wp.Token.Literal
+}
+func (wp *WildcardPattern) String() string {
+	return "_"
+}
+
+// BindingPattern matches any value, binding it to a name.
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode() {}
+func (bp *BindingPattern) TokenLiteral() string {
+	return bp.Name.TokenLiteral()
+}
+func (bp *BindingPattern) String() string {
+	return bp.Name.String()
+}
+
+// LiteralPattern matches values equal to an integer, float, string or
+// boolean literal. Negative numbers are parsed as a single IntegerLiteral or
+// FloatLiteral.
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode() {}
+func (lp *LiteralPattern) TokenLiteral() string {
+	return lp.Value.TokenLiteral()
+}
+func (lp *LiteralPattern) String() string {
+	return lp.Value.String()
+}
+
+// ArrayPattern matches arrays whose elements match Elements in turn. Without
+// a Rest, the array must have exactly as many elements; with one, the
+// remaining elements are bound to it as an array.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode() {}
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("[")
+	for i, element := range ap.Elements {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(element.String())
+	}
+	if ap.Rest != nil {
+		if len(ap.Elements) > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("...")
+		out.WriteString(ap.Rest.String())
+	}
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPatternEntry is a key in a hash pattern and the pattern its value must
+// match. An *Identifier key stands for the string of its name.
+type HashPatternEntry struct {
+	Key   Expression
+	Value Pattern
+}
+
+// HashPattern matches hashes holding each of its keys with a value matching
+// the key's pattern. Other keys are ignored.
+type HashPattern struct {
+	Token   token.Token
+	Entries []HashPatternEntry
+}
+
+func (hp *HashPattern) patternNode() {}
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for i, entry := range hp.Entries {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(entry.String())
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// String returns the entry as written, using the shorthand name for an
+// identifier key bound to the same name.
+func (entry HashPatternEntry) String() string {
+	if entry.IsShorthand() {
+		return entry.Key.String()
+	}
+	return entry.Key.String() + ": " + entry.Value.String()
+}
+
+// IsShorthand reports whether the entry can be written as just a name, as
+// in {name}, binding the value of the key "name" to name.
+func (entry HashPatternEntry) IsShorthand() bool {
+	key, ok := entry.Key.(*Identifier)
+	binding, isBinding := entry.Value.(*BindingPattern)
+	return ok && isBinding && binding.Name.Value == key.Value
+}
+
+// Bindings returns the names bound by a pattern, in source order. A rest
+// named _ binds nothing.
+func Bindings(pattern Pattern) []*Identifier {
+	names := make([]*Identifier, 0)
+	switch pattern := pattern.(type) {
+	case *BindingPattern:
+		names = append(names, pattern.Name)
+	case *ArrayPattern:
+		for _, element := range pattern.Elements {
+			names = append(names, Bindings(element)...)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			names = append(names, pattern.Rest)
+		}
+	case *HashPattern:
+		for _, entry := range pattern.Entries {
+			names = append(names, Bindings(entry.Value)...)
+		}
+	}
+	return names
+}
+
+// MatchArm is an arm of a match expression: a pattern, an optional guard
+// and the expression evaluated when they match.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+	// Slots are the names bound in the arm's environment, in slot order,
+	// set by the resolver
+	Slots []string
+}
+
+func (arm MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(arm.Pattern.String())
+	if arm.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(arm.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(arm.Body.String())
+
+	return out.String()
+}
+
+// MatchExpression is match (value) { pattern => expression, ... }. It
+// evaluates the body of the first arm whose pattern matches the value and
+// whose guard, if any, is truthy.
+type MatchExpression struct {
+	Token token.Token
+	Value Expression
+	Arms  []MatchArm
+}
+
+func (me *MatchExpression) expressionNode() {}
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("match (")
+	out.WriteString(me.Value.String())
+	out.WriteString(") { ")
+	for i, arm := range me.Arms {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(arm.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
@@ -0,0 +1,372 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called for each node found by Walk. If the
+// visitor returned is not nil, Walk visits each of the children of the node
+// with it, followed by a call of Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, starting by calling
+// visitor.Visit(node). Nil children are skipped. The parameters of a
+// function or macro literal are visited as *Identifier nodes, or as the
+// patterns destructuring them, each followed by its default value and the
+// last by the rest parameter. The key and value of each hash entry or hash
+// pattern entry are visited in turn, and so are the pattern, guard and body
+// of each match arm.
+func Walk(visitor Visitor, node Node) {
+	if visitor = visitor.Visit(node); visitor == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		walkStatements(visitor, node.Statements)
+	case *LetStatement:
+		if node.Pattern != nil {
+			Walk(visitor, node.Pattern)
+		} else {
+			Walk(visitor, node.Name)
+		}
+		walkExpression(visitor, node.Value)
+	case *ReturnStatement:
+		walkExpression(visitor, node.ReturnValue)
+	case *BlockStatement:
+		walkStatements(visitor, node.Statements)
+	case *ExpressionStatement:
+		walkExpression(visitor, node.Expression)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *BooleanLiteral, *StringLiteral, *WildcardPattern:
+		// no children
+	case *InterpolatedString:
+		walkExpressions(visitor, node.Parts)
+	case *PrefixExpression:
+		walkExpression(visitor, node.Right)
+	case *InfixExpression:
+		walkExpression(visitor, node.Left)
+		walkExpression(visitor, node.Right)
+	case *IfExpression:
+		walkExpression(visitor, node.Condition)
+		if node.Consequence != nil {
+			Walk(visitor, node.Consequence)
+		}
+		if node.Alternative != nil {
+			Walk(visitor, node.Alternative)
+		}
+	case *FunctionLiteral:
+		for _, parameter := range node.Parameters {
+			if parameter.Pattern != nil {
+				Walk(visitor, parameter.Pattern)
+			} else {
+				Walk(visitor, parameter.Name)
+			}
+			walkExpression(visitor, parameter.Default)
+		}
+		if node.Rest != nil {
+			Walk(visitor, node.Rest)
+		}
+		if node.Body != nil {
+			Walk(visitor, node.Body)
+		}
+	case *MacroLiteral:
+		for i := range node.Parameters {
+			Walk(visitor, &node.Parameters[i])
+		}
+		if node.Body != nil {
+			Walk(visitor, node.Body)
+		}
+	case *CallExpression:
+		walkExpression(visitor, node.Function)
+		walkExpressions(visitor, node.Arguments)
+	case *SpreadExpression:
+		walkExpression(visitor, node.Value)
+	case *NamedArgument:
+		Walk(visitor, node.Name)
+		walkExpression(visitor, node.Value)
+	case *ArrayExpression:
+		walkExpressions(visitor, node.Elements)
+	case *HashExpression:
+		for _, entry := range node.Entries {
+			walkExpression(visitor, entry.Key)
+			walkExpression(visitor, entry.Value)
+		}
+	case *IndexExpression:
+		walkExpression(visitor, node.Left)
+		walkExpression(visitor, node.Index)
+	case *SliceExpression:
+		walkExpression(visitor, node.Left)
+		walkExpression(visitor, node.Start)
+		walkExpression(visitor, node.End)
+		walkExpression(visitor, node.Step)
+	case *MatchExpression:
+		walkExpression(visitor, node.Value)
+		for _, arm := range node.Arms {
+			walkPattern(visitor, arm.Pattern)
+			walkExpression(visitor, arm.Guard)
+			walkExpression(visitor, arm.Body)
+		}
+	case *BindingPattern:
+		Walk(visitor, node.Name)
+	case *LiteralPattern:
+		walkExpression(visitor, node.Value)
+	case *ArrayPattern:
+		for _, element := range node.Elements {
+			walkPattern(visitor, element)
+		}
+		if node.Rest != nil {
+			Walk(visitor, node.Rest)
+		}
+	case *HashPattern:
+		for _, entry := range node.Entries {
+			walkExpression(visitor, entry.Key)
+			walkPattern(visitor, entry.Value)
+		}
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	visitor.Visit(nil)
+}
+
+func walkStatements(visitor Visitor, statements []Statement) {
+	for _, statement := range statements {
+		if statement != nil {
+			Walk(visitor, statement)
+		}
+	}
+}
+
+func walkExpression(visitor Visitor, expression Expression) {
+	if expression != nil {
+		Walk(visitor, expression)
+	}
+}
+
+func walkExpressions(visitor Visitor, expressions []Expression) {
+	for _, expression := range expressions {
+		walkExpression(visitor, expression)
+	}
+}
+
+func walkPattern(visitor Visitor, pattern Pattern) {
+	if pattern != nil {
+		Walk(visitor, pattern)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f(node) for each
+// node. If f returns true, Inspect continues with the children of the node,
+// followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc returns the replacement for a node, or the node itself to
+// leave it unchanged.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites an AST from the bottom up, replacing the children of each
+// node with the result of modifying them before calling modifier on the node
+// itself. Nodes are changed in place, and the modified root is returned.
+//
+// A replacement must fit where the original node was: a Statement for a
+// statement, an Expression for an expression, a Pattern for a pattern, a
+// *BlockStatement for a block and an *Identifier for a let binding,
+// parameter or pattern binding. Modify panics otherwise.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		modifyStatements(node.Statements, modifier)
+	case *LetStatement:
+		if node.Pattern != nil {
+			node.Pattern = modifyPattern(node.Pattern, modifier)
+		} else {
+			node.Name = Modify(node.Name, modifier).(*Identifier)
+		}
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+	case *BlockStatement:
+		modifyStatements(node.Statements, modifier)
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *BooleanLiteral, *StringLiteral, *WildcardPattern:
+		// no children
+	case *InterpolatedString:
+		modifyExpressions(node.Parts, modifier)
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+	case *FunctionLiteral:
+		for i, parameter := range node.Parameters {
+			if parameter.Pattern != nil {
+				node.Parameters[i].Pattern = modifyPattern(parameter.Pattern, modifier)
+			} else {
+				node.Parameters[i].Name = Modify(parameter.Name, modifier).(*Identifier)
+			}
+			node.Parameters[i].Default = modifyExpression(parameter.Default, modifier)
+		}
+		if node.Rest != nil {
+			node.Rest = Modify(node.Rest, modifier).(*Identifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *MacroLiteral:
+		for i := range node.Parameters {
+			node.Parameters[i] = *Modify(&node.Parameters[i], modifier).(*Identifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		modifyExpressions(node.Arguments, modifier)
+	case *SpreadExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *NamedArgument:
+		node.Name = Modify(node.Name, modifier).(*Identifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ArrayExpression:
+		modifyExpressions(node.Elements, modifier)
+	case *HashExpression:
+		for i, entry := range node.Entries {
+			node.Entries[i] = HashEntry{
+				Key:   modifyExpression(entry.Key, modifier),
+				Value: modifyExpression(entry.Value, modifier),
+			}
+		}
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+	case *SliceExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Start = modifyExpression(node.Start, modifier)
+		node.End = modifyExpression(node.End, modifier)
+		node.Step = modifyExpression(node.Step, modifier)
+	case *MatchExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+		for i, arm := range node.Arms {
+			node.Arms[i] = MatchArm{
+				Pattern: modifyPattern(arm.Pattern, modifier),
+				Guard:   modifyExpression(arm.Guard, modifier),
+				Body:    modifyExpression(arm.Body, modifier),
+			}
+		}
+	case *BindingPattern:
+		node.Name = Modify(node.Name, modifier).(*Identifier)
+	case *LiteralPattern:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ArrayPattern:
+		for i, element := range node.Elements {
+			node.Elements[i] = modifyPattern(element, modifier)
+		}
+		if node.Rest != nil {
+			node.Rest = Modify(node.Rest, modifier).(*Identifier)
+		}
+	case *HashPattern:
+		for i, entry := range node.Entries {
+			node.Entries[i] = HashPatternEntry{
+				Key:   modifyExpression(entry.Key, modifier),
+				Value: modifyPattern(entry.Value, modifier),
+			}
+		}
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", node))
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) {
+	for i, statement := range statements {
+		if statement != nil {
+			statements[i] = Modify(statement, modifier).(Statement)
+		}
+	}
+}
+
+func modifyExpression(expression Expression, modifier ModifierFunc) Expression {
+	if expression == nil {
+		return nil
+	}
+	return Modify(expression, modifier).(Expression)
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) {
+	for i, expression := range expressions {
+		expressions[i] = modifyExpression(expression, modifier)
+	}
+}
+
+func modifyPattern(pattern Pattern, modifier ModifierFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	return Modify(pattern, modifier).(Pattern)
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Modify(block, modifier).(*BlockStatement)
+}
+
+// Copy returns a deep copy of an AST, so that it can be modified without
+// changing the original.
+func Copy(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(node)).Interface().(Node)
+}
+
+func copyValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		if value.Kind() == reflect.Interface {
+			copied := reflect.New(value.Type()).Elem()
+			copied.Set(copyValue(value.Elem()))
+			return copied
+		}
+		copied := reflect.New(value.Type().Elem())
+		copied.Elem().Set(copyValue(value.Elem()))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(value.Type()).Elem()
+		for i := 0; i < value.NumField(); i++ {
+			copied.Field(i).Set(copyValue(value.Field(i)))
+		}
+		return copied
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(copyValue(value.Index(i)))
+		}
+		return copied
+	default:
+		return value
+	}
+}
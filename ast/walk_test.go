@@ -0,0 +1,260 @@
+package ast
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/token"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	literal := fmt.Sprint(value)
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: value}
+}
+
+// sampleProgram returns a program containing every type of node:
+//
+//	let f = fn(a, b) { return a + b; };
+//	if (!true) { f(1, 2) } else { {"k": [1, 2][0]} };
+//	"x${f[1:2:3]}";
+//	let m = macro(x) { x };
+//	match (f) { [-1, _, ...r] if r => r, {"k": v, w} => v };
+//	let [p, ...q] = fn({y}, z = 1.5, ...s) { y(...z, k: s) };
+func sampleProgram() *Program {
+	return &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("f"),
+			Value: &FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []Parameter{{Name: ident("a")}, {Name: ident("b")}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ReturnStatement{
+						Token:       token.Token{Type: token.RETURN, Literal: "return"},
+						ReturnValue: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")},
+					},
+				}},
+			},
+		},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &PrefixExpression{Operator: "!", Right: &BooleanLiteral{Token: token.Token{Literal: "true"}, Value: true}},
+			Consequence: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &CallExpression{
+					Function:  ident("f"),
+					Arguments: []Expression{integer(1), integer(2)},
+				}},
+			}},
+			Alternative: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &HashExpression{Entries: []HashEntry{{
+					Key: &StringLiteral{Value: "k"},
+					Value: &IndexExpression{
+						Left:  &ArrayExpression{Elements: []Expression{integer(1), integer(2)}},
+						Index: integer(0),
+					},
+				}}}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &InterpolatedString{Parts: []Expression{
+			&StringLiteral{Value: "x"},
+			&SliceExpression{Left: ident("f"), Start: integer(1), End: integer(2), Step: integer(3)},
+		}}},
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("m"),
+			Value: &MacroLiteral{
+				Token:      token.Token{Type: token.MACRO, Literal: "macro"},
+				Parameters: []Identifier{*ident("x")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("x")}}},
+			},
+		},
+		&ExpressionStatement{Expression: &MatchExpression{
+			Token: token.Token{Type: token.MATCH, Literal: "match"},
+			Value: ident("f"),
+			Arms: []MatchArm{
+				{
+					Pattern: &ArrayPattern{
+						Elements: []Pattern{&LiteralPattern{Value: integer(-1)}, &WildcardPattern{}},
+						Rest:     ident("r"),
+					},
+					Guard: ident("r"),
+					Body:  ident("r"),
+				},
+				{
+					Pattern: &HashPattern{Entries: []HashPatternEntry{
+						{Key: &StringLiteral{Value: "k"}, Value: &BindingPattern{Name: ident("v")}},
+						{Key: ident("w"), Value: &BindingPattern{Name: ident("w")}},
+					}},
+					Body: ident("v"),
+				},
+			},
+		}},
+		&LetStatement{
+			Token:   token.Token{Type: token.LET, Literal: "let"},
+			Pattern: &ArrayPattern{Elements: []Pattern{&BindingPattern{Name: ident("p")}}, Rest: ident("q")},
+			Value: &FunctionLiteral{
+				Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []Parameter{
+					{Pattern: &HashPattern{Entries: []HashPatternEntry{
+						{Key: ident("y"), Value: &BindingPattern{Name: ident("y")}},
+					}}},
+					{Name: ident("z"), Default: &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "1.5"}, Value: 1.5}},
+				},
+				Rest: ident("s"),
+				Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &CallExpression{
+					Function:  ident("y"),
+					Arguments: []Expression{&SpreadExpression{Value: ident("z")}, &NamedArgument{Name: ident("k"), Value: ident("s")}},
+				}}}},
+			},
+		},
+	}}
+}
+
+// TestWalkCoversAllNodes checks that sampleProgram, and so Walk, includes
+// every node type declared in this package.
+func TestWalkCoversAllNodes(t *testing.T) {
+	files, err := goparser.ParseDir(gotoken.NewFileSet(), ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("parsing package source: %v", err)
+	}
+	declared := map[string]bool{"*Program": true}
+	for _, file := range files["ast"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || (fn.Name.Name != "expressionNode" && fn.Name.Name != "statementNode" && fn.Name.Name != "patternNode") {
+				continue
+			}
+			receiver := fn.Recv.List[0].Type.(*goast.StarExpr).X.(*goast.Ident)
+			declared["*"+receiver.Name] = true
+		}
+	}
+
+	visited := make(map[string]bool)
+	Inspect(sampleProgram(), func(node Node) bool {
+		if node != nil {
+			visited["*"+reflect.TypeOf(node).Elem().Name()] = true
+		}
+		return true
+	})
+	for name := range declared {
+		if !visited[name] {
+			t.Errorf("node type %s is not visited; add it to sampleProgram and Walk", name)
+		}
+	}
+}
+
+type recorder struct {
+	events *[]string
+}
+
+func (r recorder) Visit(node Node) Visitor {
+	if node == nil {
+		*r.events = append(*r.events, "end")
+		return nil
+	}
+	*r.events = append(*r.events, reflect.TypeOf(node).Elem().Name())
+	if _, ok := node.(*FunctionLiteral); ok {
+		return nil
+	}
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	events := make([]string, 0)
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: &FunctionLiteral{Parameters: []Parameter{{Name: ident("a")}}}},
+		&ExpressionStatement{Expression: &InfixExpression{Left: ident("f"), Operator: "+", Right: integer(1)}},
+	}}
+	Walk(recorder{&events}, program)
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "end", "FunctionLiteral", "end",
+		"ExpressionStatement", "InfixExpression", "Identifier", "end", "IntegerLiteral", "end", "end", "end",
+		"end",
+	}
+	if strings.Join(events, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong visit order.\nexpected=%v\ngot=%v", expected, events)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	names := make([]string, 0)
+	Inspect(sampleProgram(), func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, isIf := node.(*IfExpression)
+		return !isIf
+	})
+
+	expected := "f a b a b f m x x f r r r v w w v p q y y z s y z k s"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("wrong identifiers. expected=%q, got=%q", expected, strings.Join(names, " "))
+	}
+}
+
+func TestModify(t *testing.T) {
+	program := Modify(sampleProgram(), func(node Node) Node {
+		switch node := node.(type) {
+		case *IntegerLiteral:
+			return integer(node.Value * 10)
+		case *Identifier:
+			return ident(strings.ToUpper(node.Value))
+		case *StringLiteral:
+			return &StringLiteral{Value: node.Value + node.Value}
+		}
+		return node
+	})
+
+	expected := `let F = fn(A, B) { return (A + B); };
+if (!true) { F(10, 20); }else { {"kk": ([10, 20][0])}; };
+"xx${(F[10:20:30])}";
+let M = macro(X) { X; };
+match (F) { [-10, _, ...R] if R => R, {"kk": V, W} => V };
+let [P, ...Q] = fn({Y}, Z = 1.5, ...S) { Y(...Z, K: S); };
+`
+	if program.String() != expected {
+		t.Errorf("wrong result.\nexpected=%q\ngot=%q", expected, program.String())
+	}
+}
+
+func TestModifyReplacesRoot(t *testing.T) {
+	result := Modify(integer(1), func(node Node) Node {
+		return ident("x")
+	})
+	if result.String() != "x" {
+		t.Errorf("expected root to be replaced, got %q", result.String())
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := sampleProgram()
+	copied := Copy(original)
+	if copied.String() != original.String() {
+		t.Fatalf("copy differs.\nexpected=%q\ngot=%q", original.String(), copied.String())
+	}
+	Modify(copied, func(node Node) Node {
+		if identifier, ok := node.(*Identifier); ok {
+			identifier.Value = "changed"
+		}
+		return node
+	})
+	if original.String() != sampleProgram().String() {
+		t.Errorf("modifying the copy changed the original: %q", original.String())
+	}
+	if Copy(nil) != nil {
+		t.Errorf("expected the copy of nil to be nil")
+	}
+}
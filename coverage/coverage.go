@@ -0,0 +1,255 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+)
+
+// Coverage counts how often the statements, if expression branches and
+// function bodies of programs are evaluated, using evaluator hooks.
+type Coverage struct {
+	files      []*file
+	statements map[ast.Statement]int
+	// branches counts the evaluations of each consequence and alternative
+	branches  map[*ast.IfExpression]*[2]int
+	functions map[*ast.BlockStatement]int
+}
+
+// file is a program being covered, with its statements, if expressions and
+// function literals in source order.
+type file struct {
+	name       string
+	lines      []string
+	statements []ast.Statement
+	branches   []*ast.IfExpression
+	functions  []*ast.FunctionLiteral
+	// names of functions bound by let statements
+	names map[*ast.FunctionLiteral]string
+}
+
+func New() *Coverage {
+	return &Coverage{
+		statements: make(map[ast.Statement]int),
+		branches:   make(map[*ast.IfExpression]*[2]int),
+		functions:  make(map[*ast.BlockStatement]int),
+	}
+}
+
+// Add adds a program parsed from source in the named file. Only evaluation
+// of programs that have been added is counted.
+func (c *Coverage) Add(filename string, source string, program *ast.Program) {
+	f := &file{name: filename, lines: strings.Split(strings.TrimSuffix(source, "\n"), "\n"), names: make(map[*ast.FunctionLiteral]string)}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+		case ast.Statement:
+			f.statements = append(f.statements, node)
+			c.statements[node] = 0
+			if let, ok := node.(*ast.LetStatement); ok {
+				if function, ok := let.Value.(*ast.FunctionLiteral); ok && let.Name != nil {
+					f.names[function] = let.Name.Value
+				}
+			}
+		case *ast.IfExpression:
+			f.branches = append(f.branches, node)
+			c.branches[node] = &[2]int{}
+		case *ast.FunctionLiteral:
+			f.functions = append(f.functions, node)
+			c.functions[node.Body] = 0
+		}
+		return true
+	})
+	c.files = append(c.files, f)
+}
+
+// Hooks returns the evaluator hooks that count evaluation. They should be
+// set on the environment programs are evaluated in.
+func (c *Coverage) Hooks() *object.Hooks {
+	return &object.Hooks{
+		Statement: func(statement ast.Statement, env *object.Environment) error {
+			if count, ok := c.statements[statement]; ok {
+				c.statements[statement] = count + 1
+			}
+			return nil
+		},
+		Branch: func(expression *ast.IfExpression, consequence bool) {
+			if counts, ok := c.branches[expression]; ok {
+				if consequence {
+					counts[0]++
+				} else {
+					counts[1]++
+				}
+			}
+		},
+		Call: func(call *ast.CallExpression, called object.Object, args []object.Object) func() {
+			if function, ok := called.(*object.Function); ok {
+				if count, ok := c.functions[function.Body]; ok {
+					c.functions[function.Body] = count + 1
+				}
+			}
+			return func() {}
+		},
+	}
+}
+
+// Summary is the coverage of a file.
+type Summary struct {
+	Filename      string
+	Statements    int
+	StatementsHit int
+	// Branches counts the consequence and alternative of each if
+	// expression, whether or not it has an else block
+	Branches     int
+	BranchesHit  int
+	Functions    int
+	FunctionsHit int
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%s: statements %s, branches %s, functions %s", s.Filename,
+		percent(s.StatementsHit, s.Statements), percent(s.BranchesHit, s.Branches), percent(s.FunctionsHit, s.Functions))
+}
+
+func percent(hit int, total int) string {
+	if total == 0 {
+		return "100.0% (0/0)"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", 100*float64(hit)/float64(total), hit, total)
+}
+
+// Summaries returns the coverage of each file, in the order they were added.
+func (c *Coverage) Summaries() []Summary {
+	summaries := make([]Summary, len(c.files))
+	for i, f := range c.files {
+		summary := Summary{Filename: f.name, Statements: len(f.statements), Branches: 2 * len(f.branches), Functions: len(f.functions)}
+		for _, statement := range f.statements {
+			if c.statements[statement] > 0 {
+				summary.StatementsHit++
+			}
+		}
+		for _, branch := range f.branches {
+			for _, count := range c.branches[branch] {
+				if count > 0 {
+					summary.BranchesHit++
+				}
+			}
+		}
+		for _, function := range f.functions {
+			if c.functions[function.Body] > 0 {
+				summary.FunctionsHit++
+			}
+		}
+		summaries[i] = summary
+	}
+	return summaries
+}
+
+// functionName returns the name a function literal is bound to, or
+// fn@line:column if it is anonymous.
+func (f *file) functionName(function *ast.FunctionLiteral) string {
+	if name, ok := f.names[function]; ok {
+		return name
+	}
+	return fmt.Sprintf("fn@%s", function.Token.Position)
+}
+
+// lineCounts returns the number of times each line with statements was
+// evaluated, taken as the greatest count of the statements starting on it,
+// and the lines with a statement or branch that was never evaluated.
+func (c *Coverage) lineCounts(f *file) (map[int]int, map[int]bool) {
+	counts := make(map[int]int)
+	partial := make(map[int]bool)
+	for _, statement := range f.statements {
+		line := ast.StatementPosition(statement).Line
+		count := c.statements[statement]
+		counts[line] = max(counts[line], count)
+		if count == 0 {
+			partial[line] = true
+		}
+	}
+	for _, branch := range f.branches {
+		taken := c.branches[branch]
+		if taken[0] == 0 || taken[1] == 0 {
+			partial[branch.Token.Position.Line] = true
+		}
+	}
+	return counts, partial
+}
+
+// WriteLCOV writes the coverage of every file in LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	var out strings.Builder
+	summaries := c.Summaries()
+	for i, f := range c.files {
+		summary := summaries[i]
+		fmt.Fprintf(&out, "TN:\nSF:%s\n", f.name)
+		for _, function := range f.functions {
+			fmt.Fprintf(&out, "FN:%d,%s\n", function.Token.Position.Line, f.functionName(function))
+		}
+		for _, function := range f.functions {
+			fmt.Fprintf(&out, "FNDA:%d,%s\n", c.functions[function.Body], f.functionName(function))
+		}
+		fmt.Fprintf(&out, "FNF:%d\nFNH:%d\n", summary.Functions, summary.FunctionsHit)
+
+		for block, branch := range f.branches {
+			counts := c.branches[branch]
+			for index, count := range counts {
+				taken := "-"
+				if counts[0]+counts[1] > 0 {
+					taken = fmt.Sprint(count)
+				}
+				fmt.Fprintf(&out, "BRDA:%d,%d,%d,%s\n", branch.Token.Position.Line, block, index, taken)
+			}
+		}
+		fmt.Fprintf(&out, "BRF:%d\nBRH:%d\n", summary.Branches, summary.BranchesHit)
+
+		counts, _ := c.lineCounts(f)
+		lines := make([]int, 0, len(counts))
+		hit := 0
+		for line, count := range counts {
+			lines = append(lines, line)
+			if count > 0 {
+				hit++
+			}
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(&out, "DA:%d,%d\n", line, counts[line])
+		}
+		fmt.Fprintf(&out, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// WriteListing writes the source of every file, each line prefixed with
+// the number of times it was evaluated, or - if it has no statements.
+// Lines with a statement or branch that was never evaluated are marked
+// with !.
+func (c *Coverage) WriteListing(w io.Writer) error {
+	var out strings.Builder
+	summaries := c.Summaries()
+	for i, f := range c.files {
+		fmt.Fprintf(&out, "%s\n", summaries[i])
+		counts, partial := c.lineCounts(f)
+		for index, text := range f.lines {
+			line := index + 1
+			count := "-"
+			if n, ok := counts[line]; ok {
+				count = fmt.Sprint(n)
+			}
+			marker := " "
+			if partial[line] {
+				marker = "!"
+			}
+			fmt.Fprintf(&out, "%7s%s| %s\n", count, marker, text)
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
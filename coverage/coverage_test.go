@@ -0,0 +1,108 @@
+package coverage
+
+import (
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+const source = `let abs = fn(x) {
+	if (x < 0) { -x } else { x }
+};
+let sign = fn(x) { if (x < 0) { -1 } };
+let unused = fn() { 0 };
+abs(3);
+abs(4);
+sign(2);
+`
+
+func cover(t *testing.T) *Coverage {
+	t.Helper()
+	program := parser.New(lexer.New(source)).ParseProgram()
+	coverage := New()
+	coverage.Add("math.mk", source, program)
+	env := object.NewEnvironment()
+	env.SetHooks(coverage.Hooks())
+	if _, err := evaluator.Eval(program, env); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// statements of programs that have not been added are not counted,
+	// but the functions they call are
+	other := parser.New(lexer.New("abs(-1)")).ParseProgram()
+	if _, err := evaluator.Eval(other, env); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return coverage
+}
+
+func TestSummaries(t *testing.T) {
+	summaries := cover(t).Summaries()
+	expected := Summary{Filename: "math.mk", Statements: 12, StatementsHit: 10, Branches: 4, BranchesHit: 3, Functions: 3, FunctionsHit: 2}
+	if len(summaries) != 1 || summaries[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, summaries)
+	}
+	if summaries[0].String() != "math.mk: statements 83.3% (10/12), branches 75.0% (3/4), functions 66.7% (2/3)" {
+		t.Errorf("wrong summary %q", summaries[0].String())
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	var out strings.Builder
+	if err := cover(t).WriteLCOV(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:math.mk
+FN:1,abs
+FN:4,sign
+FN:5,unused
+FNDA:3,abs
+FNDA:1,sign
+FNDA:0,unused
+FNF:3
+FNH:2
+BRDA:2,0,0,1
+BRDA:2,0,1,2
+BRDA:4,1,0,0
+BRDA:4,1,1,1
+BRF:4
+BRH:3
+DA:1,1
+DA:2,3
+DA:4,1
+DA:5,1
+DA:6,1
+DA:7,1
+DA:8,1
+LF:7
+LH:7
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("wrong LCOV.\nexpected=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	var out strings.Builder
+	if err := cover(t).WriteListing(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `math.mk: statements 83.3% (10/12), branches 75.0% (3/4), functions 66.7% (2/3)
+      1 | let abs = fn(x) {
+      3 | 	if (x < 0) { -x } else { x }
+      - | };
+      1!| let sign = fn(x) { if (x < 0) { -1 } };
+      1!| let unused = fn() { 0 };
+      1 | abs(3);
+      1 | abs(4);
+      1 | sign(2);
+`
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nexpected=%s\ngot=%s", expected, out.String())
+	}
+}
@@ -0,0 +1,529 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/debugger"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/transport"
+)
+
+// threadID identifies the only thread of a Monkey program.
+const threadID = 1
+
+var errNotStopped = errors.New("the program is not stopped")
+
+// Server is a debug adapter for Monkey, debugging a single program launched
+// by the client. The program runs on its own goroutine, which blocks while
+// it is stopped. Its output is sent to the client as output events.
+type Server struct {
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	writer  io.Writer
+	seq     int
+
+	// mu guards the state shared with the goroutine running the program
+	mu          sync.Mutex
+	path        string
+	program     *ast.Program
+	noDebug     bool
+	debugger    *debugger.Debugger
+	breakpoints []int
+	configured  bool
+	// done is closed when the program finishes, and is nil until it starts
+	done chan struct{}
+	// stop is where the program is stopped, or nil while it runs
+	stop    *debugger.Stop
+	resume  chan debugger.Action
+	handles []container
+
+	// afterResponse is run after the response to the current request is
+	// sent
+	afterResponse func()
+}
+
+// container is something with variables to show: an environment, array
+// or hash.
+type container struct {
+	env   *object.Environment
+	value object.Object
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader: bufio.NewReader(in),
+		writer: out,
+		resume: make(chan debugger.Action),
+	}
+}
+
+type handler func(server *Server, arguments json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":        (*Server).initialize,
+		"launch":            (*Server).launch,
+		"setBreakpoints":    (*Server).setBreakpoints,
+		"configurationDone": (*Server).configurationDone,
+		"threads":           (*Server).threads,
+		"stackTrace":        (*Server).stackTrace,
+		"scopes":            (*Server).scopes,
+		"variables":         (*Server).variables,
+		"evaluate":          (*Server).evaluate,
+		"continue":          resumeWith(debugger.Continue),
+		"next":              resumeWith(debugger.StepOver),
+		"stepIn":            resumeWith(debugger.StepIn),
+		"stepOut":           resumeWith(debugger.StepOut),
+		"pause":             (*Server).pause,
+		"terminate":         (*Server).terminate,
+		"disconnect":        (*Server).terminate,
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the input.
+// A running program is terminated first.
+func (server *Server) Serve() error {
+	defer server.stopProgram()
+	for {
+		content, err := transport.ReadMessage(server.reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var request message
+		if err := json.Unmarshal(content, &request); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+		if request.Type != "request" {
+			continue
+		}
+
+		handle, ok := handlers[request.Command]
+		var body interface{}
+		if ok {
+			body, err = handle(server, request.Arguments)
+		} else {
+			err = fmt.Errorf("unsupported request %q", request.Command)
+		}
+		reply := response{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: err == nil, Body: body}
+		if err != nil {
+			reply.Message = err.Error()
+		}
+		if err := server.send(&reply.Seq, reply); err != nil {
+			return err
+		}
+		if server.afterResponse != nil {
+			server.afterResponse()
+			server.afterResponse = nil
+		}
+		if request.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// send writes a message after setting its sequence number.
+func (server *Server) send(seq *int, message interface{}) error {
+	server.writeMu.Lock()
+	defer server.writeMu.Unlock()
+	server.seq++
+	*seq = server.seq
+	return transport.WriteMessage(server.writer, message)
+}
+
+func (server *Server) sendEvent(name string, body interface{}) error {
+	message := event{Type: "event", Event: name, Body: body}
+	return server.send(&message.Seq, message)
+}
+
+func decodeArguments(arguments json.RawMessage, value interface{}) error {
+	if err := json.Unmarshal(arguments, value); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func (server *Server) initialize(arguments json.RawMessage) (interface{}, error) {
+	server.afterResponse = func() {
+		server.sendEvent("initialized", nil)
+	}
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsEvaluateForHovers:        true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+func (server *Server) launch(arguments json.RawMessage) (interface{}, error) {
+	var launch LaunchArguments
+	if err := decodeArguments(arguments, &launch); err != nil {
+		return nil, err
+	}
+	source, err := os.ReadFile(launch.Program)
+	if err != nil {
+		return nil, err
+	}
+	program, err := evaluator.Prepare(string(source), nil)
+	if _, ok := parser.ErrorPosition(err); ok {
+		lines := strings.Split(err.Error(), "\n")
+		for i, line := range lines {
+			lines[i] = fmt.Sprintf("%s:%s", launch.Program, line)
+		}
+		return nil, errors.New(strings.Join(lines, "\n"))
+	} else if err != nil {
+		return nil, err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.program != nil {
+		return nil, errors.New("a program has already been launched")
+	}
+	server.path = launch.Program
+	server.program = program
+	server.noDebug = launch.NoDebug
+	server.debugger = debugger.New(launch.StopOnEntry)
+	server.debugger.SetBreakpoints(server.breakpoints)
+	server.startIfReady()
+	return nil, nil
+}
+
+func (server *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var set SetBreakpointsArguments
+	if err := decodeArguments(arguments, &set); err != nil {
+		return nil, err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	result := SetBreakpointsResponse{Breakpoints: make([]Breakpoint, 0)}
+	if server.program != nil && !samePath(set.Source.Path, server.path) {
+		for _, breakpoint := range set.Breakpoints {
+			result.Breakpoints = append(result.Breakpoints, Breakpoint{Line: breakpoint.Line, Message: "not in the launched program"})
+		}
+		return result, nil
+	}
+
+	statementLines := server.statementLines()
+	server.breakpoints = make([]int, 0)
+	for _, breakpoint := range set.Breakpoints {
+		verified := statementLines == nil || statementLines[breakpoint.Line]
+		result.Breakpoints = append(result.Breakpoints, Breakpoint{Verified: verified, Line: breakpoint.Line})
+		server.breakpoints = append(server.breakpoints, breakpoint.Line)
+	}
+	if server.debugger != nil {
+		server.debugger.SetBreakpoints(server.breakpoints)
+	}
+	return result, nil
+}
+
+func samePath(a string, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// statementLines returns the lines on which statements start, or nil if
+// no program has been launched.
+func (server *Server) statementLines() map[int]bool {
+	if server.program == nil {
+		return nil
+	}
+	lines := make(map[int]bool)
+	ast.Inspect(server.program, func(node ast.Node) bool {
+		if statement, ok := node.(ast.Statement); ok {
+			if _, isBlock := statement.(*ast.BlockStatement); !isBlock {
+				lines[ast.StatementPosition(statement).Line] = true
+			}
+		}
+		return true
+	})
+	return lines
+}
+
+func (server *Server) configurationDone(arguments json.RawMessage) (interface{}, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.configured = true
+	server.startIfReady()
+	return nil, nil
+}
+
+// startIfReady starts the program once it has been launched and the client
+// has finished configuring breakpoints.
+func (server *Server) startIfReady() {
+	if server.program == nil || !server.configured || server.done != nil {
+		return
+	}
+	server.done = make(chan struct{})
+	server.debugger.OnStop = server.stopped
+	program, noDebug, done := server.program, server.noDebug, server.done
+
+	// start after the response to the current request
+	server.afterResponse = func() {
+		go func() {
+			defer close(done)
+			env := object.NewEnvironment()
+			env.SetOutput(outputWriter{server: server, category: "stdout"})
+			if !noDebug {
+				env.SetHooks(server.debugger.Hooks())
+			}
+			_, err := evaluator.Eval(program, env)
+			exitCode := 0
+			if err != nil && err != debugger.ErrTerminated {
+				server.sendEvent("output", OutputEvent{Category: "stderr", Output: fmt.Sprintf("Error: %s\n", err)})
+				exitCode = 1
+			}
+			server.sendEvent("exited", ExitedEvent{ExitCode: exitCode})
+			server.sendEvent("terminated", nil)
+		}()
+	}
+}
+
+// outputWriter sends output from the program to the client.
+type outputWriter struct {
+	server   *Server
+	category string
+}
+
+func (writer outputWriter) Write(data []byte) (int, error) {
+	if err := writer.server.sendEvent("output", OutputEvent{Category: writer.category, Output: string(data)}); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// stopped is called on the program's goroutine when it stops, and waits
+// for the client to resume it.
+func (server *Server) stopped(stop debugger.Stop) debugger.Action {
+	server.mu.Lock()
+	server.stop = &stop
+	server.handles = nil
+	server.mu.Unlock()
+	server.sendEvent("stopped", StoppedEvent{Reason: string(stop.Reason), ThreadID: threadID, AllThreadsStopped: true})
+	return <-server.resume
+}
+
+// resumeWith returns a handler resuming a stopped program with an action.
+func resumeWith(action debugger.Action) handler {
+	return func(server *Server, arguments json.RawMessage) (interface{}, error) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if server.stop == nil {
+			return nil, errNotStopped
+		}
+		server.stop = nil
+		server.afterResponse = func() {
+			server.resume <- action
+		}
+		if action == debugger.Continue {
+			return ContinueResponse{AllThreadsContinued: true}, nil
+		}
+		return nil, nil
+	}
+}
+
+func (server *Server) pause(arguments json.RawMessage) (interface{}, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.debugger != nil {
+		server.debugger.Pause()
+	}
+	return nil, nil
+}
+
+func (server *Server) terminate(arguments json.RawMessage) (interface{}, error) {
+	server.stopProgram()
+	return nil, nil
+}
+
+// stopProgram terminates the program if it is running, and waits for it to
+// finish.
+func (server *Server) stopProgram() {
+	server.mu.Lock()
+	done := server.done
+	if server.debugger != nil {
+		server.debugger.Terminate()
+	}
+	server.stop = nil
+	server.mu.Unlock()
+	if done == nil {
+		return
+	}
+	// a running program terminates at its next statement, and a stopped
+	// one when resumed
+	select {
+	case <-done:
+	case server.resume <- debugger.Terminate:
+		<-done
+	}
+}
+
+func (server *Server) threads(arguments json.RawMessage) (interface{}, error) {
+	return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+func (server *Server) stackTrace(arguments json.RawMessage) (interface{}, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.stop == nil {
+		return nil, errNotStopped
+	}
+	source := &Source{Name: filepath.Base(server.path), Path: server.path}
+	frames := make([]StackFrame, len(server.stop.Frames))
+	for i, frame := range server.stop.Frames {
+		position := ast.StatementPosition(frame.Statement)
+		frames[i] = StackFrame{ID: i, Name: frame.Name, Source: source, Line: position.Line, Column: position.Column}
+	}
+	return StackTraceResponse{StackFrames: frames, TotalFrames: len(frames)}, nil
+}
+
+// frame returns a frame of the stopped program.
+func (server *Server) frame(id int) (debugger.Frame, error) {
+	if server.stop == nil {
+		return debugger.Frame{}, errNotStopped
+	}
+	if id < 0 || id >= len(server.stop.Frames) {
+		return debugger.Frame{}, fmt.Errorf("unknown frame %d", id)
+	}
+	return server.stop.Frames[id], nil
+}
+
+// scopes lists the environments visible from a frame, from the innermost.
+func (server *Server) scopes(arguments json.RawMessage) (interface{}, error) {
+	var scopes ScopesArguments
+	if err := decodeArguments(arguments, &scopes); err != nil {
+		return nil, err
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	frame, err := server.frame(scopes.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ScopesResponse{Scopes: make([]Scope, 0)}
+	for env := frame.Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		if env.Outer() == nil {
+			name = "Globals"
+		} else if env == frame.Env {
+			name = "Locals"
+		}
+		result.Scopes = append(result.Scopes, Scope{Name: name, VariablesReference: server.handle(container{env: env})})
+	}
+	return result, nil
+}
+
+// handle returns a reference to a container, valid until the program is
+// resumed.
+func (server *Server) handle(container container) int {
+	server.handles = append(server.handles, container)
+	return len(server.handles)
+}
+
+func (server *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var variables VariablesArguments
+	if err := decodeArguments(arguments, &variables); err != nil {
+		return nil, err
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.stop == nil {
+		return nil, errNotStopped
+	}
+	if variables.VariablesReference < 1 || variables.VariablesReference > len(server.handles) {
+		return nil, fmt.Errorf("unknown variables reference %d", variables.VariablesReference)
+	}
+
+	result := VariablesResponse{Variables: make([]Variable, 0)}
+	container := server.handles[variables.VariablesReference-1]
+	switch value := container.value.(type) {
+	case nil:
+		for _, name := range container.env.Names() {
+			value, _ := container.env.Get(name)
+			result.Variables = append(result.Variables, server.variable(name, value))
+		}
+	case *object.Array:
+		for i, element := range value.Elements {
+			result.Variables = append(result.Variables, server.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Hash:
+		for _, pair := range value.Pairs() {
+			result.Variables = append(result.Variables, server.variable(display(pair.Key), pair.Value))
+		}
+	}
+	return result, nil
+}
+
+// variable describes a value, giving arrays and hashes a reference to
+// their contents.
+func (server *Server) variable(name string, value object.Object) Variable {
+	variable := Variable{Name: name, Value: display(value), Type: string(value.Type())}
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			variable.VariablesReference = server.handle(container{value: value})
+		}
+	case *object.Hash:
+		if value.Len() > 0 {
+			variable.VariablesReference = server.handle(container{value: value})
+		}
+	}
+	return variable
+}
+
+// display shows a value, quoting strings.
+func display(value object.Object) string {
+	if str, ok := value.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return value.Inspect()
+}
+
+// evaluate evaluates an expression in a frame of the stopped program, or
+// the innermost frame if none is given.
+func (server *Server) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var evaluate EvaluateArguments
+	if err := decodeArguments(arguments, &evaluate); err != nil {
+		return nil, err
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	id := 0
+	if evaluate.FrameID != nil {
+		id = *evaluate.FrameID
+	}
+	frame, err := server.frame(id)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := parser.New(lexer.New(evaluate.Expression))
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	value, err := evaluator.Eval(program, frame.Env)
+	if err != nil {
+		return nil, err
+	}
+	variable := server.variable("", value)
+	return EvaluateResponse{Result: variable.Value, Type: variable.Type, VariablesReference: variable.VariablesReference}, nil
+}
@@ -0,0 +1,365 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"danielmcm.com/interpreterbook/transport"
+)
+
+const program = `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let x = add(1, 2);
+puts(x);
+let list = [x, "four", {"five": 5}];
+puts(add(x, 3));`
+
+// testClient talks to a server running in another goroutine over pipes.
+// Messages are read in the background, as events may be sent at any time.
+type testClient struct {
+	t        *testing.T
+	writer   *io.PipeWriter
+	messages chan message
+	seq      int
+	// events received while waiting for responses
+	events []message
+	// output from output events received so far
+	output strings.Builder
+	done   chan error
+}
+
+func newTestClient(t *testing.T) *testClient {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	client := &testClient{t: t, writer: clientOut, messages: make(chan message, 100), done: make(chan error, 1)}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		client.done <- err
+	}()
+	go func() {
+		reader := bufio.NewReader(clientIn)
+		defer close(client.messages)
+		for {
+			content, err := transport.ReadMessage(reader)
+			if err != nil {
+				return
+			}
+			var received message
+			if err := json.Unmarshal(content, &received); err != nil {
+				t.Errorf("invalid message %s: %v", content, err)
+				return
+			}
+			client.messages <- received
+		}
+	}()
+	// the program may still be running, so wait for it to finish
+	t.Cleanup(func() {
+		clientOut.Close()
+		<-finished
+	})
+	return client
+}
+
+func (client *testClient) read() message {
+	client.t.Helper()
+	select {
+	case received, ok := <-client.messages:
+		if !ok {
+			client.t.Fatal("server closed the connection")
+		}
+		if received.Event == "output" {
+			var body OutputEvent
+			json.Unmarshal(received.Body, &body)
+			client.output.WriteString(body.Output)
+		}
+		return received
+	case <-time.After(5 * time.Second):
+		client.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// call sends a request and decodes its body, failing the test if it is
+// unsuccessful.
+func (client *testClient) call(command string, arguments interface{}, body interface{}) {
+	client.t.Helper()
+	if err := client.request(command, arguments, body); err != nil {
+		client.t.Fatalf("%s: unexpected error %v", command, err)
+	}
+}
+
+func (client *testClient) request(command string, arguments interface{}, body interface{}) error {
+	client.t.Helper()
+	client.seq++
+	seq := client.seq
+	if err := transport.WriteMessage(client.writer, request{Seq: seq, Type: "request", Command: command, Arguments: arguments}); err != nil {
+		client.t.Fatalf("%s: writing request: %v", command, err)
+	}
+	for {
+		received := client.read()
+		if received.Type == "event" {
+			client.events = append(client.events, received)
+			continue
+		}
+		if received.RequestSeq != seq || received.Command != command {
+			client.t.Fatalf("%s: unexpected response %+v", command, received)
+		}
+		if !received.Success {
+			return errors.New(received.Message)
+		}
+		if body != nil {
+			if err := json.Unmarshal(received.Body, body); err != nil {
+				client.t.Fatalf("%s: decoding body %s: %v", command, received.Body, err)
+			}
+		}
+		return nil
+	}
+}
+
+// event waits for an event, discarding any others before it, and decodes
+// its body.
+func (client *testClient) event(name string, body interface{}) {
+	client.t.Helper()
+	for {
+		var received message
+		if len(client.events) > 0 {
+			received, client.events = client.events[0], client.events[1:]
+		} else {
+			received = client.read()
+		}
+		if received.Type != "event" {
+			client.t.Fatalf("expected %s event, got %+v", name, received)
+		}
+		if received.Event != name {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(received.Body, body); err != nil {
+				client.t.Fatalf("%s: decoding body %s: %v", name, received.Body, err)
+			}
+		}
+		return
+	}
+}
+
+func writeProgram(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "program.mk")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// start initializes the server and launches a program with breakpoints.
+func (client *testClient) start(launch LaunchArguments, breakpoints ...int) []Breakpoint {
+	client.t.Helper()
+	client.call("initialize", map[string]string{"adapterID": "monkey"}, nil)
+	client.event("initialized", nil)
+	client.call("launch", launch, nil)
+	arguments := SetBreakpointsArguments{Source: Source{Path: launch.Program}}
+	for _, line := range breakpoints {
+		arguments.Breakpoints = append(arguments.Breakpoints, SourceBreakpoint{Line: line})
+	}
+	var result SetBreakpointsResponse
+	client.call("setBreakpoints", arguments, &result)
+	client.call("configurationDone", nil, nil)
+	return result.Breakpoints
+}
+
+// stopped waits for the program to stop and returns the reason and the
+// frames as name:line.
+func (client *testClient) stopped() (string, []string) {
+	client.t.Helper()
+	var stopped StoppedEvent
+	client.event("stopped", &stopped)
+	var trace StackTraceResponse
+	client.call("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	frames := make([]string, len(trace.StackFrames))
+	for i, frame := range trace.StackFrames {
+		frames[i] = frame.Name + ":" + strconv.Itoa(frame.Line)
+	}
+	return stopped.Reason, frames
+}
+
+func (client *testClient) variables(reference int) map[string]Variable {
+	client.t.Helper()
+	var result VariablesResponse
+	client.call("variables", VariablesArguments{VariablesReference: reference}, &result)
+	variables := make(map[string]Variable)
+	for _, variable := range result.Variables {
+		variables[variable.Name] = variable
+	}
+	return variables
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	client := newTestClient(t)
+	path := writeProgram(t, program)
+	breakpoints := client.start(LaunchArguments{Program: path}, 2, 4, 8)
+	if len(breakpoints) != 3 || !breakpoints[0].Verified || breakpoints[1].Verified || !breakpoints[2].Verified {
+		t.Errorf("expected breakpoints on lines 2 and 8 to be verified, got %+v", breakpoints)
+	}
+
+	steps := []struct {
+		command string
+		reason  string
+		frames  string
+	}{
+		{"", "breakpoint", "add:2 main:5"},
+		{"next", "step", "add:3 main:5"},
+		{"stepOut", "step", "main:6"},
+		{"next", "step", "main:7"},
+		{"continue", "breakpoint", "main:8"},
+		{"stepIn", "step", "add:2 main:8"},
+	}
+	for i, step := range steps {
+		if step.command != "" {
+			client.call(step.command, map[string]int{"threadId": threadID}, nil)
+		}
+		reason, frames := client.stopped()
+		if reason != step.reason || strings.Join(frames, " ") != step.frames {
+			t.Errorf("step %d: expected %s at %s, got %s at %s", i, step.reason, step.frames, reason, strings.Join(frames, " "))
+		}
+	}
+
+	client.call("continue", map[string]int{"threadId": threadID}, nil)
+	var exited ExitedEvent
+	client.event("exited", &exited)
+	client.event("terminated", nil)
+	if exited.ExitCode != 0 {
+		t.Errorf("expected exit code 0, got %d", exited.ExitCode)
+	}
+	if output := client.output.String(); output != "3\n6\n" {
+		t.Errorf("expected output 3 and 6, got %q", output)
+	}
+	client.call("disconnect", nil, nil)
+	if err := <-client.done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	client := newTestClient(t)
+	client.start(LaunchArguments{Program: writeProgram(t, program)}, 2, 8)
+	client.stopped()
+
+	var scopes ScopesResponse
+	client.call("scopes", ScopesArguments{FrameID: 0}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("expected locals and globals, got %+v", scopes.Scopes)
+	}
+	locals := client.variables(scopes.Scopes[0].VariablesReference)
+	if len(locals) != 2 || locals["a"].Value != "1" || locals["b"].Value != "2" || locals["a"].Type != "INTEGER" {
+		t.Errorf("expected a and b, got %+v", locals)
+	}
+
+	var evaluated EvaluateResponse
+	client.call("evaluate", EvaluateArguments{Expression: "add(a, b) * 2"}, &evaluated)
+	if evaluated.Result != "6" {
+		t.Errorf("expected 6, got %s", evaluated.Result)
+	}
+	if err := client.request("evaluate", EvaluateArguments{Expression: "missing"}, nil); err == nil {
+		t.Errorf("expected an error evaluating an undefined name")
+	}
+	frame := 1
+	client.call("evaluate", EvaluateArguments{Expression: "add", FrameID: &frame}, &evaluated)
+	if evaluated.Type != "FUNCTION" {
+		t.Errorf("expected a function, got %+v", evaluated)
+	}
+
+	client.call("continue", map[string]int{"threadId": threadID}, nil)
+	client.stopped()
+	client.call("scopes", ScopesArguments{FrameID: 0}, &scopes)
+	globals := client.variables(scopes.Scopes[0].VariablesReference)
+	list := globals["list"]
+	if list.VariablesReference == 0 {
+		t.Fatalf("expected an expandable list, got %+v", list)
+	}
+	elements := client.variables(list.VariablesReference)
+	if elements["[1]"].Value != `"four"` || elements["[2]"].VariablesReference == 0 {
+		t.Fatalf("expected list elements, got %+v", elements)
+	}
+	hash := client.variables(elements["[2]"].VariablesReference)
+	if hash[`"five"`].Value != "5" {
+		t.Errorf("expected hash entries, got %+v", hash)
+	}
+
+	client.call("disconnect", nil, nil)
+	if err := <-client.done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestPauseAndTerminate(t *testing.T) {
+	client := newTestClient(t)
+	path := writeProgram(t, `let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } };
+loop(100000000)`)
+	client.start(LaunchArguments{Program: path})
+	client.call("pause", map[string]int{"threadId": threadID}, nil)
+	reason, _ := client.stopped()
+	if reason != "pause" {
+		t.Errorf("expected pause, got %s", reason)
+	}
+	client.call("terminate", nil, nil)
+	var exited ExitedEvent
+	client.event("exited", &exited)
+	client.event("terminated", nil)
+
+	// stepping is refused once the program has finished
+	if err := client.request("next", map[string]int{"threadId": threadID}, nil); err == nil {
+		t.Errorf("expected an error stepping a finished program")
+	}
+}
+
+func TestStopOnEntryAndErrors(t *testing.T) {
+	client := newTestClient(t)
+	client.start(LaunchArguments{Program: writeProgram(t, "let x = 1;\nx + true"), StopOnEntry: true})
+	if reason, frames := client.stopped(); reason != "entry" || strings.Join(frames, " ") != "main:1" {
+		t.Errorf("expected entry stop at main:1, got %s at %v", reason, frames)
+	}
+	client.call("continue", map[string]int{"threadId": threadID}, nil)
+	var exited ExitedEvent
+	client.event("exited", &exited)
+	if exited.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", exited.ExitCode)
+	}
+	if output := client.output.String(); !strings.HasPrefix(output, "Error: ") {
+		t.Errorf("expected the error on stderr, got %q", output)
+	}
+
+	client = newTestClient(t)
+	client.call("initialize", nil, nil)
+	err := client.request("launch", LaunchArguments{Program: writeProgram(t, "let = 1")}, nil)
+	if err == nil || !strings.Contains(err.Error(), "program.mk:1:5:") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestCloseWhileStopped(t *testing.T) {
+	client := newTestClient(t)
+	client.start(LaunchArguments{Program: writeProgram(t, program)}, 5)
+	client.stopped()
+	client.writer.Close()
+	select {
+	case err := <-client.done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not finish after the input was closed")
+	}
+}
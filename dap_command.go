@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"danielmcm.com/interpreterbook/dap"
+)
+
+// runDAP implements `monkey dap`, serving the Debug Adapter Protocol over
+// standard input and output.
+func runDAP(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey dap")
+		return 2
+	}
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
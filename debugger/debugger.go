@@ -0,0 +1,222 @@
+package debugger
+
+import (
+	"errors"
+	"sync"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+)
+
+// ErrTerminated is returned by Eval when the debugger stops a program.
+var ErrTerminated = errors.New("terminated by debugger")
+
+// Action tells the debugger how to continue after a stop.
+type Action int
+
+const (
+	// Continue runs until a breakpoint or pause.
+	Continue Action = iota
+	// StepIn stops at the next statement, including in a called function.
+	StepIn
+	// StepOver stops at the next statement in the current function or its
+	// callers.
+	StepOver
+	// StepOut stops at the next statement in a caller of the current
+	// function.
+	StepOut
+	// Terminate stops the program with ErrTerminated.
+	Terminate
+)
+
+// Reason is why execution stopped.
+type Reason string
+
+const (
+	Entry      Reason = "entry"
+	Breakpoint Reason = "breakpoint"
+	Step       Reason = "step"
+	Pause      Reason = "pause"
+)
+
+// Frame is a function call being evaluated, or the top level of the
+// program.
+type Frame struct {
+	// Name is how the function was called, or "main" for the top level
+	Name string
+	// Function and Call are nil for the top level
+	Function *object.Function
+	Call     *ast.CallExpression
+	// Env is the environment of the statement being evaluated
+	Env *object.Environment
+	// Statement is the statement being evaluated
+	Statement ast.Statement
+}
+
+// Stop describes where execution stopped.
+type Stop struct {
+	Reason Reason
+	// Frames holds the call stack, innermost first
+	Frames []Frame
+}
+
+// Debugger controls the evaluation of a program through evaluator hooks,
+// stopping before statements at breakpoints, after steps and on request.
+//
+// Breakpoints, Pause and Terminate may be used from any goroutine. The
+// hooks and OnStop run on the goroutine evaluating the program.
+type Debugger struct {
+	// OnStop is called when execution stops, and evaluation continues as
+	// the returned action says. Code evaluated while stopped, such as
+	// watch expressions, is not debugged.
+	OnStop func(stop Stop) Action
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+	pause       bool
+	terminate   bool
+
+	// state of the evaluation
+	stopOnEntry bool
+	started     bool
+	frames      []Frame
+	action      Action
+	actionDepth int
+	lastLine    int
+	lastDepth   int
+	stopped     bool
+}
+
+// New creates a debugger, which stops at the first statement if
+// stopOnEntry is set.
+func New(stopOnEntry bool) *Debugger {
+	return &Debugger{
+		breakpoints: make(map[int]bool),
+		stopOnEntry: stopOnEntry,
+		frames:      []Frame{{Name: "main"}},
+		action:      Continue,
+	}
+}
+
+// Hooks returns the evaluator hooks that drive the debugger. They should be
+// set on the environment the program is evaluated in.
+func (d *Debugger) Hooks() *object.Hooks {
+	return &object.Hooks{Statement: d.statement, Call: d.call}
+}
+
+// SetBreakpoints replaces the lines on which to stop.
+func (d *Debugger) SetBreakpoints(lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool)
+	for _, line := range lines {
+		d.breakpoints[line] = true
+	}
+}
+
+// Pause stops the program at the next statement.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+// Terminate stops the program with ErrTerminated at the next statement.
+// A stopped program is terminated by returning the Terminate action.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.terminate = true
+}
+
+func (d *Debugger) statement(statement ast.Statement, env *object.Environment) error {
+	if d.stopped {
+		return nil
+	}
+	depth := len(d.frames) - 1
+	frame := &d.frames[depth]
+	frame.Env = env
+	frame.Statement = statement
+
+	// several statements on a line only stop once, unless entering or
+	// leaving a function
+	line := ast.StatementPosition(statement).Line
+	moved := line != d.lastLine || depth != d.lastDepth
+	d.lastLine, d.lastDepth = line, depth
+
+	d.mu.Lock()
+	terminate, pause, breakpoint := d.terminate, d.pause, d.breakpoints[line]
+	d.pause = false
+	d.mu.Unlock()
+	if terminate {
+		return ErrTerminated
+	}
+
+	entry := d.stopOnEntry && !d.started
+	d.started = true
+
+	var reason Reason
+	switch {
+	case pause:
+		reason = Pause
+	case entry:
+		reason = Entry
+	case moved && d.stepped(depth):
+		reason = Step
+	case moved && breakpoint:
+		reason = Breakpoint
+	default:
+		return nil
+	}
+	return d.stop(reason, depth)
+}
+
+// stepped reports whether the current step ends at a statement at depth.
+func (d *Debugger) stepped(depth int) bool {
+	switch d.action {
+	case StepIn:
+		return true
+	case StepOver:
+		return depth <= d.actionDepth
+	case StepOut:
+		return depth < d.actionDepth
+	default:
+		return false
+	}
+}
+
+func (d *Debugger) stop(reason Reason, depth int) error {
+	d.stopped = true
+	action := d.OnStop(Stop{Reason: reason, Frames: d.Stack()})
+	d.stopped = false
+	if action == Terminate {
+		return ErrTerminated
+	}
+	d.action = action
+	d.actionDepth = depth
+	return nil
+}
+
+func (d *Debugger) call(call *ast.CallExpression, function object.Object, args []object.Object) func() {
+	fn, ok := function.(*object.Function)
+	if !ok || d.stopped {
+		return func() {}
+	}
+	d.frames = append(d.frames, Frame{Name: call.Function.String(), Function: fn, Call: call})
+	// a tail call replaces the frame of the call making it, so the body
+	// may be entered again at the same depth and line
+	d.lastLine = 0
+	return func() {
+		d.frames = d.frames[:len(d.frames)-1]
+	}
+}
+
+// Stack returns the call stack, innermost first. It should only be called
+// while stopped, or from OnStop.
+func (d *Debugger) Stack() []Frame {
+	frames := make([]Frame, len(d.frames))
+	for i, frame := range d.frames {
+		frames[len(frames)-1-i] = frame
+	}
+	return frames
+}
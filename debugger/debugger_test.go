@@ -0,0 +1,187 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+const program = `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let x = add(1, 2);
+let y = add(x, 3);
+x + y`
+
+// run debugs program, taking the given actions at each stop and returning
+// a description of each stop: its reason, and the name and line of each
+// frame.
+func run(t *testing.T, debugger *Debugger, actions ...Action) ([]string, object.Object, error) {
+	t.Helper()
+	return runSource(t, program, debugger, actions...)
+}
+
+// runSource is run for the given source.
+func runSource(t *testing.T, input string, debugger *Debugger, actions ...Action) ([]string, object.Object, error) {
+	t.Helper()
+	stops := make([]string, 0)
+	debugger.OnStop = func(stop Stop) Action {
+		frames := make([]string, len(stop.Frames))
+		for i, frame := range stop.Frames {
+			frames[i] = fmt.Sprintf("%s:%d", frame.Name, ast.StatementPosition(frame.Statement).Line)
+		}
+		stops = append(stops, fmt.Sprintf("%s %s", stop.Reason, strings.Join(frames, " ")))
+		if len(actions) == 0 {
+			t.Fatalf("unexpected stop %s", stops[len(stops)-1])
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+	env := object.NewEnvironment()
+	env.SetHooks(debugger.Hooks())
+	result, err := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	if len(actions) > 0 {
+		t.Errorf("%d actions not taken", len(actions))
+	}
+	return stops, result, err
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopOnEntry bool
+		breakpoints []int
+		actions     []Action
+		expected    []string
+	}{
+		{"run", false, nil, nil, []string{}},
+		{
+			"step over",
+			true, nil,
+			[]Action{StepOver, StepOver, StepOver, StepOver},
+			[]string{"entry main:1", "step main:5", "step main:6", "step main:7"},
+		},
+		{
+			"step in and out",
+			true, nil,
+			[]Action{StepOver, StepIn, StepOver, StepOut, StepIn, StepIn, StepIn, Continue},
+			[]string{
+				"entry main:1",
+				"step main:5",
+				"step add:2 main:5",
+				"step add:3 main:5",
+				"step main:6",
+				"step add:2 main:6",
+				"step add:3 main:6",
+				"step main:7",
+			},
+		},
+		{
+			"breakpoints",
+			false, []int{2, 7},
+			[]Action{StepOver, Continue, Continue, Continue},
+			[]string{"breakpoint add:2 main:5", "step add:3 main:5", "breakpoint add:2 main:6", "breakpoint main:7"},
+		},
+	}
+
+	for _, tt := range tests {
+		debugger := New(tt.stopOnEntry)
+		debugger.SetBreakpoints(tt.breakpoints)
+		stops, result, err := run(t, debugger, tt.actions...)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if result.Inspect() != "9" {
+			t.Errorf("%s: expected result 9, got %s", tt.name, result.Inspect())
+		}
+		if strings.Join(stops, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong stops.\nexpected=%q\ngot=%q", tt.name, tt.expected, stops)
+		}
+	}
+}
+
+func TestTailCallBreakpoint(t *testing.T) {
+	// each iteration of the loop is a tail call, re-entering the body at
+	// the same depth and line
+	input := "let loop = fn(n) { if (n > 0) { loop(n - 1) } else { n } };\nloop(2)"
+	debugger := New(false)
+	debugger.SetBreakpoints([]int{1})
+	stops, _, err := runSource(t, input, debugger, Continue, Continue, Continue, Continue)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{
+		"breakpoint main:1",
+		"breakpoint loop:1 main:2",
+		"breakpoint loop:1 main:2",
+		"breakpoint loop:1 main:2",
+	}
+	if strings.Join(stops, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong stops.\nexpected=%q\ngot=%q", expected, stops)
+	}
+}
+
+func TestStoppedEnvironment(t *testing.T) {
+	debugger := New(false)
+	debugger.SetBreakpoints([]int{3})
+	var values []string
+	debugger.OnStop = func(stop Stop) Action {
+		// evaluating while stopped must not re-enter the debugger
+		watch := parser.New(lexer.New("add(sum, a)")).ParseProgram()
+		value, err := evaluator.Eval(watch, stop.Frames[0].Env)
+		if err != nil {
+			t.Fatalf("evaluating watch expression: %v", err)
+		}
+		values = append(values, value.Inspect())
+		if len(stop.Frames[0].Env.Names()) != 3 {
+			t.Errorf("expected a, b and sum in local scope, got %v", stop.Frames[0].Env.Names())
+		}
+		return Continue
+	}
+	env := object.NewEnvironment()
+	env.SetHooks(debugger.Hooks())
+	if _, err := evaluator.Eval(parser.New(lexer.New(program)).ParseProgram(), env); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Join(values, " ") != "4 9" {
+		t.Errorf("expected watch values 4 and 9, got %v", values)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	debugger := New(true)
+	stops, _, err := run(t, debugger, StepOver, Terminate)
+	if err != ErrTerminated {
+		t.Errorf("expected ErrTerminated, got %v", err)
+	}
+	if len(stops) != 2 {
+		t.Errorf("expected 2 stops, got %v", stops)
+	}
+
+	debugger = New(false)
+	debugger.Terminate()
+	if _, _, err := run(t, debugger); err != ErrTerminated {
+		t.Errorf("expected ErrTerminated, got %v", err)
+	}
+}
+
+func TestPause(t *testing.T) {
+	debugger := New(false)
+	debugger.Pause()
+	stops, _, err := run(t, debugger, Continue)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(stops) != 1 || stops[0] != "pause main:1" {
+		t.Errorf("expected pause at first statement, got %v", stops)
+	}
+}
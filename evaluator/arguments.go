@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+)
+
+// namedArgument is the value of a name: value argument.
+type namedArgument struct {
+	name  string
+	value object.Object
+}
+
+// evalArguments evaluates the arguments of a call, expanding spread arrays
+// into the positional arguments and returning named arguments separately.
+func evalArguments(arguments []ast.Expression, env *object.Environment) ([]object.Object, []namedArgument, error) {
+	args := make([]object.Object, 0, len(arguments))
+	var named []namedArgument
+	for _, argument := range arguments {
+		switch argument := argument.(type) {
+		case *ast.SpreadExpression:
+			value, err := Eval(argument.Value, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			array, ok := value.(*object.Array)
+			if !ok {
+				return nil, nil, fmt.Errorf("spread argument must be an array, got %s", value.Type())
+			}
+			args = append(args, array.Elements...)
+		case *ast.NamedArgument:
+			value, err := Eval(argument.Value, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			named = append(named, namedArgument{name: argument.Name.Value, value: value})
+		default:
+			value, err := Eval(argument, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, value)
+		}
+	}
+	return args, named, nil
+}
+
+// bindArguments binds the parameters of a function in fnEnv. Positional
+// arguments fill the parameters in order, with any left over collected by
+// the rest parameter, and named arguments fill the parameters with their
+// names. Parameters given no argument take their defaults, evaluated in
+// fnEnv so that they can refer to the parameters before them.
+func bindArguments(fn *object.Function, args []object.Object, named []namedArgument, fnEnv *object.Environment) error {
+	count := len(args) + len(named)
+	if len(args) > len(fn.Parameters) && fn.Rest == nil {
+		return fmt.Errorf("function with %d parameters called with %d arguments", len(fn.Parameters), count)
+	}
+	values := make([]object.Object, len(fn.Parameters))
+	copy(values, args)
+	for _, argument := range named {
+		index := parameterIndex(fn, argument.name)
+		if index < 0 {
+			return fmt.Errorf("function has no parameter named %s", argument.name)
+		}
+		if values[index] != nil {
+			return fmt.Errorf("argument %s given by position and by name", argument.name)
+		}
+		values[index] = argument.value
+	}
+
+	for i, param := range fn.Parameters {
+		value := values[i]
+		if value == nil {
+			if param.Default == nil {
+				return fmt.Errorf("function with %d parameters called with %d arguments: missing %s", len(fn.Parameters), count, param)
+			}
+			var err error
+			if value, err = Eval(param.Default, fnEnv); err != nil {
+				return err
+			}
+		}
+		if param.Pattern == nil {
+			bind(param.Name, value, fnEnv)
+		} else if err := destructure(param.Pattern, value, fnEnv); err != nil {
+			return fmt.Errorf("argument %d: %w", i+1, err)
+		}
+	}
+	if fn.Rest != nil {
+		rest := make([]object.Object, 0)
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		bind(fn.Rest, &object.Array{Elements: rest}, fnEnv)
+	}
+	return nil
+}
+
+// parameterIndex returns the index of the parameter with the given name, or
+// -1 if there is none. Parameters destructured by a pattern have no name.
+func parameterIndex(fn *object.Function, name string) int {
+	for i, param := range fn.Parameters {
+		if param.Name != nil && param.Name.Value == name {
+			return i
+		}
+	}
+	return -1
+}
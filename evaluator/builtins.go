@@ -2,42 +2,87 @@ package evaluator
 
 import (
 	"fmt"
+	"sort"
+	"unicode/utf8"
 
 	"danielmcm.com/interpreterbook/object"
 )
 
-func checkArgCount(name string, args []object.Object, expected int) error {
-	if len(args) != expected {
-		return fmt.Errorf("`%s` received wrong number of arguments. expected %d, got %d", name, expected, len(args))
+// checkArgCount wraps a builtin function to check it receives the number
+// of arguments given by its arity.
+func checkArgCount(name string, expected int, fn object.BuiltinFunction) object.BuiltinFunction {
+	return func(env *object.Environment, args ...object.Object) (object.Object, error) {
+		if len(args) != expected {
+			return nil, fmt.Errorf("`%s` received wrong number of arguments. expected %d, got %d", name, expected, len(args))
+		}
+		return fn(env, args...)
 	}
-	return nil
 }
 
 func argTypeError(name string, arg object.Object) error {
 	return fmt.Errorf("`%s` argument of type %s not supported", name, arg.Type())
 }
 
+func hashArg(name string, arg object.Object) (*object.Hash, error) {
+	hash, ok := arg.(*object.Hash)
+	if !ok {
+		return nil, argTypeError(name, arg)
+	}
+	return hash, nil
+}
+
+func checkHashable(name string, arg object.Object) error {
+	if !object.IsHashable(arg) {
+		return fmt.Errorf("`%s` hash key of type %s is not hashable", name, arg.Type())
+	}
+	return nil
+}
+
+// LookupBuiltin returns the builtin function with the given name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// BuiltinNames returns the names of every builtin function, sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	for name, builtin := range builtins {
+		if builtin.Arity != object.Variadic {
+			builtin.Fn = checkArgCount(name, builtin.Arity, builtin.Fn)
+		}
+	}
+}
+
 var builtins = map[string]*object.Builtin{
 	"len": {
-		Fn: func(args ...object.Object) (object.Object, error) {
-			if err := checkArgCount("len", args, 1); err != nil {
-				return nil, err
-			}
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}, nil
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}, nil
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}, nil
+			case *object.Hash:
+				return &object.Integer{Value: int64(arg.Len())}, nil
+			case *object.Record:
+				return &object.Integer{Value: int64(len(arg.Names()))}, nil
 			default:
 				return nil, argTypeError("len", args[0])
 			}
 		},
 	},
 	"first": {
-		Fn: func(args ...object.Object) (object.Object, error) {
-			if err := checkArgCount("first", args, 1); err != nil {
-				return nil, err
-			}
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			arr, ok := args[0].(*object.Array)
 			if !ok {
 				return nil, argTypeError("first", args[0])
@@ -50,10 +95,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": {
-		Fn: func(args ...object.Object) (object.Object, error) {
-			if err := checkArgCount("last", args, 1); err != nil {
-				return nil, err
-			}
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			arr, ok := args[0].(*object.Array)
 			if !ok {
 				return nil, argTypeError("last", args[0])
@@ -66,10 +109,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": {
-		Fn: func(args ...object.Object) (object.Object, error) {
-			if err := checkArgCount("rest", args, 1); err != nil {
-				return nil, err
-			}
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			arr, ok := args[0].(*object.Array)
 			if !ok {
 				return nil, argTypeError("rest", args[0])
@@ -84,10 +125,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": {
-		Fn: func(args ...object.Object) (object.Object, error) {
-			if err := checkArgCount("push", args, 2); err != nil {
-				return nil, err
-			}
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			arr, ok := args[0].(*object.Array)
 			if !ok {
 				return nil, argTypeError("push", args[0])
@@ -101,9 +140,10 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"puts": {
-		Fn: func(args ...object.Object) (object.Object, error) {
+		Arity: object.Variadic,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
 			for _, arg := range args {
-				_, err := fmt.Println(arg.Inspect())
+				_, err := fmt.Fprintln(env.Output(), arg.Inspect())
 				if err != nil {
 					return nil, err
 				}
@@ -111,4 +151,170 @@ var builtins = map[string]*object.Builtin{
 			return NULL, nil
 		},
 	},
+	"str": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			if str, ok := args[0].(*object.String); ok {
+				return str, nil
+			}
+			return &object.String{Value: args[0].Inspect()}, nil
+		},
+	},
+	"chars": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return nil, argTypeError("chars", args[0])
+			}
+			elements := make([]object.Object, 0, len(str.Value))
+			for _, char := range str.Value {
+				elements = append(elements, &object.String{Value: string(char)})
+			}
+			return &object.Array{Elements: elements}, nil
+		},
+	},
+	"bytes": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return nil, argTypeError("bytes", args[0])
+			}
+			elements := make([]object.Object, len(str.Value))
+			for i := 0; i < len(str.Value); i++ {
+				elements[i] = &object.Integer{Value: int64(str.Value[i])}
+			}
+			return &object.Array{Elements: elements}, nil
+		},
+	},
+	"keys": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("keys", args[0])
+			if err != nil {
+				return nil, err
+			}
+			elements := make([]object.Object, 0, hash.Len())
+			for _, pair := range hash.Pairs() {
+				elements = append(elements, pair.Key)
+			}
+			return &object.Array{Elements: elements}, nil
+		},
+	},
+	"values": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("values", args[0])
+			if err != nil {
+				return nil, err
+			}
+			elements := make([]object.Object, 0, hash.Len())
+			for _, pair := range hash.Pairs() {
+				elements = append(elements, pair.Value)
+			}
+			return &object.Array{Elements: elements}, nil
+		},
+	},
+	"entries": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("entries", args[0])
+			if err != nil {
+				return nil, err
+			}
+			elements := make([]object.Object, 0, hash.Len())
+			for _, pair := range hash.Pairs() {
+				entry := &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+				elements = append(elements, entry)
+			}
+			return &object.Array{Elements: elements}, nil
+		},
+	},
+	"has": {
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("has", args[0])
+			if err != nil {
+				return nil, err
+			}
+			key := args[1]
+			if err := checkHashable("has", key); err != nil {
+				return nil, err
+			}
+			_, ok := hash.Get(key)
+			return boolObjFromNativeBool(ok), nil
+		},
+	},
+	"get": {
+		Arity: 3,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("get", args[0])
+			if err != nil {
+				return nil, err
+			}
+			key := args[1]
+			if err := checkHashable("get", key); err != nil {
+				return nil, err
+			}
+			if val, ok := hash.Get(key); ok {
+				return val, nil
+			}
+			return args[2], nil
+		},
+	},
+	"delete": {
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("delete", args[0])
+			if err != nil {
+				return nil, err
+			}
+			key := args[1]
+			if err := checkHashable("delete", key); err != nil {
+				return nil, err
+			}
+			result := hash.Copy()
+			result.Delete(key)
+			return result, nil
+		},
+	},
+	"merge": {
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			left, err := hashArg("merge", args[0])
+			if err != nil {
+				return nil, err
+			}
+			right, err := hashArg("merge", args[1])
+			if err != nil {
+				return nil, err
+			}
+			result := left.Copy()
+			for _, pair := range right.Pairs() {
+				result.Set(pair.Key, pair.Value)
+			}
+			return result, nil
+		},
+	},
+	"record": {
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) (object.Object, error) {
+			hash, err := hashArg("record", args[0])
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, 0, hash.Len())
+			values := make([]object.Object, 0, hash.Len())
+			for _, pair := range hash.Pairs() {
+				name, ok := pair.Key.(*object.String)
+				if !ok {
+					return nil, fmt.Errorf("`record` field name of type %s is not a string", pair.Key.Type())
+				}
+				names = append(names, name.Value)
+				values = append(values, pair.Value)
+			}
+			return object.NewRecord(names, values), nil
+		},
+	},
 }
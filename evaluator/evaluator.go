@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"bytes"
 	"fmt"
 
 	"danielmcm.com/interpreterbook/ast"
@@ -14,9 +15,14 @@ var (
 )
 
 func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
+	if err := runEnvHooks(node, env); err != nil {
+		return nil, err
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
+		resolve(node)
 		return evalStatementsAndReturn(node.Statements, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
@@ -29,12 +35,16 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}, nil
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}, nil
 	case *ast.BooleanLiteral:
 		return boolObjFromNativeBool(node.Value), nil
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}, nil
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node.Value, env)
+		return evalIdentifier(node, env)
 	case *ast.PrefixExpression:
 		return evalPrefixExpression(node.Operator, node.Right, env)
 	case *ast.InfixExpression:
@@ -43,6 +53,8 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		return evalIfExpression(node, env)
 	case *ast.FunctionLiteral:
 		return evalFunctionLiteral(node, env)
+	case *ast.MacroLiteral:
+		return nil, fmt.Errorf("macro literals must be bound by top-level let statements")
 	case *ast.CallExpression:
 		return evalCallExpression(node, env)
 	case *ast.ArrayExpression:
@@ -51,10 +63,42 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		return evalHashExpression(node, env)
 	case *ast.IndexExpression:
 		return evalIndexExpression(node, env)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+	case *ast.SpreadExpression:
+		return nil, fmt.Errorf("spread arguments are only allowed in calls")
+	case *ast.NamedArgument:
+		return nil, fmt.Errorf("named arguments are only allowed in calls")
 	}
 	return nil, fmt.Errorf(`can't eval node type %T (%s)`, node, node.String())
 }
 
+// runEnvHooks runs the hooks set on env, if any, before evaluating a node.
+func runEnvHooks(node ast.Node, env *object.Environment) error {
+	if hooks := env.Hooks(); hooks != nil {
+		return runHooks(hooks, node, env)
+	}
+	return nil
+}
+
+func runHooks(hooks *object.Hooks, node ast.Node, env *object.Environment) error {
+	switch node := node.(type) {
+	case *ast.Program, *ast.BlockStatement:
+		return nil
+	case ast.Statement:
+		if hooks.Statement != nil {
+			return hooks.Statement(node, env)
+		}
+	case ast.Expression:
+		if hooks.Expression != nil {
+			return hooks.Expression(node, env)
+		}
+	}
+	return nil
+}
+
 func evalStatementsAndReturn(statements []ast.Statement, env *object.Environment) (object.Object, error) {
 	result, err := evalStatements(statements, env)
 	if err != nil {
@@ -95,7 +139,13 @@ func evalLetStatement(statement *ast.LetStatement, env *object.Environment) (obj
 	if err != nil {
 		return nil, err
 	}
-	env.Set(statement.Name.Value, val)
+	if statement.Pattern != nil {
+		if err := destructure(statement.Pattern, val, env); err != nil {
+			return nil, err
+		}
+		return NULL, nil
+	}
+	bind(statement.Name, val, env)
 	return NULL, nil
 }
 
@@ -107,14 +157,43 @@ func boolObjFromNativeBool(value bool) *object.Boolean {
 	}
 }
 
-func evalIdentifier(ident string, env *object.Environment) (object.Object, error) {
-	if val, ok := env.Get(ident); ok {
+func evalInterpolatedString(expr *ast.InterpolatedString, env *object.Environment) (object.Object, error) {
+	var out bytes.Buffer
+	for _, part := range expr.Parts {
+		val, err := Eval(part, env)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(val.Inspect())
+	}
+	return &object.String{Value: out.String()}, nil
+}
+
+// evalIdentifier looks up a resolved identifier in its slot, and others by
+// name. A slot that has not been bound yet falls back to the lookup by name,
+// as a binding later in a scope does not hide one outside it until it is
+// made.
+func evalIdentifier(ident *ast.Identifier, env *object.Environment) (object.Object, error) {
+	if ident.Resolved {
+		if val, ok := env.GetSlot(ident.Depth, ident.Slot); ok {
+			return val, nil
+		}
+	}
+	if val, ok := env.Get(ident.Value); ok {
 		return val, nil
 	}
-	if val, ok := builtins[ident]; ok {
+	if val, ok := builtins[ident.Value]; ok {
 		return val, nil
 	}
-	return nil, fmt.Errorf("identifier not found: %s", ident)
+	return nil, fmt.Errorf("identifier not found: %s", ident.Value)
+}
+
+// bind binds the name declared by an identifier in env, in its slot if it
+// has been resolved.
+func bind(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	if !ident.Resolved || !env.SetSlot(ident.Slot, val) {
+		env.Set(ident.Value, val)
+	}
 }
 
 func evalPrefixExpression(operator string, right ast.Expression, env *object.Environment) (object.Object, error) {
@@ -141,7 +220,7 @@ func isTruthy(cond object.Object) bool {
 	switch cond := cond.(type) {
 	case *object.Boolean:
 		return cond.Value
-	case *object.Integer:
+	case *object.Integer, *object.Float:
 		return true
 	case *object.Null:
 		return false
@@ -155,11 +234,14 @@ func evalBangOperatorExpression(operand object.Object) (object.Object, bool) {
 }
 
 func evalMinusPrefixOperatorExpression(operand object.Object) (object.Object, bool) {
-	intObj, ok := operand.(*object.Integer)
-	if !ok {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -operand.Value}, true
+	case *object.Float:
+		return &object.Float{Value: -operand.Value}, true
+	default:
 		return nil, false
 	}
-	return &object.Integer{Value: -intObj.Value}, true
 }
 
 func evalInfixExpression(operator string, left ast.Expression, right ast.Expression, env *object.Environment) (object.Object, error) {
@@ -179,10 +261,17 @@ func evalInfixExpression(operator string, left ast.Expression, right ast.Express
 		if err != nil {
 			return nil, err
 		}
+	} else if isNumber(leftOperand) && isNumber(rightOperand) {
+		result, ok, err = evalFloatInfixExpression(operator, leftOperand, rightOperand)
+		if err != nil {
+			return nil, err
+		}
 	} else if leftOperand.Type() == object.BOOLEAN_OBJ && rightOperand.Type() == object.BOOLEAN_OBJ {
 		result, ok = evalBooleanInfixExpression(operator, leftOperand, rightOperand)
 	} else if leftOperand.Type() == object.STRING_OBJ && rightOperand.Type() == object.STRING_OBJ {
 		result, ok = evalStringInfixExpression(operator, leftOperand, rightOperand)
+	} else if leftOperand.Type() == rightOperand.Type() && (leftOperand.Type() == object.ARRAY_OBJ || leftOperand.Type() == object.HASH_OBJ || leftOperand.Type() == object.RECORD_OBJ) {
+		result, ok = evalEqualityInfixExpression(operator, leftOperand, rightOperand)
 	}
 	if !ok {
 		return nil, fmt.Errorf("operator %s not supported on %s (%s %s) and %s (%s %s)", operator, left.String(), leftOperand.Type(), leftOperand.Inspect(), right.String(), rightOperand.Type(), rightOperand.Inspect())
@@ -221,6 +310,52 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	}
 }
 
+// isNumber reports whether value is an integer or a float.
+func isNumber(value object.Object) bool {
+	switch value.(type) {
+	case *object.Integer, *object.Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// toFloat converts a number to a float, as integers are when combined with a
+// float.
+func toFloat(value object.Object) float64 {
+	if intObj, ok := value.(*object.Integer); ok {
+		return float64(intObj.Value)
+	}
+	return value.(*object.Float).Value
+}
+
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) (object.Object, bool, error) {
+	leftFloat, rightFloat := toFloat(left), toFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftFloat + rightFloat}, true, nil
+	case "-":
+		return &object.Float{Value: leftFloat - rightFloat}, true, nil
+	case "*":
+		return &object.Float{Value: leftFloat * rightFloat}, true, nil
+	case "/":
+		if rightFloat == 0 {
+			return nil, true, fmt.Errorf("cannot divide by 0")
+		}
+		return &object.Float{Value: leftFloat / rightFloat}, true, nil
+	case "<":
+		return boolObjFromNativeBool(leftFloat < rightFloat), true, nil
+	case ">":
+		return boolObjFromNativeBool(leftFloat > rightFloat), true, nil
+	case "==":
+		return boolObjFromNativeBool(leftFloat == rightFloat), true, nil
+	case "!=":
+		return boolObjFromNativeBool(leftFloat != rightFloat), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
 func evalBooleanInfixExpression(operator string, left object.Object, right object.Object) (object.Object, bool) {
 	switch operator {
 	case "==":
@@ -254,11 +389,25 @@ func evalStringInfixExpression(operator string, left object.Object, right object
 	}
 }
 
+func evalEqualityInfixExpression(operator string, left object.Object, right object.Object) (object.Object, bool) {
+	switch operator {
+	case "==":
+		return boolObjFromNativeBool(object.Equal(left, right)), true
+	case "!=":
+		return boolObjFromNativeBool(!object.Equal(left, right)), true
+	default:
+		return nil, false
+	}
+}
+
 func evalIfExpression(expr *ast.IfExpression, env *object.Environment) (object.Object, error) {
 	cond, err := Eval(expr.Condition, env)
 	if err != nil {
 		return nil, err
 	}
+	if hooks := env.Hooks(); hooks != nil && hooks.Branch != nil {
+		hooks.Branch(expr, isTruthy(cond))
+	}
 	if isTruthy(cond) {
 		return Eval(expr.Consequence, env)
 	} else if expr.Alternative != nil {
@@ -270,13 +419,12 @@ func evalIfExpression(expr *ast.IfExpression, env *object.Environment) (object.O
 
 func evalFunctionLiteral(expr *ast.FunctionLiteral, env *object.Environment) (object.Object, error) {
 	obj := &object.Function{
-		Parameters: make([]string, len(expr.Parameters)),
+		Parameters: expr.Parameters,
+		Rest:       expr.Rest,
 		Body:       expr.Body,
+		Slots:      expr.Slots,
 		Env:        env,
 	}
-	for i, param := range expr.Parameters {
-		obj.Parameters[i] = param.Value
-	}
 	return obj, nil
 }
 
@@ -293,29 +441,69 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) ([]o
 }
 
 func evalCallExpression(expr *ast.CallExpression, env *object.Environment) (object.Object, error) {
+	if isCallTo(expr, "quote") {
+		return quote(expr, env)
+	}
 	called, err := Eval(expr.Function, env)
 	if err != nil {
 		return nil, err
 	}
-	// Evaluate arguments
-	args, err := evalExpressions(expr.Arguments, env)
+	args, named, err := evalArguments(expr.Arguments, env)
 	if err != nil {
 		return nil, err
 	}
+	return apply(expr, called, args, named, env)
+}
+
+// Apply calls a function or builtin with evaluated arguments, as if it were
+// called by the call expression in env. Hooks set on env are run, so tools
+// can call Monkey functions as the evaluator does.
+func Apply(call *ast.CallExpression, called object.Object, args []object.Object, env *object.Environment) (object.Object, error) {
+	return apply(call, called, args, nil, env)
+}
+
+// apply is Apply with named arguments, which hooks are not given.
+//
+// Calls in tail position are made in a loop once the calling function has
+// finished, so they do not grow the Go stack. Hooks see each of them as a
+// call made in place of the one before, which has returned by the time it
+// starts.
+func apply(call *ast.CallExpression, called object.Object, args []object.Object, named []namedArgument, env *object.Environment) (object.Object, error) {
+	for {
+		end := func() {}
+		if hooks := env.Hooks(); hooks != nil && hooks.Call != nil {
+			end = hooks.Call(call, called, args)
+		}
+		result, err := applyOnce(call, called, args, named, env)
+		end()
+		if err != nil {
+			return nil, err
+		}
+		next, ok := result.(*tailCall)
+		if !ok {
+			return result, nil
+		}
+		call, called, args, named, env = next.call, next.function, next.args, next.named, next.env
+	}
+}
+
+// applyOnce calls a function, returning a *tailCall if it ends with one.
+// Builtins are given env, the environment of the call.
+func applyOnce(call *ast.CallExpression, called object.Object, args []object.Object, named []namedArgument, env *object.Environment) (object.Object, error) {
 	switch fn := called.(type) {
 	case *object.Function:
-		if len(fn.Parameters) != len(expr.Arguments) {
-			return nil, fmt.Errorf("function with %d parameters called with %d arguments", len(fn.Parameters), len(expr.Arguments))
-		}
-		fnEnv := object.NewEnclosedEnvironment(fn.Env)
-		for i, param := range fn.Parameters {
-			fnEnv.Set(param, args[i])
+		fnEnv := object.NewSlotEnvironment(fn.Env, fn.Slots)
+		if err := bindArguments(fn, args, named, fnEnv); err != nil {
+			return nil, err
 		}
-		return evalStatementsAndReturn(fn.Body.Statements, fnEnv)
+		return evalBody(fn.Body.Statements, fnEnv)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if len(named) > 0 {
+			return nil, fmt.Errorf("builtin %s does not take named arguments", call.Function.String())
+		}
+		return fn.Fn(env, args...)
 	default:
-		return nil, fmt.Errorf("not a function: %s", expr.Function.String())
+		return nil, fmt.Errorf("not a function: %s", call.Function.String())
 	}
 }
 
@@ -331,22 +519,19 @@ func evalArrayExpression(expr *ast.ArrayExpression, env *object.Environment) (ob
 }
 
 func evalHashExpression(expr *ast.HashExpression, env *object.Environment) (object.Object, error) {
-	hash := &object.Hash{}
-	hash.Entries = make(map[object.HashKey]object.Object)
+	hash := object.NewHash()
 	for _, entry := range expr.Entries {
 		key, err := Eval(entry.Key, env)
 		if err != nil {
 			return nil, err
 		}
-		hashKey, ok := object.HashKeyFromObject(key)
-		if !ok {
-			return nil, fmt.Errorf("hash key must be string, integer or boolean: %s", entry.Key.String())
-		}
 		value, err := Eval(entry.Value, env)
 		if err != nil {
 			return nil, err
 		}
-		hash.Entries[hashKey] = value
+		if !hash.Set(key, value) {
+			return nil, fmt.Errorf("hash key of type %s is not hashable: %s", key.Type(), entry.Key.String())
+		}
 	}
 	return hash, nil
 }
@@ -366,22 +551,163 @@ func evalIndexExpression(expr *ast.IndexExpression, env *object.Environment) (ob
 		if !ok {
 			return nil, fmt.Errorf("array index must be an integer: %s", expr.Index.String())
 		}
-		if index.Value < 0 || index.Value >= int64(len(leftObj.Elements)) {
+		i, ok := normaliseIndex(index.Value, len(leftObj.Elements))
+		if !ok {
 			return NULL, nil
 		}
-		return leftObj.Elements[index.Value], nil
-	case *object.Hash:
-		key, ok := object.HashKeyFromObject(indexObj)
+		return leftObj.Elements[i], nil
+	case *object.String:
+		index, ok := indexObj.(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("string index must be an integer: %s", expr.Index.String())
+		}
+		chars := []rune(leftObj.Value)
+		i, ok := normaliseIndex(index.Value, len(chars))
 		if !ok {
-			return nil, fmt.Errorf("hash index must be string, integer or boolean: %s", expr.Index.String())
+			return NULL, nil
 		}
-		val, ok := leftObj.Entries[key]
+		return &object.String{Value: string(chars[i])}, nil
+	case *object.Hash:
+		if !object.IsHashable(indexObj) {
+			return nil, fmt.Errorf("hash index of type %s is not hashable: %s", indexObj.Type(), expr.Index.String())
+		}
+		val, ok := leftObj.Get(indexObj)
 		if ok {
 			return val, nil
 		} else {
 			return NULL, nil
 		}
+	case *object.Record:
+		name, ok := indexObj.(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("record field must be a string: %s", expr.Index.String())
+		}
+		val, ok := leftObj.Field(name.Value)
+		if !ok {
+			return nil, fmt.Errorf("record has no field %s: %s", name.Value, expr.Left.String())
+		}
+		return val, nil
 	default:
-		return nil, fmt.Errorf("not an array or hash: %s", expr.Left.String())
+		return nil, fmt.Errorf("not an array, string, hash or record: %s", expr.Left.String())
+	}
+}
+
+// normaliseIndex resolves a negative index relative to the end of a sequence
+// of the given length, returning false if it is out of range.
+func normaliseIndex(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+func evalSliceExpression(expr *ast.SliceExpression, env *object.Environment) (object.Object, error) {
+	leftObj, err := Eval(expr.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	start, err := evalSliceBound(expr.Start, env)
+	if err != nil {
+		return nil, err
+	}
+	end, err := evalSliceBound(expr.End, env)
+	if err != nil {
+		return nil, err
+	}
+	step, err := evalSliceBound(expr.Step, env)
+	if err != nil {
+		return nil, err
+	}
+	if step != nil && *step == 0 {
+		return nil, fmt.Errorf("slice step cannot be zero: %s", expr.String())
+	}
+
+	switch leftObj := leftObj.(type) {
+	case *object.Array:
+		indices := sliceIndices(len(leftObj.Elements), start, end, step)
+		elements := make([]object.Object, len(indices))
+		for i, index := range indices {
+			elements[i] = leftObj.Elements[index]
+		}
+		return &object.Array{Elements: elements}, nil
+	case *object.String:
+		chars := []rune(leftObj.Value)
+		indices := sliceIndices(len(chars), start, end, step)
+		value := make([]rune, len(indices))
+		for i, index := range indices {
+			value[i] = chars[index]
+		}
+		return &object.String{Value: string(value)}, nil
+	default:
+		return nil, fmt.Errorf("not an array or string: %s", expr.Left.String())
+	}
+}
+
+// evalSliceBound evaluates an optional slice bound, returning nil if it is
+// omitted or null.
+func evalSliceBound(bound ast.Expression, env *object.Environment) (*int64, error) {
+	if bound == nil {
+		return nil, nil
+	}
+	obj, err := Eval(bound, env)
+	if err != nil {
+		return nil, err
+	}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("slice index must be an integer: %s", bound.String())
+	}
+}
+
+// sliceIndices returns the positions selected by a slice of a sequence with
+// the given length, following Python's rules for negative and out of range
+// bounds. The step must not be zero.
+func sliceIndices(length int, start *int64, end *int64, step *int64) []int {
+	var stepValue int64 = 1
+	if step != nil {
+		stepValue = *step
+	}
+	// a step longer than the sequence selects at most the first index, so
+	// it is shortened to keep the indices from overflowing
+	stepValue = max(min(stepValue, int64(length)+1), -int64(length)-1)
+	lower, upper := int64(0), int64(length)
+	if stepValue < 0 {
+		lower, upper = -1, int64(length)-1
+	}
+	clamp := func(bound *int64, fallback int64) int64 {
+		if bound == nil {
+			return fallback
+		}
+		value := *bound
+		if value < 0 {
+			value += int64(length)
+			if value < lower {
+				value = lower
+			}
+		} else if value > upper {
+			value = upper
+		}
+		return value
+	}
+
+	indices := make([]int, 0)
+	if stepValue > 0 {
+		stop := clamp(end, upper)
+		for i := clamp(start, lower); i < stop; i += stepValue {
+			indices = append(indices, int(i))
+		}
+	} else {
+		stop := clamp(end, lower)
+		for i := clamp(start, upper); i > stop; i += stepValue {
+			indices = append(indices, int(i))
+		}
 	}
+	return indices
 }
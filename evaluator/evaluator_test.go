@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"danielmcm.com/interpreterbook/ast"
 	"danielmcm.com/interpreterbook/lexer"
 	"danielmcm.com/interpreterbook/object"
 	"danielmcm.com/interpreterbook/parser"
@@ -39,6 +41,53 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"1.5 + 2.25", 3.75},
+		{"1.5 - 2", -0.5},
+		{"2 * 1.5", 3},
+		{"7 / 2.0", 3.5},
+		{"-(1 + 0.5)", -1.5},
+		{"1.0 / 4", 0.25},
+		{"0.5 * 0.5 * 4", 1},
+		{"1 + 2 * 0.5", 2},
+		{"(1 + 2) * 0.5", 1.5},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testFloatObject(t, result, test.expected)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.0 * 3", "6.0"},
+		{"1.0 / 3", "0.3333333333333333"},
+		{"1e21", "1e+21"},
+		{"-0.5", "-0.5"},
+		{"[1, 2.5]", "[1, 2.5]"},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok && result.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, result.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -64,6 +113,24 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{`"a"!="b"`, true},
 		{`"a"<"b"`, true},
 		{`"a">"b"`, false},
+		{`[1, "a"] == [1, "a"]`, true},
+		{`[1, [2]] == [1, [3]]`, false},
+		{`[1] != [1, 2]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {1: 1}`, true},
+		{"1.5 < 2", true},
+		{"1 < 1.5", true},
+		{"2 > 2.5", false},
+		{"1.5 == 1.5", true},
+		{"3 != 3.0", false},
+		{"2.5 > 3.5", false},
+		{"2.0 == 2", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{`[1, 2.5] == [1.0, 2.5]`, true},
+		{`record({"x": 1, "y": 2}) == record({"y": 2, "x": 1.0})`, true},
+		{`record({"x": 1}) != record({"x": 1, "y": 2})`, true},
+		{"if (0.0) { true } else { false }", true},
 	}
 
 	for _, test := range tests {
@@ -81,6 +148,14 @@ func TestEvalStringExpression(t *testing.T) {
 	}{
 		{`"hello"`, "hello"},
 		{`"hello" + " " + "world"`, "hello world"},
+		{`let name = "Ana"; let count = 2; "Hello ${name}, you have ${count + 1} items"`, "Hello Ana, you have 3 items"},
+		{`"${true} ${[1, "a"]} ${{"k": 1}} ${{}[0]}"`, `true [1, a] {"k": 1} null`},
+		{`let f = fn(x) { x * 2 }; "${f(2)}${f(3)}"`, "46"},
+		{`"outer ${"inner ${1 + 1}"}"`, "outer inner 2"},
+		{`"\${x}"`, "${x}"},
+		{`"n=" + str(1)`, "n=1"},
+		{`str("a")`, "a"},
+		{`str([1, true])`, "[1, true]"},
 	}
 
 	for _, test := range tests {
@@ -91,6 +166,23 @@ func TestEvalStringExpression(t *testing.T) {
 	}
 }
 
+func TestUnicodeIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let café = 5; café", 5},
+		{"let π = 3; let größe = π * 2; größe", 6},
+		{"let 名前 = \"値\"; 名前", "値"},
+	}
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
 func TestEvalArrayExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -225,7 +317,7 @@ func TestFunctionObject(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected function object, got %T (%+v)", fn, fn)
 	}
-	if len(fn.Parameters) != 1 || fn.Parameters[0] != "x" {
+	if len(fn.Parameters) != 1 || fn.Parameters[0].String() != "x" {
 		t.Fatalf("expected 1 parameter x, got %+v", fn.Parameters)
 	}
 	expectedBody := "{ (x + 2); }"
@@ -264,6 +356,78 @@ func TestArrayIndex(t *testing.T) {
 		{"[][0]", nil},
 		{"let a = [1,2,3]; a[10/5]", 3},
 		{"let i = 2/2; [1, [2, 3]][i]", []interface{}{2, 3}},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[1, 2, 3][3]", nil},
+	}
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-3]`, "a"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-4]`, nil},
+		{`""[0]`, nil},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`"a\u{1F600}b"[1]`, "\U0001F600"},
+	}
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
+func TestSliceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []interface{}{2, 3}},
+		{"[1, 2, 3, 4][:2]", []interface{}{1, 2}},
+		{"[1, 2, 3, 4][2:]", []interface{}{3, 4}},
+		{"[1, 2, 3, 4][:]", []interface{}{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []interface{}{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []interface{}{1, 2, 3}},
+		{"[1, 2, 3, 4][-10:10]", []interface{}{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []interface{}{}},
+		{"[1, 2, 3, 4][::2]", []interface{}{1, 3}},
+		{"[1, 2, 3, 4][1::2]", []interface{}{2, 4}},
+		{"[1, 2, 3, 4][::-1]", []interface{}{4, 3, 2, 1}},
+		{"[1, 2, 3, 4][2::-1]", []interface{}{3, 2, 1}},
+		{"[1, 2, 3, 4][:0:-1]", []interface{}{4, 3, 2}},
+		{"[1, 2, 3, 4][-1:-3:-1]", []interface{}{4, 3}},
+		{"[1, 2, 3, 4][10:-10:-3]", []interface{}{4, 1}},
+		{"[1, 2, 3][1::9223372036854775807]", []interface{}{2}},
+		{"[1, 2, 3][::9223372036854775807]", []interface{}{1}},
+		{"[1, 2, 3][1::-9223372036854775807]", []interface{}{2}},
+		{"[1, 2, 3][::-9223372036854775807 - 1]", []interface{}{3}},
+		{"[][::9223372036854775807]", []interface{}{}},
+		{"let n = {}[0]; [1, 2, 3][n:n]", []interface{}{1, 2, 3}},
+		{"let a = [1, 2]; let i = 1; a[i - 1:i + 1]", []interface{}{1, 2}},
+		{`"hello"[1:4]`, "ell"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[::2]`, "hlo"},
+		{`""[:]`, ""},
+		{`"abc"[-1::9223372036854775807]`, "c"},
+		{`"héllo wörld"[1:8]`, "éllo wö"},
+		{`"日本語"[::-1]`, "語本日"},
 	}
 	for _, test := range tests {
 		result, ok := testEval(t, test.input)
@@ -282,6 +446,21 @@ func TestHashIndex(t *testing.T) {
 		{"{}[0]", nil},
 		{"let a = {\"x\": \"y\"}; a[\"x\"]", "y"},
 		{"{false: 9}[false]", 9},
+		{"{[1, 2]: 3}[[1, 2]]", 3},
+		{"{[1, 2]: 3}[[2, 1]]", nil},
+		{"let p = [0, [1]]; {p: \"x\"}[[0, [1]]]", "x"},
+		{"{[]: 1, [[]]: 2}[[[]]]", 2},
+		{"let n = {}[0]; {n: 5}[n]", 5},
+		{"{{\"a\": 1, \"b\": 2}: 1}[{\"b\": 2, \"a\": 1}]", 1},
+		{"{1: 1, \"1\": 2, [1]: 3}[\"1\"]", 2},
+		{"{[1]: 1, [1]: 2}[[1]]", 2},
+		{"{1.5: \"a\"}[1.5]", "a"},
+		{"{1: \"a\"}[1.0]", "a"},
+		{"{2.0: \"a\"}[2]", "a"},
+		{"{0.5: \"a\"}[0.25]", nil},
+		{"let p = record({\"x\": 1, \"y\": 2}); {p: \"origin\"}[record({\"y\": 2, \"x\": 1})]", "origin"},
+		{"{record({\"x\": 1}): 1}[record({\"x\": 2})]", nil},
+		{"{record({\"x\": 1}): 1}[{\"x\": 1}]", nil},
 	}
 	for _, test := range tests {
 		result, ok := testEval(t, test.input)
@@ -291,6 +470,29 @@ func TestHashIndex(t *testing.T) {
 	}
 }
 
+func TestRecordIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`record({"x": 1, "y": "b"})["y"]`, "b"},
+		{`let p = record({"x": [1, 2]}); p["x"]`, []interface{}{1, 2}},
+		{`len(record({"x": 1, "y": 2}))`, 2},
+		{`len(record({}))`, 0},
+	}
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+
+	result, ok := testEval(t, `let h = {"x": 1}; let r = record(h); let h = merge(h, {"x": 2}); r`)
+	if ok && result.Inspect() != "record{x: 1}" {
+		t.Errorf("expected record{x: 1}, got %s", result.Inspect())
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -309,6 +511,32 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`push([], 2)`, []interface{}{2}},
 		{`let x = [1]; push(x, 2); x`, []interface{}{1}},
 		{`puts("hey")`, nil},
+		{`len("é")`, 1},
+		{`len("日本語")`, 3},
+		{`len("\u{1F600}")`, 1},
+		{`chars("aé語")`, []interface{}{"a", "é", "語"}},
+		{`chars("")`, []interface{}{}},
+		{`bytes("aé")`, []interface{}{97, 195, 169}},
+		{`len(bytes("日本語"))`, 9},
+		{`len({})`, 0},
+		{`len({1: 2, "a": "b"})`, 2},
+		{`keys({"a": 1})`, []interface{}{"a"}},
+		{`keys({})`, []interface{}{}},
+		{`len(keys({1: 2, true: 3}))`, 2},
+		{`values({"a": 1})`, []interface{}{1}},
+		{`entries({true: "x"})`, []interface{}{[]interface{}{true, "x"}}},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`get({1: 2}, 1, 0)`, 2},
+		{`get({1: 2}, 3, 0)`, 0},
+		{`delete({1: 2, 3: 4}, 1)`, map[interface{}]interface{}{3: 4}},
+		{`delete({1: 2}, 5)`, map[interface{}]interface{}{1: 2}},
+		{`let h = {1: 2}; delete(h, 1); h`, map[interface{}]interface{}{1: 2}},
+		{`merge({1: 2, 3: 4}, {3: 5, "a": true})`, map[interface{}]interface{}{1: 2, 3: 5, "a": true}},
+		{`keys({"b": 1, "a": 2, 3: 3, true: 4})`, []interface{}{"b", "a", 3, true}},
+		{`values({"b": 1, "a": 2, "c": 3})`, []interface{}{1, 2, 3}},
+		{`keys(merge({"b": 1, "a": 2}, {"c": 3, "b": 4}))`, []interface{}{"b", "a", "c"}},
+		{`keys(delete({"c": 1, "b": 2, "a": 3}, "b"))`, []interface{}{"c", "a"}},
 	}
 	for _, test := range tests {
 		result, err := runEval(test.input)
@@ -320,6 +548,93 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => "one", _ => "other" }`, "one"},
+		{`match (2) { 1 => "one", _ => "other" }`, "other"},
+		{`match (-2) { -2 => true, _ => false }`, true},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (false) { true => 1, false => 2 }`, 2},
+		{`match (5) { n => n * 2 }`, 10},
+		{`match (5) { n if n > 10 => 1, n if n > 1 => 2, _ => 3 }`, 2},
+		{`match ([]) { [] => 0, [x] => x }`, 0},
+		{`match ([1, 2]) { [x] => x, [x, y] => x + y }`, 3},
+		{`match ([1, 2, 3]) { [h, ...t] => t }`, []interface{}{2, 3}},
+		{`match ([1]) { [h, ...t] => len(t) }`, 0},
+		{`match ([1, [2, 3]]) { [a, [_, b]] => a + b }`, 4},
+		{`match ([1, 2]) { [1, 3] => "a", [1, _] => "b" }`, "b"},
+		{`match ({"name": "x", "age": 3}) { {name: "y"} => 1, {name, age: a} => name + str(a) }`, "x3"},
+		{`match ({1: true}) { {"1": x} => 1, {1: x} => x }`, true},
+		{`match (1) { [x] => x, {k} => k, x => x }`, 1},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`let f = fn(list) { match (list) { [] => 0, [h, ...t] => h + f(t) } }; f([1, 2, 3, 4])`, 10},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
+func TestParametersAndArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(x, y = 10) { x + y }; f(1)`, 11},
+		{`let f = fn(x, y = 10) { x + y }; f(1, 2)`, 3},
+		{`let f = fn(x, y = x * 2) { y }; f(3)`, 6},
+		{`let n = 0; let f = fn(x = n) { x }; let n = 5; f()`, 5},
+		{`let f = fn(first, ...others) { others }; f(1, 2, 3)`, []interface{}{2, 3}},
+		{`let f = fn(first, ...others) { others }; f(1)`, []interface{}{}},
+		{`let f = fn(...all) { len(all) }; f()`, 0},
+		{`let f = fn(a, b, c) { [a, b, c] }; f(...[1, 2, 3])`, []interface{}{1, 2, 3}},
+		{`let f = fn(a, b, c) { [a, b, c] }; f(1, ...[], ...[2], 3)`, []interface{}{1, 2, 3}},
+		{`let f = fn(x, y = 2, z = 3) { [x, y, z] }; f(1, z: 4)`, []interface{}{1, 2, 4}},
+		{`let f = fn(x, y) { x - y }; f(y: 1, x: 5)`, 4},
+		{`let f = fn([a, b] = [1, 2]) { a + b }; f()`, 3},
+		{`let sum = fn(...xs) { if (len(xs) == 0) { 0 } else { first(xs) + sum(...rest(xs)) } }; sum(1, 2, 3, 4)`, 10},
+		{`puts(...["a"])`, nil},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; rest`, []interface{}{3, 4}},
+		{`let [_, ...rest] = [1]; rest`, []interface{}{}},
+		{`let {name, age: years} = {"name": "x", "age": 3}; name + str(years)`, "x3"},
+		{`let [{k: [v]}] = [{"k": [5]}]; v`, 5},
+		{`let [1, x] = [1, 2]; x`, 2},
+		{`let a = 1; let f = fn() { let [a] = [2]; a }; f() + a`, 3},
+		{`let add = fn([a, b]) { a + b }; add([1, 2])`, 3},
+		{`let f = fn({x, y}, z) { x * y + z }; f({"x": 2, "y": 3}, 1)`, 7},
+		{`let f = fn([h, ...t]) { if (len(t) == 0) { h } else { h + f(t) } }; f([1, 2, 3])`, 6},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input   string
@@ -336,12 +651,51 @@ func TestErrorHandling(t *testing.T) {
 		{`"5"+4`, "+ not supported"},
 		{`len(1)`, "not supported"},
 		{`len("a", "b")`, "number of arguments"},
-		{`{fn(){}: 0}`, "hash key must be string, integer or boolean"},
-		{`5["x"]`, "not an array or hash: 5"},
-		{`"a"[true]`, "not an array or hash: \"a\""},
-		{`true[0]`, "not an array or hash: true"},
+		{`{fn(){}: 0}`, "hash key of type FUNCTION is not hashable"},
+		{`{[1, fn(){}]: 0}`, "hash key of type ARRAY is not hashable"},
+		{`{{"f": puts}: 0}`, "hash key of type HASH is not hashable"},
+		{`5["x"]`, "not an array, string, hash or record: 5"},
+		{`"a"[true]`, "string index must be an integer"},
+		{`true[0]`, "not an array, string, hash or record: true"},
+		{`[1][::0]`, "slice step cannot be zero"},
+		{`[1]["a":]`, "slice index must be an integer"},
+		{`{1: 2}[0:1]`, "not an array or string"},
 		{`[5][true]`, "array index must be an integer"},
-		{`{1:2}[fn(){}]`, "hash index must be string, integer or boolean"},
+		{`{1:2}[fn(){}]`, "hash index of type FUNCTION is not hashable"},
+		{`"${missing}"`, "identifier not found: missing"},
+		{`str()`, "number of arguments"},
+		{`bytes(1)`, "`bytes` argument of type INTEGER not supported"},
+		{`keys([1])`, "`keys` argument of type ARRAY not supported"},
+		{`has({}, [fn(){}])`, "`has` hash key of type ARRAY is not hashable"},
+		{`get({}, 1)`, "number of arguments"},
+		{`push([1])`, "`push` received wrong number of arguments. expected 2, got 1"},
+		{`merge({}, 1)`, "`merge` argument of type INTEGER not supported"},
+		{`1.5 / 0`, "cannot divide by 0"},
+		{`1 / 0.0`, "cannot divide by 0"},
+		{`1.5 + "a"`, "+ not supported"},
+		{`{[1.5, fn(){}]: 1}`, "hash key of type ARRAY is not hashable"},
+		{`record([1])`, "`record` argument of type ARRAY not supported"},
+		{`record({1: 2})`, "`record` field name of type INTEGER is not a string"},
+		{`record({"x": 1})["y"]`, "record has no field y"},
+		{`record({"x": 1})[0]`, "record field must be a string: 0"},
+		{`record({"x": 1}) + record({"x": 1})`, "+ not supported"},
+		{`{record({"f": puts}): 0}`, "hash key of type RECORD is not hashable"},
+		{`match (3) { 1 => 1, [x] => x }`, "no match arm matches 3"},
+		{`match ([1]) { [x] if y => x }`, "identifier not found: y"},
+		{`let [a, b] = [1];`, "cannot destructure [1] with [a, b]: expected an array of 2 elements, got 1"},
+		{`let [a, b, ...c] = [1];`, "expected an array of at least 2 elements, got 1"},
+		{`let {name} = {"age": 1};`, `with {name}: missing hash key "name"`},
+		{`let [a] = 5;`, "cannot destructure 5 with [a]: expected an array, got INTEGER"},
+		{`let [0, a] = [1, 2];`, "cannot destructure [1, 2] with [0, a]: expected 0, got 1"},
+		{`let f = fn(x, {k}) { k }; f(1, [2])`, "argument 2: cannot destructure [2] with {k}: expected a hash, got ARRAY"},
+		{`let f = fn(x, y = 1) { x }; f()`, "function with 2 parameters called with 0 arguments: missing x"},
+		{`let f = fn(x, y = 1) { x }; f(1, 2, 3)`, "function with 2 parameters called with 3 arguments"},
+		{`let f = fn(x) { x }; f(y: 1)`, "function has no parameter named y"},
+		{`let f = fn(x, ...r) { x }; f(r: 1)`, "function has no parameter named r"},
+		{`let f = fn(x, ...r) { x }; f(...[1, 2], x: 3)`, "argument x given by position and by name"},
+		{`let f = fn(x) { x }; f(...1)`, "spread argument must be an array, got INTEGER"},
+		{`len(x: "a")`, "builtin len does not take named arguments"},
+		{`let f = fn(x = y) { x }; f()`, "identifier not found: y"},
 	}
 
 	for _, test := range tests {
@@ -352,6 +706,127 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+// TestJSONRoundTrip checks that programs decoded from JSON evaluate the same
+// as the parsed programs they were encoded from.
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15);",
+		"let h = {\"a\": [1, 2, 3], 0x10: true}; [h[\"a\"][::-1], h[16], len(h)];",
+		"let name = \"Monkey\"; \"Hello, ${name}! ${[1, 2][1:]}\";",
+		"if (!(1 == 2)) { -5 * (3 + 4) } else { 0 };",
+		"let f = fn(x) { x }; f(1, 2);",
+		"undefined_name;",
+	}
+
+	for _, input := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Errorf("%q: encoding failed: %s", input, err)
+			continue
+		}
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Errorf("%q: decoding failed: %s", input, err)
+			continue
+		}
+
+		expected, expectedErr := Eval(program, object.NewEnvironment())
+		actual, actualErr := Eval(decoded, object.NewEnvironment())
+		if fmt.Sprint(expectedErr) != fmt.Sprint(actualErr) {
+			t.Errorf("%q: expected error %v, got %v", input, expectedErr, actualErr)
+		}
+		if expectedErr == nil && expected.Inspect() != actual.Inspect() {
+			t.Errorf("%q: expected %s, got %s", input, expected.Inspect(), actual.Inspect())
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	program := parser.New(lexer.New(`let show = fn(x) { puts(x) }; show(1); puts("a", [2]);`)).ParseProgram()
+	var first, second strings.Builder
+	for _, out := range []*strings.Builder{&first, &second} {
+		env := object.NewEnvironment()
+		env.SetOutput(out)
+		if _, err := Eval(program, env); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if expected := "1\na\n[2]\n"; first.String() != expected || second.String() != expected {
+		t.Errorf("expected output %q, got %q and %q", expected, first.String(), second.String())
+	}
+}
+
+func TestHooks(t *testing.T) {
+	input := "let f = fn(x) { x * 2 }; f(len([1]));"
+	events := make([]string, 0)
+	env := object.NewEnvironment()
+	env.SetHooks(&object.Hooks{
+		Statement: func(statement ast.Statement, env *object.Environment) error {
+			events = append(events, "statement "+statement.String())
+			return nil
+		},
+		Expression: func(expression ast.Expression, env *object.Environment) error {
+			events = append(events, "expression "+expression.String())
+			return nil
+		},
+		Call: func(call *ast.CallExpression, function object.Object, args []object.Object) func() {
+			events = append(events, "call "+call.String())
+			return func() { events = append(events, "return "+call.String()) }
+		},
+	})
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if _, err := Eval(program, env); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+
+	expected := []string{
+		"statement let f = fn(x) { (x * 2); };",
+		"expression fn(x) { (x * 2); }",
+		"statement f(len([1]));",
+		"expression f(len([1]))",
+		"expression f",
+		"expression len([1])",
+		"expression len",
+		"expression [1]",
+		"expression 1",
+		"call len([1])",
+		"return len([1])",
+		"call f(len([1]))",
+		"statement (x * 2);",
+		"expression (x * 2)",
+		"expression x",
+		"expression 2",
+		"return f(len([1]))",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong hook calls.\nexpected=%q\ngot=%q", expected, events)
+	}
+
+	branches := make([]string, 0)
+	env.SetHooks(&object.Hooks{
+		Branch: func(expression *ast.IfExpression, consequence bool) {
+			branches = append(branches, fmt.Sprintf("%s %t", expression.Condition, consequence))
+		},
+	})
+	branching := parser.New(lexer.New("let f = fn(x) { if (x) { 1 } }; f(1); f([]);")).ParseProgram()
+	if _, err := Eval(branching, env); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if strings.Join(branches, ", ") != "x true, x false" {
+		t.Errorf("wrong branch hook calls %q", branches)
+	}
+
+	env.SetHooks(&object.Hooks{
+		Statement: func(statement ast.Statement, env *object.Environment) error {
+			return fmt.Errorf("stopped at %s", ast.StatementPosition(statement))
+		},
+	})
+	if _, err := Eval(program, env); err == nil || err.Error() != "stopped at 1:1" {
+		t.Errorf("expected hook error to stop evaluation, got %v", err)
+	}
+}
+
 func runEval(input string) (object.Object, error) {
 	lexer := lexer.New(input)
 	parser := parser.New(lexer)
@@ -381,6 +856,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	floatObj, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("Expected Float object, got %T (%+v)", obj, obj)
+		return false
+	}
+	if floatObj.Value != expected {
+		t.Errorf("Expected float value %v, got %v", expected, floatObj.Value)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	boolObj, ok := obj.(*object.Boolean)
 	if !ok {
@@ -417,8 +905,12 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 
 func testObject(t *testing.T, obj object.Object, expected interface{}) bool {
 	switch expected := expected.(type) {
+	case nil:
+		return testNullObject(t, obj)
 	case int:
 		return testIntegerObject(t, obj, int64(expected))
+	case float64:
+		return testFloatObject(t, obj, expected)
 	case bool:
 		return testBooleanObject(t, obj, expected)
 	case string:
@@ -443,8 +935,9 @@ func testArrayObject(t *testing.T, obj object.Object, expected []interface{}) bo
 		return false
 	}
 	for i, elem := range arr.Elements {
-		testObject(t, elem, expected[i])
-		return false
+		if !testObject(t, elem, expected[i]) {
+			return false
+		}
 	}
 	return true
 }
@@ -455,25 +948,25 @@ func testHashObject(t *testing.T, obj object.Object, expected map[interface{}]in
 		t.Errorf("expected Hash object, got %s", obj.Type())
 		return false
 	}
-	if len(hash.Entries) != len(expected) {
-		t.Errorf("expected hash to have %d entries, got %d", len(expected), len(hash.Entries))
+	if hash.Len() != len(expected) {
+		t.Errorf("expected hash to have %d entries, got %d", len(expected), hash.Len())
 		return false
 	}
 	for expectedKey, expectedVal := range expected {
-		var key object.HashKey
+		var key object.Object
 		switch expectedKey := expectedKey.(type) {
 		case string:
-			key = object.HashKeyFromString(expectedKey)
+			key = &object.String{Value: expectedKey}
 		case int:
-			key = object.HashKeyFromInt(int64(expectedKey))
+			key = &object.Integer{Value: int64(expectedKey)}
 		case bool:
-			key = object.HashKeyFromBool(expectedKey)
+			key = boolObjFromNativeBool(expectedKey)
 		default:
 			t.Fatalf("invalid expected hash key %v", expectedKey)
 			return false
 		}
 
-		val, ok := hash.Entries[key]
+		val, ok := hash.Get(key)
 		if !ok {
 			t.Errorf("hash missing expected key %v", expectedKey)
 			return false
@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+// Prepare parses a program and expands its macros, ready for Eval, which
+// resolves its names as it starts. Macros are defined in macroEnv, which a
+// REPL keeps from one line to the next, or in a new environment if it is
+// nil. If the program cannot be parsed the error joins its parse errors.
+func Prepare(source string, macroEnv *object.Environment) (*ast.Program, error) {
+	parser := parser.New(lexer.New(source))
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if macroEnv == nil {
+		macroEnv = object.NewEnvironment()
+	}
+	DefineMacros(program, macroEnv)
+	if _, err := ExpandMacros(program, macroEnv); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// DefineMacros binds the macros defined by top-level let statements in env,
+// removing those statements from the program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			statements = append(statements, statement)
+			continue
+		}
+		literal, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macro := &object.Macro{
+			Parameters: make([]string, len(literal.Parameters)),
+			Body:       literal.Body,
+			Env:        env,
+		}
+		for i, param := range literal.Parameters {
+			macro.Parameters[i] = param.Value
+		}
+		env.Set(let.Name.Value, macro)
+	}
+	program.Statements = statements
+}
+
+// ExpandMacros replaces each call to a macro bound in env with the code the
+// macro returns, rewriting the program in place. A macro is called with its
+// arguments quoted, and must return a quoted expression. Macro calls in the
+// arguments of a call are expanded first; calls in the code a macro returns
+// are not expanded.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if err != nil || !ok {
+			return node
+		}
+		macro, ok := macroCalled(call, env)
+		if !ok {
+			return node
+		}
+		var expression ast.Expression
+		expression, err = expandMacro(call, macro)
+		if err != nil {
+			return node
+		}
+		return expression
+	})
+	return expanded, err
+}
+
+func macroCalled(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func expandMacro(call *ast.CallExpression, macro *object.Macro) (ast.Expression, error) {
+	name := call.Function.String()
+	for _, argument := range call.Arguments {
+		switch argument.(type) {
+		case *ast.SpreadExpression, *ast.NamedArgument:
+			return nil, fmt.Errorf("macro %s called with %s, macros only take positional arguments", name, argument.String())
+		}
+	}
+	if len(macro.Parameters) != len(call.Arguments) {
+		return nil, fmt.Errorf("macro %s with %d parameters called with %d arguments", name, len(macro.Parameters), len(call.Arguments))
+	}
+	macroEnv := object.NewEnclosedEnvironment(macro.Env)
+	for i, param := range macro.Parameters {
+		macroEnv.Set(param, &object.Quote{Node: call.Arguments[i]})
+	}
+	result, err := evalStatementsAndReturn(macro.Body.Statements, macroEnv)
+	if err != nil {
+		return nil, err
+	}
+	quote, ok := result.(*object.Quote)
+	if !ok {
+		return nil, fmt.Errorf("macro %s returned %s, not a quoted expression", name, result.Type())
+	}
+	expression, ok := quote.Node.(ast.Expression)
+	if !ok {
+		return nil, fmt.Errorf("macro %s returned %s, not a quoted expression", name, result.Inspect())
+	}
+	return expression, nil
+}
@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(1.5 * 2))`, `3.0`},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{`quote(unquote([1, {"a": true}]))`, `[1, {"a": true}]`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let foobar = 8; quote(unquote(foobar) + 1)`, `(8 + 1)`},
+		{`let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+		{`let f = fn(x) { quote(unquote(x) * 2) }; f(1); f(2)`, `(2 * 2)`},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if !ok {
+			continue
+		}
+		quote, ok := result.(*object.Quote)
+		if !ok {
+			t.Errorf("%q: expected *object.Quote, got %T (%+v)", test.input, result, result)
+			continue
+		}
+		if quote.Node.String() != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, quote.Node.String())
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements left, got %d", len(program.Statements))
+	}
+	for _, name := range []string{"number", "function"} {
+		if _, ok := env.Get(name); ok {
+			t.Errorf("%s should not be defined", name)
+		}
+	}
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("expected *object.Macro, got %T (%+v)", obj, obj)
+	}
+	if macro.Inspect() != "macro(x, y) { (x + y); }" {
+		t.Errorf("unexpected macro %q", macro.Inspect())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater"); } else { puts("greater"); }`,
+		},
+		{
+			`let double = macro(x) { quote(unquote(x) * 2) }; double(double(1));`,
+			`(1 * 2) * 2`,
+		},
+	}
+
+	for _, test := range tests {
+		expected := parser.New(lexer.New(test.expected)).ParseProgram()
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		if expanded.String() != expected.String() {
+			t.Errorf("%q: expected %q, got %q", test.input, expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(x) { quote(x) }; m(1, 2)`, "macro m with 1 parameters called with 2 arguments"},
+		{`let m = macro() { 1 }; m()`, "macro m returned INTEGER, not a quoted expression"},
+		{`let m = macro() { quote(unquote(fn() {})) }; m()`, "`unquote` argument of type FUNCTION not supported"},
+		{`let m = macro(x) { x }; m(...[1])`, "macro m called with ...[1], macros only take positional arguments"},
+		{`let m = macro(x) { x }; m(x: 1)`, "macro m called with x: 1, macros only take positional arguments"},
+	}
+
+	for _, test := range tests {
+		program := parser.New(lexer.New(test.input)).ParseProgram()
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		if _, err := ExpandMacros(program, env); err == nil || err.Error() != test.expected {
+			t.Errorf("%q: expected error %q, got %v", test.input, test.expected, err)
+		}
+	}
+
+	if _, err := runEval(`let f = fn() { macro() { 1 } }; f()`); err == nil {
+		t.Errorf("expected an error evaluating a macro literal")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	macroEnv := object.NewEnvironment()
+	if _, err := Prepare(`let unless = macro(c, x) { quote(if (!(unquote(c))) { unquote(x) }) };`, macroEnv); err != nil {
+		t.Fatalf("Prepare failed: %s", err)
+	}
+	program, err := Prepare(`unless(false, 1)`, macroEnv)
+	if err != nil {
+		t.Fatalf("Prepare failed: %s", err)
+	}
+	if program.String() != "if (!false) { 1; };\n" {
+		t.Errorf("expected the macro to be expanded, got %q", program.String())
+	}
+
+	_, err = Prepare("let = 1;\nlet x 2;", nil)
+	if _, ok := parser.ErrorPosition(err); !ok || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("expected both parse errors, got %v", err)
+	}
+	if _, err := Prepare(`let m = macro() { 1 }; m()`, nil); err == nil || err.Error() != "macro m returned INTEGER, not a quoted expression" {
+		t.Errorf("expected the expansion error, got %v", err)
+	}
+}
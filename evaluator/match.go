@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+)
+
+// mismatchError is returned by matchPattern when a value does not match a
+// pattern, saying why.
+type mismatchError struct {
+	reason string
+}
+
+func (err *mismatchError) Error() string {
+	return err.reason
+}
+
+func mismatch(format string, args ...interface{}) error {
+	return &mismatchError{reason: fmt.Sprintf(format, args...)}
+}
+
+func evalMatchExpression(expr *ast.MatchExpression, env *object.Environment) (object.Object, error) {
+	arm, armEnv, err := selectMatchArm(expr, env)
+	if err != nil {
+		return nil, err
+	}
+	return Eval(arm.Body, armEnv)
+}
+
+// selectMatchArm returns the first arm of a match expression that matches
+// its value, and the environment holding the arm's bindings.
+func selectMatchArm(expr *ast.MatchExpression, env *object.Environment) (ast.MatchArm, *object.Environment, error) {
+	value, err := Eval(expr.Value, env)
+	if err != nil {
+		return ast.MatchArm{}, nil, err
+	}
+	for _, arm := range expr.Arms {
+		// bindings are made in an environment for the arm, so that those
+		// of arms that fail to match are discarded
+		armEnv := object.NewSlotEnvironment(env, arm.Slots)
+		err := matchPattern(arm.Pattern, value, armEnv)
+		var mismatch *mismatchError
+		if errors.As(err, &mismatch) {
+			continue
+		}
+		if err != nil {
+			return ast.MatchArm{}, nil, err
+		}
+		if arm.Guard != nil {
+			guard, err := Eval(arm.Guard, armEnv)
+			if err != nil {
+				return ast.MatchArm{}, nil, err
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return arm, armEnv, nil
+	}
+	return ast.MatchArm{}, nil, fmt.Errorf("no match arm matches %s", value.Inspect())
+}
+
+// destructure binds the names of a pattern in a let statement or function
+// parameter, for which a value that does not match is an error.
+func destructure(pattern ast.Pattern, value object.Object, env *object.Environment) error {
+	err := matchPattern(pattern, value, env)
+	var mismatch *mismatchError
+	if errors.As(err, &mismatch) {
+		return fmt.Errorf("cannot destructure %s with %s: %s", value.Inspect(), pattern.String(), mismatch.reason)
+	}
+	return err
+}
+
+// matchPattern matches a value against a pattern, binding its names in env.
+// A value that does not match gives a *mismatchError; other errors come from
+// evaluating literals in the pattern.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.BindingPattern:
+		bind(pattern.Name, value, env)
+		return nil
+	case *ast.LiteralPattern:
+		literal, err := Eval(pattern.Value, env)
+		if err != nil {
+			return err
+		}
+		if !object.Equal(literal, value) {
+			return mismatch("expected %s, got %s", pattern.Value.String(), value.Inspect())
+		}
+		return nil
+	case *ast.ArrayPattern:
+		return matchArrayPattern(pattern, value, env)
+	case *ast.HashPattern:
+		return matchHashPattern(pattern, value, env)
+	}
+	return fmt.Errorf("can't match pattern type %T (%s)", pattern, pattern.String())
+}
+
+func matchArrayPattern(pattern *ast.ArrayPattern, value object.Object, env *object.Environment) error {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return mismatch("expected an array, got %s", value.Type())
+	}
+	count := len(pattern.Elements)
+	if pattern.Rest == nil && len(array.Elements) != count {
+		return mismatch("expected an array of %d elements, got %d", count, len(array.Elements))
+	}
+	if len(array.Elements) < count {
+		return mismatch("expected an array of at least %d elements, got %d", count, len(array.Elements))
+	}
+	for i, element := range pattern.Elements {
+		if err := matchPattern(element, array.Elements[i], env); err != nil {
+			return err
+		}
+	}
+	if pattern.Rest != nil && pattern.Rest.Value != "_" {
+		rest := make([]object.Object, len(array.Elements)-count)
+		copy(rest, array.Elements[count:])
+		bind(pattern.Rest, &object.Array{Elements: rest}, env)
+	}
+	return nil
+}
+
+func matchHashPattern(pattern *ast.HashPattern, value object.Object, env *object.Environment) error {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return mismatch("expected a hash, got %s", value.Type())
+	}
+	for _, entry := range pattern.Entries {
+		var key object.Object
+		keyText := entry.Key.String()
+		if identifier, ok := entry.Key.(*ast.Identifier); ok {
+			key = &object.String{Value: identifier.Value}
+			keyText = fmt.Sprintf("\"%s\"", identifier.Value)
+		} else {
+			var err error
+			if key, err = Eval(entry.Key, env); err != nil {
+				return err
+			}
+		}
+		item, ok := hash.Get(key)
+		if !ok {
+			return mismatch("missing hash key %s", keyText)
+		}
+		if err := matchPattern(entry.Value, item, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/token"
+)
+
+// isCallTo reports whether a call is to the function with the given name.
+func isCallTo(call *ast.CallExpression, name string) bool {
+	identifier, ok := call.Function.(*ast.Identifier)
+	return ok && identifier.Value == name
+}
+
+// quote returns its argument unevaluated, except for the calls to unquote
+// in it, which are replaced by their evaluated arguments. The argument is
+// copied first, so that evaluating the same quote again unquotes afresh.
+func quote(call *ast.CallExpression, env *object.Environment) (object.Object, error) {
+	if len(call.Arguments) != 1 {
+		return nil, fmt.Errorf("`quote` received wrong number of arguments. expected 1, got %d", len(call.Arguments))
+	}
+	node, err := evalUnquoteCalls(ast.Copy(call.Arguments[0]), env)
+	if err != nil {
+		return nil, err
+	}
+	return &object.Quote{Node: node}, nil
+}
+
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if err != nil || !ok || !isCallTo(call, "unquote") {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = fmt.Errorf("`unquote` received wrong number of arguments. expected 1, got %d", len(call.Arguments))
+			return node
+		}
+		var value object.Object
+		value, err = Eval(call.Arguments[0], env)
+		if err != nil {
+			return node
+		}
+		var converted ast.Expression
+		converted, err = objectToExpression(value, call.Function.(*ast.Identifier).Token.Position)
+		if err != nil {
+			return node
+		}
+		return converted
+	})
+	return node, err
+}
+
+// objectToExpression converts an unquoted value back into code, giving the
+// new nodes the position of the call to unquote.
+func objectToExpression(obj object.Object, position token.Position) (ast.Expression, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		literal := fmt.Sprintf("%d", obj.Value)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Position: position}, Value: obj.Value}, nil
+	case *object.Float:
+		return &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: obj.Inspect(), Position: position}, Value: obj.Value}, nil
+	case *object.Boolean:
+		tokenType := token.TokenType(token.FALSE)
+		if obj.Value {
+			tokenType = token.TRUE
+		}
+		return &ast.BooleanLiteral{Token: token.Token{Type: tokenType, Literal: obj.Inspect(), Position: position}, Value: obj.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Position: position}, Value: obj.Value}, nil
+	case *object.Array:
+		array := &ast.ArrayExpression{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Elements: make([]ast.Expression, len(obj.Elements)),
+		}
+		for i, element := range obj.Elements {
+			converted, err := objectToExpression(element, position)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements[i] = converted
+		}
+		return array, nil
+	case *object.Hash:
+		hash := &ast.HashExpression{Token: token.Token{Type: token.LBRACE, Literal: "{", Position: position}}
+		for _, pair := range obj.Pairs() {
+			key, err := objectToExpression(pair.Key, position)
+			if err != nil {
+				return nil, err
+			}
+			value, err := objectToExpression(pair.Value, position)
+			if err != nil {
+				return nil, err
+			}
+			hash.Entries = append(hash.Entries, ast.HashEntry{Key: key, Value: value})
+		}
+		return hash, nil
+	case *object.Quote:
+		if expression, ok := obj.Node.(ast.Expression); ok {
+			return ast.Copy(expression).(ast.Expression), nil
+		}
+	}
+	return nil, fmt.Errorf("`unquote` argument of type %s not supported", obj.Type())
+}
@@ -0,0 +1,256 @@
+package evaluator
+
+import (
+	"danielmcm.com/interpreterbook/ast"
+)
+
+// scope is the environment of a function call or match arm, as laid out by
+// the resolver: a slot for each name bound in it.
+type scope struct {
+	outer *scope
+	slots map[string]int
+	names []string
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, slots: make(map[string]int)}
+}
+
+func (s *scope) declare(name string) {
+	if _, ok := s.slots[name]; !ok {
+		s.slots[name] = len(s.names)
+		s.names = append(s.names, name)
+	}
+}
+
+// declareLets declares the names bound by the let statements evaluated in
+// a scope, including those in if blocks but not those in nested functions,
+// match arms or quoted code.
+func (s *scope) declareLets(nodes ...ast.Node) {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				for _, name := range node.Names() {
+					s.declare(name.Value)
+				}
+			case *ast.FunctionLiteral, *ast.MacroLiteral:
+				return false
+			case *ast.MatchExpression:
+				s.declareLets(node.Value)
+				return false
+			case *ast.CallExpression:
+				return !isCallTo(node, "quote")
+			}
+			return true
+		})
+	}
+}
+
+// resolve annotates the identifiers of a program with the slots of the
+// bindings they refer to or declare, and the function literals and match
+// arms with the names of their slots.
+//
+// Every name bound anywhere in a function or match arm gets a slot, so an
+// identifier is resolved to the innermost scope binding its name even where
+// it is used before the binding is made; the evaluator then falls back to
+// looking it up by name. Top-level bindings are not given slots, so that
+// globals stay dynamic for the REPL, and neither is quoted code, which is
+// evaluated elsewhere if at all.
+func resolve(program *ast.Program) {
+	for _, statement := range program.Statements {
+		resolveStatement(nil, statement)
+	}
+}
+
+func resolveStatement(s *scope, statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		resolveExpression(s, statement.Value)
+		if statement.Pattern != nil {
+			resolvePattern(s, statement.Pattern)
+		} else {
+			resolveDeclaration(s, statement.Name)
+		}
+	case *ast.ReturnStatement:
+		resolveExpression(s, statement.ReturnValue)
+	case *ast.ExpressionStatement:
+		resolveExpression(s, statement.Expression)
+	case *ast.BlockStatement:
+		resolveBlock(s, statement)
+	}
+}
+
+func resolveBlock(s *scope, block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, statement := range block.Statements {
+		resolveStatement(s, statement)
+	}
+}
+
+func resolveExpression(s *scope, expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.Identifier:
+		resolveReference(s, expression)
+	case *ast.InterpolatedString:
+		resolveExpressions(s, expression.Parts)
+	case *ast.PrefixExpression:
+		resolveExpression(s, expression.Right)
+	case *ast.InfixExpression:
+		resolveExpression(s, expression.Left)
+		resolveExpression(s, expression.Right)
+	case *ast.IfExpression:
+		resolveExpression(s, expression.Condition)
+		resolveBlock(s, expression.Consequence)
+		resolveBlock(s, expression.Alternative)
+	case *ast.FunctionLiteral:
+		resolveFunctionLiteral(s, expression)
+	case *ast.CallExpression:
+		if isCallTo(expression, "quote") {
+			resolveQuoted(s, expression.Arguments)
+			return
+		}
+		resolveExpression(s, expression.Function)
+		resolveExpressions(s, expression.Arguments)
+	case *ast.SpreadExpression:
+		resolveExpression(s, expression.Value)
+	case *ast.NamedArgument:
+		// the name is a parameter of the function called, not a reference
+		resolveExpression(s, expression.Value)
+	case *ast.ArrayExpression:
+		resolveExpressions(s, expression.Elements)
+	case *ast.HashExpression:
+		for _, entry := range expression.Entries {
+			resolveExpression(s, entry.Key)
+			resolveExpression(s, entry.Value)
+		}
+	case *ast.IndexExpression:
+		resolveExpression(s, expression.Left)
+		resolveExpression(s, expression.Index)
+	case *ast.SliceExpression:
+		resolveExpression(s, expression.Left)
+		resolveExpression(s, expression.Start)
+		resolveExpression(s, expression.End)
+		resolveExpression(s, expression.Step)
+	case *ast.MatchExpression:
+		resolveExpression(s, expression.Value)
+		for i := range expression.Arms {
+			arm := &expression.Arms[i]
+			inner := newScope(s)
+			for _, name := range ast.Bindings(arm.Pattern) {
+				inner.declare(name.Value)
+			}
+			inner.declareLets(arm.Guard, arm.Body)
+			resolvePattern(inner, arm.Pattern)
+			resolveExpression(inner, arm.Guard)
+			resolveExpression(inner, arm.Body)
+			arm.Slots = inner.names
+		}
+	}
+}
+
+func resolveExpressions(s *scope, expressions []ast.Expression) {
+	for _, expression := range expressions {
+		resolveExpression(s, expression)
+	}
+}
+
+// resolveFunctionLiteral lays out the environment of calls to a function:
+// its parameters, in order, and then the names bound by its body. Defaults
+// are evaluated in that environment.
+func resolveFunctionLiteral(s *scope, function *ast.FunctionLiteral) {
+	inner := newScope(s)
+	for _, parameter := range function.Parameters {
+		for _, name := range parameter.Names() {
+			inner.declare(name.Value)
+		}
+	}
+	if function.Rest != nil {
+		inner.declare(function.Rest.Value)
+	}
+	if function.Body != nil {
+		inner.declareLets(function.Body)
+	}
+
+	for _, parameter := range function.Parameters {
+		resolveExpression(inner, parameter.Default)
+		if parameter.Pattern != nil {
+			resolvePattern(inner, parameter.Pattern)
+		} else {
+			resolveDeclaration(inner, parameter.Name)
+		}
+	}
+	if function.Rest != nil {
+		resolveDeclaration(inner, function.Rest)
+	}
+	resolveBlock(inner, function.Body)
+	function.Slots = inner.names
+}
+
+func resolvePattern(s *scope, pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		resolveDeclaration(s, pattern.Name)
+	case *ast.LiteralPattern:
+		resolveExpression(s, pattern.Value)
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			resolvePattern(s, element)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			resolveDeclaration(s, pattern.Rest)
+		}
+	case *ast.HashPattern:
+		for _, entry := range pattern.Entries {
+			// identifier keys are the strings they name
+			if _, ok := entry.Key.(*ast.Identifier); !ok {
+				resolveExpression(s, entry.Key)
+			}
+			resolvePattern(s, entry.Value)
+		}
+	}
+}
+
+// resolveQuoted resolves the arguments of the calls to unquote in quoted
+// code, which are evaluated where the quote is.
+func resolveQuoted(s *scope, arguments []ast.Expression) {
+	for _, argument := range arguments {
+		ast.Inspect(argument, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && isCallTo(call, "unquote") {
+				resolveExpressions(s, call.Arguments)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// resolveDeclaration resolves an identifier naming a binding made in the
+// environment of the scope it is in.
+func resolveDeclaration(s *scope, identifier *ast.Identifier) {
+	identifier.Resolved = false
+	if s == nil {
+		return
+	}
+	if slot, ok := s.slots[identifier.Value]; ok {
+		identifier.Resolved, identifier.Depth, identifier.Slot = true, 0, slot
+	}
+}
+
+// resolveReference resolves an identifier referring to a binding in the
+// innermost scope binding its name. Identifiers not bound by any enclosing
+// function or match arm are left to be looked up by name.
+func resolveReference(s *scope, identifier *ast.Identifier) {
+	identifier.Resolved = false
+	for depth := 0; s != nil; depth, s = depth+1, s.outer {
+		if slot, ok := s.slots[identifier.Value]; ok {
+			identifier.Resolved, identifier.Depth, identifier.Slot = true, depth, slot
+			return
+		}
+	}
+}
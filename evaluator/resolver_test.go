@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func TestResolve(t *testing.T) {
+	program := parser.New(lexer.New(`
+		let g = 1;
+		let f = fn(a, [b, {k: c}], d = a, ...r) {
+			let e = a;
+			fn(x) { x + e + g + f(k: d) + len(r) + quote(unquote(b) + q) }
+		};
+		match (g) { [h] if h => h, {y} => fn() { y } }`)).ParseProgram()
+	resolve(program)
+
+	identifiers := make([]string, 0)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok {
+			description := identifier.Value
+			if identifier.Resolved {
+				description = fmt.Sprintf("%s@%d.%d", identifier.Value, identifier.Depth, identifier.Slot)
+			}
+			identifiers = append(identifiers, description)
+		}
+		return true
+	})
+	expected := "g f a@0.0 b@0.1 k c@0.2 d@0.3 a@0.0 r@0.4 e@0.5 a@0.0 x@0.0 x@0.0 e@1.5 g f k d@1.3 len r@1.4 quote unquote b@1.1 q " +
+		"g h@0.0 h@0.0 h@0.0 y y@0.0 y@1.0"
+	if actual := strings.Join(identifiers, " "); actual != expected {
+		t.Errorf("wrong resolution.\nexpected: %s\nactual:   %s", expected, actual)
+	}
+
+	outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	match := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	slots := [][]string{outer.Slots, inner.Slots, match.Arms[0].Slots, match.Arms[1].Slots}
+	expectedSlots := [][]string{{"a", "b", "c", "d", "r", "e"}, {"x"}, {"h"}, {"y"}}
+	if !reflect.DeepEqual(slots, expectedSlots) {
+		t.Errorf("expected slots %v, got %v", expectedSlots, slots)
+	}
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// a name used before it is bound in a scope is found outside it
+		{`let x = 1; let f = fn() { let y = x; let x = 2; [y, x] }; f()`, []interface{}{1, 2}},
+		{`let f = fn() { let g = fn() { x }; let x = 2; g() }; f()`, 2},
+		{`let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()`, 2},
+		{`let f = fn(a) { if (a) { let b = 1 } else { let b = 2 }; b }; f(false)`, 2},
+		{`let f = fn(n) { let go = fn(i, acc) { if (n < i) { acc } else { go(i + 1, acc + i) } }; go(1, 0) }; f(10)`, 55},
+		{`let f = fn(a, b = a * 2) { b }; f(3)`, 6},
+		{`let f = fn(v) { match (v) { [a, ...r] if 0 < a => if (true) { let s = a + len(r); s }, _ => 0 } }; f([1, 2, 3])`, 3},
+		{`let f = fn(x) { match (x) { [x] => match (x) { {x} => x } } }; f([{"x": 4}])`, 4},
+		{`let f = fn() { g() }; let g = fn() { 5 }; f()`, 5},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+
+	// quoted code is not resolved, but the calls to unquote in it are
+	result, ok := testEval(t, `let f = fn(x) { quote(unquote(x + 1) + x) }; f(2)`)
+	if ok && result.Inspect() != "QUOTE((3 + x))" {
+		t.Errorf("expected QUOTE((3 + x)), got %s", result.Inspect())
+	}
+
+	// globals are looked up by name, so later programs in the same
+	// environment can define them, as in the REPL
+	env := object.NewEnvironment()
+	inputs := []string{`let f = fn(n) { g(n) + 1 }`, `let g = fn(n) { n * 2 }; f(3)`}
+	var err error
+	for _, input := range inputs {
+		result, err = Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	testIntegerObject(t, result, 7)
+}
+
+func TestSlotEnvironmentNames(t *testing.T) {
+	var names []string
+	var b object.Object
+	env := object.NewEnvironment()
+	env.SetHooks(&object.Hooks{
+		Statement: func(statement ast.Statement, env *object.Environment) error {
+			if statement.String() == "b;" {
+				names = env.Names()
+				b, _ = env.Get("b")
+			}
+			return nil
+		},
+	})
+	program := parser.New(lexer.New(`let f = fn(a) { let b = a; b; let c = b; c }; f(1)`)).ParseProgram()
+	if _, err := Eval(program, env); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	// c has a slot but is not bound yet
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("expected names [a b], got %v", names)
+	}
+	testIntegerObject(t, b, 1)
+}
+
+// BenchmarkFib compares looking up names by the slots the resolver gives
+// them with looking them up by name, as unresolved programs are.
+func BenchmarkFib(b *testing.B) {
+	const input = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)`
+	benchmarks := []struct {
+		name string
+		eval func(program *ast.Program, env *object.Environment) (object.Object, error)
+	}{
+		{"resolved", func(program *ast.Program, env *object.Environment) (object.Object, error) {
+			return Eval(program, env)
+		}},
+		{"by name", func(program *ast.Program, env *object.Environment) (object.Object, error) {
+			return evalStatementsAndReturn(program.Statements, env)
+		}},
+	}
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			for i := 0; i < b.N; i++ {
+				result, err := benchmark.eval(program, object.NewEnvironment())
+				if err != nil || result.Inspect() != "6765" {
+					b.Fatalf("expected 6765, got %v, %v", result, err)
+				}
+			}
+		})
+	}
+}
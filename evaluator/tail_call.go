@@ -0,0 +1,132 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/object"
+)
+
+// tailCall is a call in tail position whose function and arguments have
+// been evaluated. It is returned in place of the result of a function body
+// and made by apply once the body has finished, so that recursion in tail
+// position does not grow the Go stack. It never escapes apply.
+type tailCall struct {
+	call     *ast.CallExpression
+	function object.Object
+	args     []object.Object
+	named    []namedArgument
+	// env is the environment of the caller, for its hooks
+	env *object.Environment
+}
+
+func (tc *tailCall) Type() object.ObjectType {
+	return "TAIL_CALL"
+}
+func (tc *tailCall) Inspect() string {
+	return fmt.Sprintf("tail call %s", tc.call.String())
+}
+
+// evalBody evaluates the statements of a function body, returning a
+// *tailCall for a call in tail position: the last expression of the body,
+// the value of a return statement, or the last expression of a branch of an
+// if or match expression in tail position.
+func evalBody(statements []ast.Statement, env *object.Environment) (object.Object, error) {
+	result, err := evalTailStatements(statements, env, true)
+	if err != nil {
+		return nil, err
+	}
+	if returnObj, ok := result.(*object.ReturnValue); ok {
+		return returnObj.Value, nil
+	}
+	return result, nil
+}
+
+// evalTailStatements is evalStatements for the statements of a function
+// body, or of a block in it, where the last statement is in tail position
+// if tail is set. Return statements are always in tail position.
+func evalTailStatements(statements []ast.Statement, env *object.Environment, tail bool) (object.Object, error) {
+	var result object.Object = NULL
+	for i, statement := range statements {
+		obj, err := evalTailStatement(statement, env, tail && i == len(statements)-1)
+		if err != nil {
+			return nil, err
+		}
+		if obj.Type() == object.RETURN_VALUE_OBJ {
+			return obj, nil
+		}
+		result = obj
+	}
+	return result, nil
+}
+
+func evalTailStatement(statement ast.Statement, env *object.Environment, tail bool) (object.Object, error) {
+	switch statement := statement.(type) {
+	case *ast.ReturnStatement:
+		if err := runEnvHooks(statement, env); err != nil {
+			return nil, err
+		}
+		val, err := evalTailExpression(statement.ReturnValue, env, true)
+		if err != nil {
+			return nil, err
+		}
+		return &object.ReturnValue{Value: val}, nil
+	case *ast.ExpressionStatement:
+		if err := runEnvHooks(statement, env); err != nil {
+			return nil, err
+		}
+		return evalTailExpression(statement.Expression, env, tail)
+	}
+	return Eval(statement, env)
+}
+
+// evalTailExpression evaluates an expression, returning a *tailCall for a
+// call if tail is set. If and match expressions are followed whether or not
+// they are in tail position, for the return statements in them.
+func evalTailExpression(expr ast.Expression, env *object.Environment, tail bool) (object.Object, error) {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		if !tail || isCallTo(expr, "quote") {
+			break
+		}
+		if err := runEnvHooks(expr, env); err != nil {
+			return nil, err
+		}
+		called, err := Eval(expr.Function, env)
+		if err != nil {
+			return nil, err
+		}
+		args, named, err := evalArguments(expr.Arguments, env)
+		if err != nil {
+			return nil, err
+		}
+		return &tailCall{call: expr, function: called, args: args, named: named, env: env}, nil
+	case *ast.IfExpression:
+		if err := runEnvHooks(expr, env); err != nil {
+			return nil, err
+		}
+		cond, err := Eval(expr.Condition, env)
+		if err != nil {
+			return nil, err
+		}
+		if hooks := env.Hooks(); hooks != nil && hooks.Branch != nil {
+			hooks.Branch(expr, isTruthy(cond))
+		}
+		if isTruthy(cond) {
+			return evalTailStatements(expr.Consequence.Statements, env, tail)
+		} else if expr.Alternative != nil {
+			return evalTailStatements(expr.Alternative.Statements, env, tail)
+		}
+		return NULL, nil
+	case *ast.MatchExpression:
+		if err := runEnvHooks(expr, env); err != nil {
+			return nil, err
+		}
+		arm, armEnv, err := selectMatchArm(expr, env)
+		if err != nil {
+			return nil, err
+		}
+		return evalTailExpression(arm.Body, armEnv, tail)
+	}
+	return Eval(expr, env)
+}
@@ -0,0 +1,71 @@
+package evaluator
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func TestTailCalls(t *testing.T) {
+	// a call that is not in tail position overflows this stack well before
+	// recursing 100,000 times
+	defer debug.SetMaxStack(debug.SetMaxStack(64 << 20))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)`, 1000000},
+		{`let f = fn(n) { if (n == 0) { return "done"; } return f(n - 1); }; f(1000000)`, "done"},
+		{`let f = fn(n) { if (n == 0) { return 0; }; let m = n - 1; f(m) }; f(100000)`, 0},
+		{`let f = fn(n) { if (n > 0) { return f(n - 1); } "done" }; f(100000)`, "done"},
+		{`let f = fn(n, acc) { match (n) { 0 => acc, _ => f(n - 1, acc + 2) } }; f(100000, 0)`, 200000},
+		{`let f = fn(n, step = 1) { if (n < 1) { n } else { f(n - step, step: step) } }; f(100000)`, 0},
+		{`let f = fn(n, ...rest) { if (n == 0) { len(rest) } else { f(n - 1, ...rest) } }; f(100000, 1, 2)`, 2},
+		{
+			`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+			let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+			even(100001)`,
+			false,
+		},
+		{`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1000)`, 1000},
+		{`let f = fn() { len("abc") }; f()`, 3},
+	}
+
+	for _, test := range tests {
+		result, ok := testEval(t, test.input)
+		if ok {
+			testObject(t, result, test.expected)
+		}
+	}
+
+	// quote is not called, so it is evaluated as usual in tail position
+	result, ok := testEval(t, `let f = fn() { quote(1 + 2) }; f()`)
+	if ok && result.Inspect() != "QUOTE((1 + 2))" {
+		t.Errorf("expected QUOTE((1 + 2)), got %s", result.Inspect())
+	}
+}
+
+func TestTailCallHooks(t *testing.T) {
+	depth, deepest, calls := 0, 0, 0
+	env := object.NewEnvironment()
+	env.SetHooks(&object.Hooks{
+		Call: func(call *ast.CallExpression, function object.Object, args []object.Object) func() {
+			calls++
+			depth++
+			deepest = max(deepest, depth)
+			return func() { depth-- }
+		},
+	})
+	program := parser.New(lexer.New(`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100)`)).ParseProgram()
+	if _, err := Eval(program, env); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if calls != 101 || deepest != 1 || depth != 0 {
+		t.Errorf("expected tail calls to be seen one at a time, got %d calls, %d deep, ending %d deep", calls, deepest, depth)
+	}
+}
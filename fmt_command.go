@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"danielmcm.com/interpreterbook/format"
+)
+
+// runFmt implements `monkey fmt [-w] [files]`, printing each file in
+// canonical style. Standard input is formatted if no files are given.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := format.Source(string(source))
+		if err != nil {
+			printFileErrors("<stdin>", err)
+			return 1
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		formatted, err := format.Source(string(source))
+		if err != nil {
+			printFileErrors(path, err)
+			status = 1
+			continue
+		}
+		if *write {
+			if formatted != string(source) {
+				if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		} else {
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
+
+// printFileErrors prints each line of err, which may join several errors,
+// prefixed with the path of the file it relates to.
+func printFileErrors(path string, err error) {
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, line)
+	}
+}
@@ -0,0 +1,662 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/token"
+)
+
+const (
+	// maxWidth is the column beyond which argument lists, arrays and hash
+	// literals are split over several lines.
+	maxWidth = 80
+	// tabWidth is the number of columns an indentation tab is counted as.
+	tabWidth = 4
+)
+
+// Source formats a Monkey program in canonical style, keeping its comments.
+// An error is returned if the program cannot be parsed.
+func Source(source string) (string, error) {
+	lexer := lexer.New(source)
+	parser := parser.New(lexer)
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	printer := &printer{
+		comments: lexer.Comments(),
+		lines:    strings.Split(source, "\n"),
+	}
+	printer.scan(source)
+	return printer.program(program), nil
+}
+
+// Node formats a single node without comments.
+func Node(node ast.Node) string {
+	printer := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		return printer.program(node)
+	case ast.Statement:
+		return printer.statement(node, 0)
+	case ast.Expression:
+		return printer.expression(node, 0, 0)
+	default:
+		return node.String()
+	}
+}
+
+type printer struct {
+	// comments not yet printed, in source order
+	comments []lexer.Comment
+	// source lines, used to preserve blank lines between statements
+	lines []string
+	// positions of the source tokens, in order, ending with the EOF
+	tokens []token.Position
+	// the matching brackets in the source, by the positions of both
+	brackets map[token.Position]*bracket
+	// set while measuring a list on a single line, to stop nested lists
+	// from being split
+	noWrap bool
+}
+
+// bracket is a pair of matching brackets in the source, with the commas
+// directly between them.
+type bracket struct {
+	open   token.Position
+	close  token.Position
+	commas []token.Position
+}
+
+// separator returns the position of the comma after the item at index i,
+// or of the closing bracket after the last item. Index -1 gives the
+// opening bracket.
+func (b *bracket) separator(i int) token.Position {
+	switch {
+	case i < 0:
+		return b.open
+	case i < len(b.commas):
+		return b.commas[i]
+	default:
+		return b.close
+	}
+}
+
+// scan records the positions of the tokens and brackets of a source that
+// has been parsed, which place comments in blocks and lists.
+func (p *printer) scan(source string) {
+	lexer := lexer.New(source)
+	p.brackets = make(map[token.Position]*bracket)
+	open := make([]*bracket, 0)
+	for {
+		tok, err := lexer.NextToken()
+		if err != nil {
+			return
+		}
+		p.tokens = append(p.tokens, tok.Position)
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			b := &bracket{open: tok.Position}
+			p.brackets[tok.Position] = b
+			open = append(open, b)
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			if len(open) > 0 {
+				b := open[len(open)-1]
+				open = open[:len(open)-1]
+				b.close = tok.Position
+				p.brackets[tok.Position] = b
+			}
+		case token.COMMA:
+			if len(open) > 0 {
+				b := open[len(open)-1]
+				b.commas = append(b.commas, tok.Position)
+			}
+		case token.EOF:
+			return
+		}
+	}
+}
+
+func (p *printer) program(program *ast.Program) string {
+	var out bytes.Buffer
+	var end token.Position
+	if len(p.tokens) > 0 {
+		end = p.tokens[len(p.tokens)-1]
+	}
+	out.WriteString(p.statementList(program.Statements, 0, end))
+	for _, comment := range p.comments {
+		if out.Len() > 0 && p.blankLineBefore(comment.Position.Line) {
+			out.WriteString("\n")
+		}
+		out.WriteString(comment.Text)
+		out.WriteString("\n")
+	}
+	p.comments = nil
+	return out.String()
+}
+
+// statementList prints statements on their own lines at the given
+// indentation, preceded by any comments that appear before them. End is the
+// position of the token closing the list, which comments on the same line
+// as the last statement must come before to follow it.
+//
+// If and match expression statements are printed without a semicolon,
+// unless the next statement starts with a token that would otherwise
+// continue the expression, as in if (x) { 1 }; -1.
+func (p *printer) statementList(statements []ast.Statement, indent int, end token.Position) string {
+	var out bytes.Buffer
+	prefix := strings.Repeat("\t", indent)
+	// where a semicolon may be needed after the last if or match
+	// expression statement, or -1
+	unterminated := -1
+	for i, statement := range statements {
+		position := ast.StatementPosition(statement)
+		p.commentLines(&out, position, prefix)
+		if out.Len() > 0 && p.blankLineBefore(position.Line) {
+			out.WriteString("\n")
+		}
+
+		text := p.statement(statement, indent)
+		if unterminated >= 0 && strings.IndexAny(text, "-([") == 0 {
+			printed := out.String()
+			out.Reset()
+			out.WriteString(printed[:unterminated] + ";" + printed[unterminated:])
+		}
+		unterminated = -1
+		if isUnterminated(statement) {
+			unterminated = out.Len() + len(prefix) + len(text)
+		}
+		next := end
+		if i < len(statements)-1 {
+			next = ast.StatementPosition(statements[i+1])
+		}
+		text += p.trailingComments(next)
+		out.WriteString(prefix)
+		out.WriteString(text)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// commentLines prints the comments before a position on their own lines,
+// keeping blank lines before them.
+func (p *printer) commentLines(out *bytes.Buffer, position token.Position, prefix string) {
+	for len(p.comments) > 0 && before(p.comments[0].Position, position) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+		if out.Len() > 0 && p.blankLineBefore(comment.Position.Line) {
+			out.WriteString("\n")
+		}
+		out.WriteString(prefix)
+		out.WriteString(comment.Text)
+		out.WriteString("\n")
+	}
+}
+
+// trailingComments returns the comments following the last token before
+// a position on the same line, and before the position, to be printed
+// after the text that token ends. Comments after a closing bracket on that
+// line are left for the statement or item enclosing it.
+func (p *printer) trailingComments(position token.Position) string {
+	last := p.tokenBefore(position)
+	text := ""
+	for len(p.comments) > 0 {
+		comment := p.comments[0]
+		if comment.Position.Line != last.Line || !before(last, comment.Position) || !before(comment.Position, position) {
+			break
+		}
+		text += " " + comment.Text
+		p.comments = p.comments[1:]
+	}
+	return text
+}
+
+// tokenBefore returns the position of the last token before a position,
+// or the zero position if there is none.
+func (p *printer) tokenBefore(position token.Position) token.Position {
+	i := sort.Search(len(p.tokens), func(i int) bool {
+		return !before(p.tokens[i], position)
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return p.tokens[i-1]
+}
+
+// tokenAfter returns the position of the first token after a position, or
+// the zero position if there is none.
+func (p *printer) tokenAfter(position token.Position) token.Position {
+	i := sort.Search(len(p.tokens), func(i int) bool {
+		return before(position, p.tokens[i])
+	})
+	if i == len(p.tokens) {
+		return token.Position{}
+	}
+	return p.tokens[i]
+}
+
+// itemEnd returns the position trailing comments on the last line of the
+// item at index i between a pair of brackets must come before: the next
+// token after its comma, or the closing bracket.
+func (p *printer) itemEnd(b *bracket, i int) token.Position {
+	if end := b.separator(i); end != b.close {
+		return p.tokenAfter(end)
+	}
+	return b.close
+}
+
+// hasCommentBefore reports whether a comment not yet printed comes before
+// a position.
+func (p *printer) hasCommentBefore(position token.Position) bool {
+	return len(p.comments) > 0 && before(p.comments[0].Position, position)
+}
+
+func before(a token.Position, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// isUnterminated reports whether a statement is printed without a closing
+// semicolon.
+func isUnterminated(statement ast.Statement) bool {
+	if statement, ok := statement.(*ast.ExpressionStatement); ok {
+		switch statement.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression:
+			return true
+		}
+	}
+	return false
+}
+
+// blankLineBefore reports whether the source line before the given line
+// (counting from 1) is blank.
+func (p *printer) blankLineBefore(line int) bool {
+	if line < 2 || line-2 >= len(p.lines) {
+		return false
+	}
+	return strings.TrimSpace(p.lines[line-2]) == ""
+}
+
+func (p *printer) statement(statement ast.Statement, indent int) string {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		var name string
+		if statement.Pattern != nil {
+			name = p.pattern(statement.Pattern)
+		} else {
+			name = statement.Name.Value
+		}
+		prefix := "let " + name + " = "
+		return prefix + p.expression(statement.Value, indent, indent*tabWidth+len(prefix)) + ";"
+	case *ast.ReturnStatement:
+		return "return " + p.expression(statement.ReturnValue, indent, indent*tabWidth+len("return ")) + ";"
+	case *ast.ExpressionStatement:
+		text := p.expression(statement.Expression, indent, indent*tabWidth)
+		if isUnterminated(statement) {
+			return text
+		}
+		return text + ";"
+	case *ast.BlockStatement:
+		return p.block(statement, indent)
+	default:
+		return statement.String()
+	}
+}
+
+// block prints a block, with the comments in it before its closing brace.
+func (p *printer) block(block *ast.BlockStatement, indent int) string {
+	var end token.Position
+	if b, ok := p.brackets[block.Token.Position]; ok {
+		end = b.close
+	}
+	var body bytes.Buffer
+	body.WriteString(p.statementList(block.Statements, indent+1, end))
+	p.commentLines(&body, end, strings.Repeat("\t", indent+1))
+	if body.Len() == 0 {
+		return "{}"
+	}
+	return "{\n" + body.String() + strings.Repeat("\t", indent) + "}"
+}
+
+// expression prints an expression starting at the given column, with any
+// further lines indented by indent tabs.
+func (p *printer) expression(expr ast.Expression, indent int, column int) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Value
+	case *ast.IntegerLiteral:
+		// Keep the literal's original base and digit separators
+		if expr.Token.Type == token.INT {
+			return expr.Token.Literal
+		}
+		return strconv.FormatInt(expr.Value, 10)
+	case *ast.FloatLiteral:
+		if expr.Token.Type == token.FLOAT {
+			return expr.Token.Literal
+		}
+		return (&object.Float{Value: expr.Value}).Inspect()
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(expr.Value)
+	case *ast.StringLiteral:
+		if expr.Token.Raw != "" {
+			return expr.Token.Raw
+		}
+		return `"` + escape(expr.Value) + `"`
+	case *ast.InterpolatedString:
+		if expr.Token.Raw != "" {
+			return expr.Token.Raw
+		}
+		var out bytes.Buffer
+		out.WriteString(`"`)
+		for _, part := range expr.Parts {
+			if str, ok := part.(*ast.StringLiteral); ok {
+				out.WriteString(escape(str.Value))
+			} else {
+				out.WriteString("${")
+				out.WriteString(p.expression(part, indent, column))
+				out.WriteString("}")
+			}
+		}
+		out.WriteString(`"`)
+		return out.String()
+	case *ast.PrefixExpression:
+		return expr.Operator + p.operand(expr.Right, parser.PREFIX, indent, column+len(expr.Operator))
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(token.TokenType(expr.Operator))
+		left := p.operand(expr.Left, precedence, indent, column)
+		right := p.operand(expr.Right, precedence+1, indent, column+lastLineWidth(left)+len(expr.Operator)+2)
+		return left + " " + expr.Operator + " " + right
+	case *ast.IfExpression:
+		condition := p.expression(expr.Condition, indent, column+len("if ("))
+		text := "if (" + condition + ") " + p.block(expr.Consequence, indent)
+		if expr.Alternative != nil {
+			text += " else " + p.block(expr.Alternative, indent)
+		}
+		return text
+	case *ast.FunctionLiteral:
+		params := make([]string, len(expr.Parameters), len(expr.Parameters)+1)
+		for i, param := range expr.Parameters {
+			if param.Pattern != nil {
+				params[i] = p.pattern(param.Pattern)
+			} else {
+				params[i] = param.Name.Value
+			}
+			if param.Default != nil {
+				params[i] += " = " + p.expression(param.Default, indent, column)
+			}
+		}
+		if expr.Rest != nil {
+			params = append(params, "..."+expr.Rest.Value)
+		}
+		return "fn(" + strings.Join(params, ", ") + ") " + p.block(expr.Body, indent)
+	case *ast.MacroLiteral:
+		params := make([]string, len(expr.Parameters))
+		for i, param := range expr.Parameters {
+			params[i] = param.Value
+		}
+		return "macro(" + strings.Join(params, ", ") + ") " + p.block(expr.Body, indent)
+	case *ast.CallExpression:
+		function := p.operand(expr.Function, parser.CALL, indent, column)
+		return function + p.list("(", ")", expr.Token.Position, expr.Arguments, indent, column+lastLineWidth(function))
+	case *ast.SpreadExpression:
+		return "..." + p.expression(expr.Value, indent, column+len("..."))
+	case *ast.NamedArgument:
+		return expr.Name.Value + ": " + p.expression(expr.Value, indent, column+len(expr.Name.Value)+2)
+	case *ast.ArrayExpression:
+		return p.list("[", "]", expr.Token.Position, expr.Elements, indent, column)
+	case *ast.HashExpression:
+		items := make([]func(int, int) string, len(expr.Entries))
+		for i, entry := range expr.Entries {
+			items[i] = func(indent int, column int) string {
+				key := p.expression(entry.Key, indent, column)
+				return key + ": " + p.expression(entry.Value, indent, column+lastLineWidth(key)+2)
+			}
+		}
+		return p.items("{", "}", expr.Token.Position, items, indent, column)
+	case *ast.IndexExpression:
+		left := p.operand(expr.Left, parser.CALL, indent, column)
+		return left + "[" + p.expression(expr.Index, indent, column+lastLineWidth(left)+1) + "]"
+	case *ast.SliceExpression:
+		text := p.operand(expr.Left, parser.CALL, indent, column) + "["
+		if expr.Start != nil {
+			text += p.expression(expr.Start, indent, column)
+		}
+		text += ":"
+		if expr.End != nil {
+			text += p.expression(expr.End, indent, column)
+		}
+		if expr.Step != nil {
+			text += ":" + p.expression(expr.Step, indent, column)
+		}
+		return text + "]"
+	case *ast.MatchExpression:
+		return p.match(expr, indent, column)
+	default:
+		return expr.String()
+	}
+}
+
+// match prints a match expression with each arm on its own line, and the
+// comments between them.
+func (p *printer) match(expr *ast.MatchExpression, indent int, column int) string {
+	var out bytes.Buffer
+	out.WriteString("match (")
+	out.WriteString(p.expression(expr.Value, indent, column+len("match (")))
+	out.WriteString(") {\n")
+	prefix := strings.Repeat("\t", indent+1)
+	// the braces around the arms follow the parentheses around the value
+	var b *bracket
+	if value, ok := p.brackets[p.tokenAfter(expr.Token.Position)]; ok {
+		b = p.brackets[p.tokenAfter(value.close)]
+	}
+	for i, arm := range expr.Arms {
+		if b != nil {
+			p.commentLines(&out, p.tokenAfter(b.separator(i-1)), prefix)
+		}
+		text := p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			text += " if " + p.expression(arm.Guard, indent+1, (indent+1)*tabWidth+len(text)+len(" if "))
+		}
+		text += " => "
+		text += p.expression(arm.Body, indent+1, (indent+1)*tabWidth+lastLineWidth(text))
+		out.WriteString(prefix)
+		out.WriteString(text)
+		if i < len(expr.Arms)-1 {
+			out.WriteString(",")
+		}
+		if b != nil {
+			out.WriteString(p.trailingComments(p.itemEnd(b, i)))
+		}
+		out.WriteString("\n")
+	}
+	if b != nil {
+		p.commentLines(&out, b.close, prefix)
+	}
+	out.WriteString(strings.Repeat("\t", indent))
+	out.WriteString("}")
+	return out.String()
+}
+
+// pattern prints a pattern on a single line.
+func (p *printer) pattern(pattern ast.Pattern) string {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		return p.expression(pattern.Value, 0, 0)
+	case *ast.ArrayPattern:
+		elements := make([]string, len(pattern.Elements), len(pattern.Elements)+1)
+		for i, element := range pattern.Elements {
+			elements[i] = p.pattern(element)
+		}
+		if pattern.Rest != nil {
+			elements = append(elements, "..."+pattern.Rest.Value)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *ast.HashPattern:
+		entries := make([]string, len(pattern.Entries))
+		for i, entry := range pattern.Entries {
+			entries[i] = p.expression(entry.Key, 0, 0)
+			if !entry.IsShorthand() {
+				entries[i] += ": " + p.pattern(entry.Value)
+			}
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return pattern.String()
+	}
+}
+
+// operand prints an operand of an operator, adding parentheses if it binds
+// less tightly than precedence.
+func (p *printer) operand(expr ast.Expression, precedence int, indent int, column int) string {
+	if expressionPrecedence(expr) < precedence {
+		return "(" + p.expression(expr, indent, column+1) + ")"
+	}
+	return p.expression(expr, indent, column)
+}
+
+// expressionPrecedence returns the precedence of the operator at the root of
+// an expression. Expressions without an operator never need parentheses.
+func expressionPrecedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(expr.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		return parser.CALL
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+func (p *printer) list(open string, close string, position token.Position, exprs []ast.Expression, indent int, column int) string {
+	items := make([]func(int, int) string, len(exprs))
+	for i, expr := range exprs {
+		items[i] = func(indent int, column int) string {
+			return p.expression(expr, indent, column)
+		}
+	}
+	return p.items(open, close, position, items, indent, column)
+}
+
+// items prints a delimited, comma separated list on one line if its first
+// line fits within maxWidth and it has no comments, and otherwise with one
+// item per line and the comments between them. Position is that of either
+// of the list's brackets in the source.
+func (p *printer) items(open string, close string, position token.Position, items []func(int, int) string, indent int, column int) string {
+	flat := func() string {
+		var out bytes.Buffer
+		out.WriteString(open)
+		for i, item := range items {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(item(indent, column+lastLineWidth(out.String())))
+		}
+		out.WriteString(close)
+		return out.String()
+	}
+	b := p.brackets[position]
+	commented := b != nil && p.hasCommentBefore(b.close)
+	if p.noWrap || len(items) == 0 && !commented {
+		return flat()
+	}
+
+	// Measure the list with nested lists kept on one line, then print it
+	// again so that lists on later lines of function bodies can be split,
+	// restoring any comments consumed by the first attempt
+	if !commented {
+		comments := p.comments
+		p.noWrap = true
+		fits := column+firstLineWidth(flat()) <= maxWidth
+		p.noWrap = false
+		p.comments = comments
+		if fits {
+			return flat()
+		}
+	}
+
+	prefix := strings.Repeat("\t", indent+1)
+	var wrapped bytes.Buffer
+	wrapped.WriteString(open)
+	wrapped.WriteString("\n")
+	for i, item := range items {
+		if b != nil {
+			p.commentLines(&wrapped, p.tokenAfter(b.separator(i-1)), prefix)
+		}
+		wrapped.WriteString(prefix)
+		wrapped.WriteString(item(indent+1, (indent+1)*tabWidth))
+		if i < len(items)-1 {
+			wrapped.WriteString(",")
+		}
+		if b != nil {
+			wrapped.WriteString(p.trailingComments(p.itemEnd(b, i)))
+		}
+		wrapped.WriteString("\n")
+	}
+	if b != nil {
+		p.commentLines(&wrapped, b.close, prefix)
+	}
+	wrapped.WriteString(strings.Repeat("\t", indent))
+	wrapped.WriteString(close)
+	return wrapped.String()
+}
+
+func firstLineWidth(text string) int {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return utf8.RuneCountInString(text)
+}
+
+func lastLineWidth(text string) int {
+	i := strings.LastIndexByte(text, '\n')
+	if i < 0 {
+		return utf8.RuneCountInString(text)
+	}
+	line := text[i+1:]
+	tabs := len(line) - len(strings.TrimLeft(line, "\t"))
+	return tabs*tabWidth + utf8.RuneCountInString(line[tabs:])
+}
+
+// escape returns the body of a double quoted string literal with the given
+// value.
+func escape(value string) string {
+	var out bytes.Buffer
+	for i := 0; i < len(value); {
+		char, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case char == utf8.RuneError && size == 1:
+			fmt.Fprintf(&out, "\\x%02x", value[i])
+		case char == '\\':
+			out.WriteString(`\\`)
+		case char == '"':
+			out.WriteString(`\"`)
+		case char == '\n':
+			out.WriteString(`\n`)
+		case char == '\t':
+			out.WriteString(`\t`)
+		case char == '\r':
+			out.WriteString(`\r`)
+		case char == 0:
+			out.WriteString(`\0`)
+		case char == '$' && strings.HasPrefix(value[i+1:], "{"):
+			out.WriteString(`\$`)
+		case char < 0x20 || char == 0x7f:
+			fmt.Fprintf(&out, "\\u{%x}", char)
+		default:
+			out.WriteRune(char)
+		}
+		i += size
+	}
+	return out.String()
+}
@@ -0,0 +1,144 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"(1+2)*3; 1+(2*3); a-(b-c); (a-b)-c", "(1 + 2) * 3;\n1 + 2 * 3;\na - (b - c);\na - b - c;\n"},
+		{"-(a+b); -a[0]; (-f)(x); !(a==b); (a<b)==(c>d)", "-(a + b);\n-a[0];\n(-f)(x);\n!(a == b);\na < b == c > d;\n"},
+		{"(a+b)[0]; (a+b)(c); f(x)[1:2:-1]; a[:]", "(a + b)[0];\n(a + b)(c);\nf(x)[1:2:-1];\na[:];\n"},
+		{"0x1F+1_000+0b11", "0x1F + 1_000 + 0b11;\n"},
+		{"1.50*-2e1_0+3E-2", "1.50 * -2e1_0 + 3E-2;\n"},
+		{`"a\tb\\c\"d${x}\${y}" + "\x80\u{7}"`, `"a\tb\\c\"d${x}\${y}" + "\x80\u{7}";` + "\n"},
+		{"`raw\\n`", "`raw\\n`;\n"},
+		{"let s=\"\"\"\n  hello\n    ${name}\n  \"\"\"", "let s = \"\"\"\n  hello\n    ${name}\n  \"\"\";\n"},
+		{`"\u{41}${ x+1 }\x41"`, `"\u{41}${ x+1 }\x41";` + "\n"},
+		{"fn(){}; fn(a,b){a+b}", "fn() {};\nfn(a, b) {\n\ta + b;\n};\n"},
+		{"if(x){1}else{if(y){2}}", "if (x) {\n\t1;\n} else {\n\tif (y) {\n\t\t2;\n\t}\n}\n"},
+		{"let f=fn(x){return x;};f(1)", "let f = fn(x) {\n\treturn x;\n};\nf(1);\n"},
+		{"let unless=macro(c,x){quote(if(!unquote(c)){unquote(x)})}", "let unless = macro(c, x) {\n\tquote(if (!unquote(c)) {\n\t\tunquote(x);\n\t});\n};\n"},
+		{"{}; {1:2,\"a\":[3]}", "{};\n{1: 2, \"a\": [3]};\n"},
+		{
+			"match(x){-1=>a,[h,...t] if h>0=>t,{\"k\":v,name,age:[_]}=>v,}",
+			"match (x) {\n\t-1 => a,\n\t[h, ...t] if h > 0 => t,\n\t{\"k\": v, name, age: [_]} => v\n}\n",
+		},
+		{"let [a,b,...r]=xs;let {name,age:[y]}=p", "let [a, b, ...r] = xs;\nlet {name, age: [y]} = p;\n"},
+		{"fn([a,_],{\"k\":v},c){a}", "fn([a, _], {\"k\": v}, c) {\n\ta;\n};\n"},
+		{"let f=fn(x,y=1+2,...r){r};f(1,...xs,y:2)", "let f = fn(x, y = 1 + 2, ...r) {\n\tr;\n};\nf(1, ...xs, y: 2);\n"},
+		{"let y = match (x) { _ => fn() { 1 } };", "let y = match (x) {\n\t_ => fn() {\n\t\t1;\n\t}\n};\n"},
+		{"let x = 1;\n\n\n\nlet y = 2;\nlet z = 3;", "let x = 1;\n\nlet y = 2;\nlet z = 3;\n"},
+		{
+			"let h = {\"name\": \"Monkey\", \"age\": 1, \"nested\": {\"a\": [1, 2, 3]}, \"long key\": \"value\"}",
+			"let h = {\n\t\"name\": \"Monkey\",\n\t\"age\": 1,\n\t\"nested\": {\"a\": [1, 2, 3]},\n\t\"long key\": \"value\"\n};\n",
+		},
+		{
+			"puts(add(1, 2), add(3, 4), add(5, 6), add(7, 8), add(9, 10), add(11, 12), add(13, 14))",
+			"puts(\n\tadd(1, 2),\n\tadd(3, 4),\n\tadd(5, 6),\n\tadd(7, 8),\n\tadd(9, 10),\n\tadd(11, 12),\n\tadd(13, 14)\n);\n",
+		},
+		{
+			"map(xs, fn(x) { [x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x, x] })",
+			"map(xs, fn(x) {\n\t[\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx,\n\t\tx\n\t];\n});\n",
+		},
+		{"// header\n\nlet x = 1; // one\n// before y\nlet y = 2;\n// end", "// header\n\nlet x = 1; // one\n// before y\nlet y = 2;\n// end\n"},
+		{"let f = fn() {\n  // inside\n  1\n}", "let f = fn() {\n\t// inside\n\t1;\n};\n"},
+		{"let a = [1, // one\n 2];", "let a = [\n\t1, // one\n\t2\n];\n"},
+		{"let f = fn() {\n  1\n  // end\n};\nf()", "let f = fn() {\n\t1;\n\t// end\n};\nf();\n"},
+		{"if (x) {\n  // todo\n}", "if (x) {\n\t// todo\n}\n"},
+		{"let h = {\n \"a\": 1, // one\n \"b\": 2\n};", "let h = {\n\t\"a\": 1, // one\n\t\"b\": 2\n};\n"},
+		{
+			"f(\n  // first\n  1,\n  [2, // two\n  3] // rest\n  // last\n)",
+			"f(\n\t// first\n\t1,\n\t[\n\t\t2, // two\n\t\t3\n\t] // rest\n\t// last\n);\n",
+		},
+		{"let add = fn(a, b) { a + b }; // trailing", "let add = fn(a, b) {\n\ta + b;\n}; // trailing\n"},
+		{"let x = 1; let y = 2; // y", "let x = 1;\nlet y = 2; // y\n"},
+		{
+			"match (x) {\n  [a, b] => a, // pair\n  // otherwise\n  _ => 0 // none\n}",
+			"match (x) {\n\t[a, b] => a, // pair\n\t// otherwise\n\t_ => 0 // none\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := Source(test.input)
+		if err != nil {
+			t.Errorf("formatting %q returned error %v", test.input, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("formatting %q\nexpected:\n%s\ngot:\n%s", test.input, test.expected, actual)
+			continue
+		}
+		testIdempotent(t, actual)
+		testEquivalent(t, test.input, actual)
+	}
+}
+
+func TestSourceStatementBoundaries(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (x) { 1 };\n-1;", "if (x) {\n\t1;\n};\n-1;\n"},
+		{"if (x) { 1 } else { 2 }; (f + g)(y); (f)(y)", "if (x) {\n\t1;\n} else {\n\t2;\n};\n(f + g)(y);\nf(y);\n"},
+		{"match (x) { _ => 1 }; [a] // a\n", "match (x) {\n\t_ => 1\n};\n[a]; // a\n"},
+		{"let f = fn() { if (x) { 1 }; -y };", "let f = fn() {\n\tif (x) {\n\t\t1;\n\t};\n\t-y;\n};\n"},
+		{"if (x) { 1 }; let y = 2; if (y) { 3 }", "if (x) {\n\t1;\n}\nlet y = 2;\nif (y) {\n\t3;\n}\n"},
+	}
+
+	for _, test := range tests {
+		actual, err := Source(test.input)
+		if err != nil {
+			t.Errorf("formatting %q returned error %v", test.input, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("formatting %q\nexpected:\n%s\ngot:\n%s", test.input, test.expected, actual)
+		}
+		testIdempotent(t, actual)
+		testEquivalent(t, test.input, actual)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("let = 1;\nlet x = ;")
+	if err == nil {
+		t.Fatalf("expected parse errors")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "1:5:") || !strings.HasPrefix(lines[1], "2:9:") {
+		t.Fatalf("expected both parse errors to be reported, got %q", err.Error())
+	}
+}
+
+func testIdempotent(t *testing.T, formatted string) {
+	t.Helper()
+	again, err := Source(formatted)
+	if err != nil {
+		t.Errorf("formatting output %q returned error %v", formatted, err)
+	} else if again != formatted {
+		t.Errorf("formatting is not idempotent\nfirst:\n%s\nsecond:\n%s", formatted, again)
+	}
+}
+
+// testEquivalent checks the formatted program has the same syntax tree as
+// the input, comparing their fully parenthesised String() output.
+func testEquivalent(t *testing.T, input string, formatted string) {
+	t.Helper()
+	if parse(input) != parse(formatted) {
+		t.Errorf("formatting changed the meaning of %q\nexpected: %s\ngot: %s", input, parse(input), parse(formatted))
+	}
+}
+
+func parse(input string) string {
+	return parser.New(lexer.New(input)).ParseProgram().String()
+}
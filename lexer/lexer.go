@@ -1,42 +1,77 @@
 package lexer
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"danielmcm.com/interpreterbook/token"
 )
 
 type Lexer struct {
 	input string
-	// current position in input
+	// byte offset of the current character in input
 	position int
-	// current reading position in input
+	// byte offset of the character after the current one
 	readPosition int
-	// current character
-	char byte
+	// current character, decoded from UTF-8
+	char rune
+	// line and column of the current character
+	line   int
+	column int
+	// comments skipped so far
+	comments []Comment
+}
+
+// Comment is a `//` comment, running to the end of the line.
+type Comment struct {
+	Position token.Position
+	Text     string
 }
 
 var ErrLexer error = errors.New("tokenisation error")
 
+// Error is a tokenisation error at a position in the input. It wraps
+// ErrLexer.
+type Error struct {
+	Position token.Position
+	reason   string
+}
+
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	return NewAt(input, token.Position{Line: 1, Column: 1})
+}
+
+// NewAt creates a lexer for input found at a position in a larger source,
+// such as an interpolation in a string literal, so that its tokens and
+// errors give positions in that source.
+func NewAt(input string, position token.Position) *Lexer {
+	lexer := &Lexer{input: input, line: position.Line, column: position.Column - 1}
 	lexer.readChar()
 	return lexer
 }
 
+// NextToken returns the next token in the input. If the token is malformed,
+// an ILLEGAL token covering its text is returned along with an *Error, and
+// lexing can continue after it.
 func (lexer *Lexer) NextToken() (token.Token, error) {
 	var nextToken token.Token
 	var err error
 
-	lexer.readMatching(isWhitespace)
+	lexer.skipWhitespaceAndComments()
+	start := lexer.position
+	position := token.Position{Line: lexer.line, Column: lexer.column}
 
 	switch lexer.char {
 	case '=':
 		if lexer.peekChar() == '=' {
 			lexer.readChar()
 			nextToken = token.Token{Type: token.EQ, Literal: "=="}
+		} else if lexer.peekChar() == '>' {
+			lexer.readChar()
+			nextToken = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			nextToken = token.Token{Type: token.ASSIGN, Literal: string(lexer.char)}
 		}
@@ -78,39 +113,102 @@ func (lexer *Lexer) NextToken() (token.Token, error) {
 		nextToken = token.Token{Type: token.LBRACKET, Literal: string(lexer.char)}
 	case ']':
 		nextToken = token.Token{Type: token.RBRACKET, Literal: string(lexer.char)}
+	case '.':
+		if strings.HasPrefix(lexer.input[lexer.position:], "...") {
+			lexer.readChar()
+			lexer.readChar()
+			nextToken = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			nextToken = token.Token{Type: token.ILLEGAL, Literal: string(lexer.char)}
+		}
 	case '"':
-		nextToken, err = lexer.readString()
+		if strings.HasPrefix(lexer.input[lexer.position:], `"""`) {
+			nextToken, err = lexer.readMultilineString()
+		} else {
+			nextToken, err = lexer.readString()
+		}
+	case '`':
+		nextToken, err = lexer.readRawString()
 	case 0:
 		nextToken = token.Token{Type: token.EOF, Literal: ""}
 	default:
 		if isLetter(lexer.char) {
 			identifier := lexer.readMatching(isLetter)
-			return token.Token{Type: token.LookupIdentifier(identifier), Literal: identifier}, nil
+			nextToken = token.Token{Type: token.LookupIdentifier(identifier), Literal: identifier}
+			return lexer.finishToken(nextToken, start, position, nil)
 		} else if isDigit(lexer.char) {
-			return token.Token{Type: token.INT, Literal: lexer.readMatching(isDigit)}, nil
+			nextToken, err = lexer.readNumber()
+			return lexer.finishToken(nextToken, start, position, err)
 		} else {
 			nextToken = token.Token{Type: token.ILLEGAL, Literal: string(lexer.char)}
 		}
 	}
 	lexer.readChar()
-	return nextToken, err
+	return lexer.finishToken(nextToken, start, position, err)
+}
+
+// Comments returns the comments in the input read so far, in order.
+func (lexer *Lexer) Comments() []Comment {
+	return lexer.comments
+}
+
+func (lexer *Lexer) skipWhitespaceAndComments() {
+	lexer.readMatching(isWhitespace)
+	for lexer.char == '/' && lexer.peekChar() == '/' {
+		position := token.Position{Line: lexer.line, Column: lexer.column}
+		text := lexer.readMatching(func(char rune) bool { return char != '\n' })
+		lexer.comments = append(lexer.comments, Comment{Position: position, Text: strings.TrimRight(text, " \t\r")})
+		lexer.readMatching(isWhitespace)
+	}
+}
+
+// finishToken sets the position of a token, replacing it with an ILLEGAL
+// token if it could not be read.
+func (lexer *Lexer) finishToken(nextToken token.Token, start int, position token.Position, err error) (token.Token, error) {
+	if err != nil {
+		illegal := token.Token{Type: token.ILLEGAL, Literal: lexer.input[start:lexer.position], Position: position}
+		return illegal, &Error{Position: position, reason: err.Error()}
+	}
+	nextToken.Position = position
+	if nextToken.Type == token.STRING || nextToken.Type == token.INTERPOLATED_STRING {
+		nextToken.Raw = lexer.input[start:lexer.position]
+	}
+	return nextToken, nil
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Position, err.reason)
+}
+
+func (err *Error) Unwrap() error {
+	return ErrLexer
 }
 
 func (lexer *Lexer) readChar() {
-	lexer.char = lexer.peekChar()
+	if lexer.char == '\n' {
+		lexer.line++
+		lexer.column = 0
+	}
+	lexer.column++
 	lexer.position = lexer.readPosition
-	lexer.readPosition += 1
+	if lexer.readPosition >= len(lexer.input) {
+		lexer.char = 0
+		return
+	}
+	char, width := utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+	lexer.char = char
+	lexer.readPosition += width
 }
 
-func (lexer *Lexer) peekChar() byte {
+func (lexer *Lexer) peekChar() rune {
 	if lexer.readPosition >= len(lexer.input) {
 		return 0
-	} else {
-		return lexer.input[lexer.readPosition]
 	}
+	char, _ := utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+	return char
 }
 
-func (lexer *Lexer) readMatching(predicate func(byte) bool) string {
+func (lexer *Lexer) readMatching(predicate func(rune) bool) string {
 	position := lexer.position
 	if position >= len(lexer.input) {
 		return ""
@@ -121,39 +219,83 @@ func (lexer *Lexer) readMatching(predicate func(byte) bool) string {
 	return lexer.input[position:lexer.position]
 }
 
-func isLetter(char byte) bool {
-	return ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z') || char == '_'
+// isLetter reports whether char may appear in an identifier.
+func isLetter(char rune) bool {
+	return char == '_' || unicode.IsLetter(char)
 }
 
-func isDigit(char byte) bool {
+func isDigit(char rune) bool {
 	return '0' <= char && char <= '9'
 }
 
-func isWhitespace(char byte) bool {
+func isOctalDigit(char rune) bool {
+	return '0' <= char && char <= '7'
+}
+
+func isBinaryDigit(char rune) bool {
+	return char == '0' || char == '1'
+}
+
+func isWhitespace(char rune) bool {
 	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
 }
 
-func (lexer *Lexer) readString() (token.Token, error) {
-	var literal bytes.Buffer
-	for {
+// readNumber reads an integer literal, which may have a 0x, 0o or 0b prefix
+// and use underscores to separate digits, or a decimal float literal with a
+// fraction, an exponent or both, as in 1.5, 1e3 or 2.5e-3.
+func (lexer *Lexer) readNumber() (token.Token, error) {
+	start := lexer.position
+	isBaseDigit, base := isDigit, "decimal"
+	if lexer.char == '0' {
+		switch lexer.peekChar() {
+		case 'x', 'X':
+			isBaseDigit, base = isHexDigit, "hexadecimal"
+		case 'o', 'O':
+			isBaseDigit, base = isOctalDigit, "octal"
+		case 'b', 'B':
+			isBaseDigit, base = isBinaryDigit, "binary"
+		}
+		if base != "decimal" {
+			lexer.readChar()
+			lexer.readChar()
+		}
+	}
+	digits := lexer.readMatching(func(char rune) bool {
+		return isBaseDigit(char) || char == '_'
+	})
+	groups := []string{digits}
+	tokenType := token.TokenType(token.INT)
+	if base == "decimal" && lexer.char == '.' && isDigit(lexer.peekChar()) {
 		lexer.readChar()
-		char := lexer.char
-		if char == '"' {
-			break
-		} else if char == '\\' {
+		groups = append(groups, lexer.readMatching(func(char rune) bool {
+			return isDigit(char) || char == '_'
+		}))
+		tokenType, base = token.FLOAT, "float"
+	}
+	if (base == "decimal" || base == "float") && (lexer.char == 'e' || lexer.char == 'E') {
+		lexer.readChar()
+		if lexer.char == '+' || lexer.char == '-' {
 			lexer.readChar()
-			char = lexer.char
-			switch char {
-			case 'n':
-				char = '\n'
-			case 't':
-				char = '\t'
-			}
 		}
-		if char == 0 {
-			return token.Token{}, fmt.Errorf("unterminated string literal")
+		groups = append(groups, lexer.readMatching(func(char rune) bool {
+			return isDigit(char) || char == '_'
+		}))
+		tokenType, base = token.FLOAT, "float"
+	}
+	if isLetter(lexer.char) || isDigit(lexer.char) {
+		lexer.readMatching(func(char rune) bool {
+			return isLetter(char) || isDigit(char)
+		})
+		return token.Token{}, fmt.Errorf("invalid %s literal %q", base, lexer.input[start:lexer.position])
+	}
+	literal := lexer.input[start:lexer.position]
+	for _, digits := range groups {
+		if len(digits) == 0 {
+			return token.Token{}, fmt.Errorf("invalid %s literal %q, expected digits", base, literal)
+		}
+		if digits[0] == '_' || digits[len(digits)-1] == '_' || strings.Contains(digits, "__") {
+			return token.Token{}, fmt.Errorf("invalid %s literal %q, '_' must separate digits", base, literal)
 		}
-		literal.WriteByte(char)
 	}
-	return token.Token{Type: token.STRING, Literal: literal.String()}, nil
+	return token.Token{Type: tokenType, Literal: literal}, nil
 }
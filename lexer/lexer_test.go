@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"danielmcm.com/interpreterbook/token"
@@ -29,6 +31,7 @@ func TestNextToken(t *testing.T) {
 
 	["foo bar", "{\"abc\": \"x\ty\n1\t2\n\"}"];
 	{1:2};
+	match (x) { [_, ...y] => y };
 	`
 
 	tests := []struct {
@@ -120,6 +123,21 @@ func TestNextToken(t *testing.T) {
 		{token.INT, "2"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "_"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "y"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "y"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -165,10 +183,290 @@ func TestErrors(t *testing.T) {
 		{"\"", "unterminated string"},
 		{"\"\\\"", "unterminated string"},
 		{"let x = \"hello ;", "unterminated string"},
+		{`"\u0041"`, "invalid unicode escape"},
+		{`"\u{}"`, "expected 1 to 6 hex digits"},
+		{`"\u{1234567}"`, "expected 1 to 6 hex digits"},
+		{`"\u{12"`, "expected } after hex digits"},
+		{`"\u{D800}"`, "not a valid code point"},
+		{`"\u{110000}"`, "not a valid code point"},
+		{`"\q"`, "unknown escape sequence \\q"},
+		{`"\é"`, "unknown escape sequence \\é"},
+		{`"\x4"`, "invalid byte escape"},
+		{`"\xZZ"`, "invalid byte escape"},
+		{"`abc", "unterminated string"},
+		{`"""abc""`, "unterminated string"},
+		{`"""\q"""`, "unknown escape sequence"},
+		{"0x", "invalid hexadecimal literal \"0x\", expected digits"},
+		{"0b;", "invalid binary literal \"0b\", expected digits"},
+		{"12abc", "invalid decimal literal \"12abc\""},
+		{"0x1G", "invalid hexadecimal literal \"0x1G\""},
+		{"0b102", "invalid binary literal \"0b102\""},
+		{"0o8", "invalid octal literal \"0o8\""},
+		{"1__000", "'_' must separate digits"},
+		{"1_", "'_' must separate digits"},
+		{"0x_1", "'_' must separate digits"},
+		{"1.5x", "invalid float literal \"1.5x\""},
+		{"1e", "invalid float literal \"1e\", expected digits"},
+		{"2.5e+;", "invalid float literal \"2.5e+\", expected digits"},
+		{"1.5_", "'_' must separate digits"},
+		{"1e_3", "'_' must separate digits"},
+		{`"${x"`, "unterminated string"},
+		{`"${"}"`, "unterminated string"},
 	}
 
 	for _, test := range tests {
 		lexer := New(test.input)
-		lexer.NextToken()
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			_, err = lexer.NextToken()
+		}
+		if err == nil || !strings.Contains(err.Error(), test.pattern) {
+			t.Errorf("expected lexing %q to return error matching %q, got %v", test.input, test.pattern, err)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let café = "héllo 日本 \u{1F600}\u{e9}"; ünïcödé_ident ≠`
+
+	tests := []struct {
+		tokenType token.TokenType
+		literal   string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "café"},
+		{token.ASSIGN, "="},
+		{token.STRING, "héllo 日本 \U0001F600é"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "ünïcödé_ident"},
+		{token.ILLEGAL, "≠"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, expected := range tests {
+		tok, err := lexer.NextToken()
+		if err != nil {
+			t.Fatalf("tests[%d] - received error %v", i, err)
+		}
+		if tok.Type != expected.tokenType || tok.Literal != expected.literal {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q", i, expected.tokenType, expected.literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"\\ \" \0"`, "\\ \" \x00"},
+		{`"\x41\x7a\xff"`, "Az\xff"},
+		{`"\u{41}\u{1F600}"`, "A\U0001F600"},
+		{"`raw \\n \"quoted\" ${x}`", `raw \n "quoted" ${x}`},
+		{"`multi\nline`", "multi\nline"},
+		{`""`, ""},
+		{`""""""`, ""},
+		{`"""single "line" \t"""`, "single \"line\" \t"},
+		{"\"\"\"\n    first\n      indented\n\n    last\n    \"\"\"", "first\n  indented\n\nlast"},
+		{"\"\"\"\n\tkeep\\n\n\ttabs\n\"\"\"", "keep\n\ntabs"},
+		{"\"\"\"\n  a\n b\"\"\"", " a\nb"},
+		{"\"\"\"\r\n  crlf\r\n  \"\"\"", "crlf"},
+		{"\"\"\"\n  escaped \\\"\"\" quote\n  \"\"\"", "escaped \"\"\" quote"},
+	}
+
+	for _, test := range tests {
+		lexer := New(test.input)
+		tok, err := lexer.NextToken()
+		if err != nil {
+			t.Errorf("lexing %q returned error %v", test.input, err)
+			continue
+		}
+		if tok.Type != token.STRING || tok.Literal != test.expected {
+			t.Errorf("lexing %q - expected STRING %q, got %s %q", test.input, test.expected, tok.Type, tok.Literal)
+			continue
+		}
+		if next, err := lexer.NextToken(); err != nil || next.Type != token.EOF {
+			t.Errorf("lexing %q - expected EOF after string, got %v error %v", test.input, next, err)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		literal  string
+		expected []StringPart
+	}{
+		{`"a ${b} c"`, `a ${b} c`, []StringPart{{Text: "a "}, {Source: "b", IsExpression: true, Offset: 4}, {Text: " c"}}},
+		{`"${x}${y}"`, `${x}${y}`, []StringPart{{Source: "x", IsExpression: true, Offset: 2}, {Source: "y", IsExpression: true, Offset: 6}}},
+		{`"\t${ {"a": "}"}["a"] }\n"`, `\t${ {"a": "}"}["a"] }\n`, []StringPart{{Text: "\t"}, {Source: ` {"a": "}"}["a"] `, IsExpression: true, Offset: 4}, {Text: "\n"}}},
+		{`"${"inner ${x}"}"`, `${"inner ${x}"}`, []StringPart{{Source: `"inner ${x}"`, IsExpression: true, Offset: 2}}},
+		{"\"${`}`}\"", "${`}`}", []StringPart{{Source: "`}`", IsExpression: true, Offset: 2}}},
+		{`"""${a}"""`, `${a}`, []StringPart{{Source: "a", IsExpression: true, Offset: 2}}},
+	}
+
+	for _, test := range tests {
+		lexer := New(test.input)
+		tok, err := lexer.NextToken()
+		if err != nil {
+			t.Errorf("lexing %q returned error %v", test.input, err)
+			continue
+		}
+		if tok.Type != token.INTERPOLATED_STRING || tok.Literal != test.literal {
+			t.Errorf("lexing %q - expected INTERPOLATED_STRING %q, got %s %q", test.input, test.literal, tok.Type, tok.Literal)
+			continue
+		}
+		parts, err := SplitInterpolatedString(tok.Literal)
+		if err != nil {
+			t.Errorf("splitting %q returned error %v", tok.Literal, err)
+			continue
+		}
+		if len(parts) != len(test.expected) {
+			t.Errorf("splitting %q - expected %d parts, got %+v", tok.Literal, len(test.expected), parts)
+			continue
+		}
+		for i, part := range parts {
+			if part != test.expected[i] {
+				t.Errorf("splitting %q - expected part %d to be %+v, got %+v", tok.Literal, i, test.expected[i], part)
+			}
+		}
+	}
+}
+
+func TestEscapedInterpolation(t *testing.T) {
+	for _, input := range []string{`"\${x}"`, "`${x}`", `"$x {x}"`} {
+		tok, err := New(input).NextToken()
+		if err != nil || tok.Type != token.STRING {
+			t.Errorf("expected %s to lex as a plain STRING, got %v error %v", input, tok, err)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := map[token.TokenType][]string{
+		token.INT:   {"0", "42", "007", "1_000_000", "0x1F", "0XfF", "0o17", "0O7", "0b1010", "0B1", "0xdead_beef", "0x1e5"},
+		token.FLOAT: {"1.5", "0.25", "007.0", "1e3", "1E-3", "2.5e+10", "1_000.000_1"},
+	}
+
+	for tokenType, inputs := range tests {
+		for _, input := range inputs {
+			testNumberLiteral(t, input, tokenType)
+		}
+	}
+
+	// a dot not followed by a digit is not part of the number
+	lexer := New("1...")
+	if tok, err := lexer.NextToken(); err != nil || tok.Type != token.INT {
+		t.Errorf("expected INT, got %v error %v", tok, err)
+	}
+	if tok, err := lexer.NextToken(); err != nil || tok.Type != token.ELLIPSIS {
+		t.Errorf("expected ELLIPSIS, got %v error %v", tok, err)
+	}
+}
+
+func TestFloatTokens(t *testing.T) {
+	lexer := New("[1.5, 2e3]-0.25*x")
+	expected := []token.Token{
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.FLOAT, Literal: "1.5"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.FLOAT, Literal: "2e3"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.FLOAT, Literal: "0.25"},
+		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.EOF, Literal: ""},
+	}
+	for i, want := range expected {
+		tok, err := lexer.NextToken()
+		if err != nil || tok.Type != want.Type || tok.Literal != want.Literal {
+			t.Fatalf("token %d: expected %s %q, got %v error %v", i, want.Type, want.Literal, tok, err)
+		}
+	}
+}
+
+func testNumberLiteral(t *testing.T, input string, tokenType token.TokenType) {
+	t.Helper()
+	lexer := New(input + ";")
+	tok, err := lexer.NextToken()
+	if err != nil || tok.Type != tokenType || tok.Literal != input {
+		t.Errorf("expected %s to lex as %s, got %v error %v", input, tokenType, tok, err)
+		return
+	}
+	if next, err := lexer.NextToken(); err != nil || next.Type != token.SEMICOLON {
+		t.Errorf("expected SEMICOLON after %s, got %v error %v", input, next, err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := "let x = 5;\n  \"é\" +\n\t`a\nb` y\n12abc z"
+
+	tests := []struct {
+		literal  string
+		position token.Position
+	}{
+		{"let", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"5", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 10}},
+		{"é", token.Position{Line: 2, Column: 3}},
+		{"+", token.Position{Line: 2, Column: 7}},
+		{"a\nb", token.Position{Line: 3, Column: 2}},
+		{"y", token.Position{Line: 4, Column: 4}},
+		{"12abc", token.Position{Line: 5, Column: 1}},
+		{"z", token.Position{Line: 5, Column: 7}},
+	}
+
+	lexer := New(input)
+	for i, expected := range tests {
+		tok, err := lexer.NextToken()
+		if expected.literal == "12abc" {
+			var errLexer *Error
+			if !errors.As(err, &errLexer) || !errors.Is(err, ErrLexer) || errLexer.Position != expected.position {
+				t.Fatalf("tests[%d] - expected lexer error at %s, got %v", i, expected.position, err)
+			}
+			if tok.Type != token.ILLEGAL {
+				t.Fatalf("tests[%d] - expected ILLEGAL token, got %s", i, tok.Type)
+			}
+		} else if err != nil {
+			t.Fatalf("tests[%d] - received error %v", i, err)
+		}
+		if tok.Literal != expected.literal || tok.Position != expected.position {
+			t.Fatalf("tests[%d] - expected %q at %s, got %q at %s", i, expected.literal, expected.position, tok.Literal, tok.Position)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading\nlet x = 5; // trailing  \n  //indented\nx / 2 // last"
+
+	expectedTokens := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.IDENT, token.SLASH, token.INT, token.EOF}
+	lexer := New(input)
+	for i, expected := range expectedTokens {
+		tok, err := lexer.NextToken()
+		if err != nil || tok.Type != expected {
+			t.Fatalf("tests[%d] - expected %s, got %v error %v", i, expected, tok, err)
+		}
+	}
+
+	expectedComments := []Comment{
+		{Position: token.Position{Line: 1, Column: 1}, Text: "// leading"},
+		{Position: token.Position{Line: 2, Column: 12}, Text: "// trailing"},
+		{Position: token.Position{Line: 3, Column: 3}, Text: "//indented"},
+		{Position: token.Position{Line: 4, Column: 7}, Text: "// last"},
+	}
+	comments := lexer.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("expected %d comments, got %+v", len(expectedComments), comments)
+	}
+	for i, comment := range comments {
+		if comment != expectedComments[i] {
+			t.Errorf("expected comment %+v, got %+v", expectedComments[i], comment)
+		}
 	}
 }
@@ -0,0 +1,300 @@
+package lexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"danielmcm.com/interpreterbook/token"
+)
+
+var errUnterminatedString = errors.New("unterminated string literal")
+
+// StringPart is a piece of an interpolated string literal: either text,
+// with escape sequences processed, or the source of an embedded expression.
+type StringPart struct {
+	Text         string
+	Source       string
+	IsExpression bool
+	// Offset is where Source starts in the literal, in bytes
+	Offset int
+}
+
+// readString reads a double quoted string, leaving the lexer on the closing
+// quote.
+func (lexer *Lexer) readString() (token.Token, error) {
+	start := lexer.position + 1
+	interpolated, err := lexer.scanString(`"`)
+	if err != nil {
+		return token.Token{}, err
+	}
+	return makeStringToken(lexer.input[start:lexer.position], interpolated)
+}
+
+// readRawString reads a backtick quoted string, in which backslashes have no
+// special meaning, leaving the lexer on the closing backtick.
+func (lexer *Lexer) readRawString() (token.Token, error) {
+	start := lexer.position + 1
+	if err := lexer.scanRawString(); err != nil {
+		return token.Token{}, err
+	}
+	return token.Token{Type: token.STRING, Literal: lexer.input[start:lexer.position]}, nil
+}
+
+// readMultilineString reads a string delimited by triple quotes, leaving the
+// lexer on the last closing quote. The text is dedented before escape
+// sequences are processed.
+func (lexer *Lexer) readMultilineString() (token.Token, error) {
+	lexer.readChar()
+	lexer.readChar()
+	start := lexer.position + 1
+	interpolated, err := lexer.scanString(`"""`)
+	if err != nil {
+		return token.Token{}, err
+	}
+	raw := lexer.input[start:lexer.position]
+	lexer.readChar()
+	lexer.readChar()
+	return makeStringToken(dedent(raw), interpolated)
+}
+
+// makeStringToken creates the token for the body of a quoted string.
+// Interpolated strings keep their escape sequences so that they can be split
+// with SplitInterpolatedString.
+func makeStringToken(raw string, interpolated bool) (token.Token, error) {
+	if interpolated {
+		return token.Token{Type: token.INTERPOLATED_STRING, Literal: raw}, nil
+	}
+	literal, err := unescape(raw)
+	if err != nil {
+		return token.Token{}, err
+	}
+	return token.Token{Type: token.STRING, Literal: literal}, nil
+}
+
+// scanString advances to the start of the closing delimiter of a quoted
+// string, reporting whether the string contains any interpolations.
+func (lexer *Lexer) scanString(closing string) (bool, error) {
+	interpolated := false
+	for {
+		lexer.readChar()
+		if lexer.char == '\\' {
+			lexer.readChar()
+		} else if strings.HasPrefix(lexer.input[lexer.position:], closing) {
+			return interpolated, nil
+		} else if lexer.char == '$' && lexer.peekChar() == '{' {
+			if err := lexer.scanInterpolation(); err != nil {
+				return false, err
+			}
+			interpolated = true
+		}
+		if lexer.char == 0 {
+			return false, errUnterminatedString
+		}
+	}
+}
+
+func (lexer *Lexer) scanRawString() error {
+	for {
+		lexer.readChar()
+		if lexer.char == '`' {
+			return nil
+		} else if lexer.char == 0 {
+			return errUnterminatedString
+		}
+	}
+}
+
+// scanInterpolation advances from the `$` starting an interpolation to its
+// closing brace, skipping over nested blocks and string literals.
+func (lexer *Lexer) scanInterpolation() error {
+	lexer.readChar()
+	depth := 1
+	for depth > 0 {
+		lexer.readChar()
+		switch lexer.char {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			closing := `"`
+			if strings.HasPrefix(lexer.input[lexer.position:], `"""`) {
+				closing = `"""`
+				lexer.readChar()
+				lexer.readChar()
+			}
+			if _, err := lexer.scanString(closing); err != nil {
+				return err
+			}
+			for i := 1; i < len(closing); i++ {
+				lexer.readChar()
+			}
+		case '`':
+			if err := lexer.scanRawString(); err != nil {
+				return err
+			}
+		case 0:
+			return errUnterminatedString
+		}
+	}
+	return nil
+}
+
+// SplitInterpolatedString splits the literal of an INTERPOLATED_STRING token
+// into text and embedded expression source.
+func SplitInterpolatedString(raw string) ([]StringPart, error) {
+	lexer := New(raw)
+	parts := make([]StringPart, 0)
+	textStart := 0
+	addText := func(end int) error {
+		if end == textStart {
+			return nil
+		}
+		text, err := unescape(raw[textStart:end])
+		if err != nil {
+			return err
+		}
+		parts = append(parts, StringPart{Text: text})
+		return nil
+	}
+
+	for lexer.char != 0 {
+		if lexer.char == '\\' {
+			lexer.readChar()
+		} else if lexer.char == '$' && lexer.peekChar() == '{' {
+			if err := addText(lexer.position); err != nil {
+				return nil, err
+			}
+			sourceStart := lexer.position + 2
+			if err := lexer.scanInterpolation(); err != nil {
+				return nil, err
+			}
+			parts = append(parts, StringPart{Source: raw[sourceStart:lexer.position], IsExpression: true, Offset: sourceStart})
+			textStart = lexer.position + 1
+		}
+		lexer.readChar()
+	}
+	if err := addText(len(raw)); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// dedent removes the line break following an opening triple quote, the
+// whitespace preceding a closing triple quote on its own line, and the
+// indentation common to every non-blank line.
+func dedent(raw string) string {
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "\r"), "\n")
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	lines := strings.Split(raw, "\n")
+	if len(lines) > 1 && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if isBlank(line) {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent = lineIndent
+			first = false
+			continue
+		}
+		for !strings.HasPrefix(lineIndent, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+
+	for i, line := range lines {
+		if isBlank(line) {
+			lines[i] = ""
+		} else {
+			lines[i] = line[len(indent):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimLeft(line, " \t") == ""
+}
+
+// unescape processes the escape sequences in the body of a quoted string.
+func unescape(raw string) (string, error) {
+	var literal bytes.Buffer
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			literal.WriteByte(raw[i])
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return "", errUnterminatedString
+		}
+		switch raw[i] {
+		case 'n':
+			literal.WriteByte('\n')
+		case 't':
+			literal.WriteByte('\t')
+		case 'r':
+			literal.WriteByte('\r')
+		case '0':
+			literal.WriteByte(0)
+		case '\\', '"', '$':
+			literal.WriteByte(raw[i])
+		case 'x':
+			if i+2 >= len(raw) || !isHexDigit(rune(raw[i+1])) || !isHexDigit(rune(raw[i+2])) {
+				return "", fmt.Errorf("invalid byte escape, expected \\x followed by 2 hex digits")
+			}
+			value, _ := strconv.ParseUint(raw[i+1:i+3], 16, 8)
+			literal.WriteByte(byte(value))
+			i += 2
+		case 'u':
+			char, length, err := parseUnicodeEscape(raw[i+1:])
+			if err != nil {
+				return "", err
+			}
+			literal.WriteRune(char)
+			i += length
+		default:
+			char, _ := utf8.DecodeRuneInString(raw[i:])
+			return "", fmt.Errorf("unknown escape sequence \\%c", char)
+		}
+	}
+	return literal.String(), nil
+}
+
+// parseUnicodeEscape parses the `{XXXX}` following `\u`, returning the code
+// point and the number of bytes consumed.
+func parseUnicodeEscape(text string) (rune, int, error) {
+	if !strings.HasPrefix(text, "{") {
+		return 0, 0, fmt.Errorf("invalid unicode escape, expected \\u{...}")
+	}
+	end := 1
+	for end < len(text) && isHexDigit(rune(text[end])) {
+		end++
+	}
+	if end >= len(text) || text[end] != '}' {
+		return 0, 0, fmt.Errorf("invalid unicode escape, expected } after hex digits")
+	}
+	digits := text[1:end]
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, 0, fmt.Errorf("invalid unicode escape \\u{%s}, expected 1 to 6 hex digits", digits)
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, 0, fmt.Errorf("invalid unicode escape \\u{%s}, not a valid code point", digits)
+	}
+	return rune(value), end + 1, nil
+}
+
+func isHexDigit(char rune) bool {
+	return isDigit(char) || ('a' <= char && char <= 'f') || ('A' <= char && char <= 'F')
+}
@@ -0,0 +1,584 @@
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/token"
+)
+
+type Severity int
+
+const (
+	// Error is a problem that will fail at runtime if the code is reached.
+	Error Severity = iota
+	// Warning is likely to be a mistake, but is not an error.
+	Warning
+)
+
+func (severity Severity) String() string {
+	if severity == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Rules reported by the linter.
+const (
+	Undefined         = "undefined"
+	Unused            = "unused"
+	Shadow            = "shadow"
+	Arity             = "arity"
+	Unreachable       = "unreachable"
+	ConstantCondition = "constant-condition"
+)
+
+// Diagnostic is a problem found in a program.
+type Diagnostic struct {
+	Position token.Position
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Position, d.Severity, d.Message, d.Rule)
+}
+
+// Source checks a Monkey program. An error is returned if the program
+// cannot be parsed.
+func Source(source string, builtins map[string]*object.Builtin) ([]Diagnostic, error) {
+	parser := parser.New(lexer.New(source))
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return Program(program, builtins), nil
+}
+
+// Program checks a parsed program, returning its diagnostics ordered by
+// position. Builtins, which may be nil, are the functions defined for the
+// program besides the evaluator's, such as the tester's.
+//
+// Blocks do not introduce scopes in Monkey, so each function literal and the
+// program itself form a scope holding their parameters and every let
+// statement they contain. Function bodies may refer to names bound later in
+// an enclosing scope, as those are bound by the time the function is called.
+func Program(program *ast.Program, builtins map[string]*object.Builtin) []Diagnostic {
+	linter := &linter{builtins: builtins}
+	linter.program(program)
+	sort.SliceStable(linter.diagnostics, func(i, j int) bool {
+		a, b := linter.diagnostics[i].Position, linter.diagnostics[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return linter.diagnostics
+}
+
+// Definition is the binding of a name by a let statement, a function or
+// macro parameter, or a match arm's pattern.
+type Definition struct {
+	// Name is the identifier in the let statement or parameter list, which
+	// may be in a pattern destructuring the value
+	Name *ast.Identifier
+	// Let is the first let statement binding the name, or nil for a
+	// parameter
+	Let *ast.LetStatement
+	// Function is the function literal declaring a parameter, or nil
+	Function *ast.FunctionLiteral
+	// Macro is the macro literal declaring a parameter, or nil
+	Macro *ast.MacroLiteral
+	// Pattern is the pattern of the match arm binding the name, or nil
+	Pattern ast.Pattern
+}
+
+// Definitions resolves each identifier in a program to the binding it
+// refers to, following the same scope rules as Program. The names in let
+// statements and parameter lists map to their own definitions. Builtins and
+// undefined names are left out.
+func Definitions(program *ast.Program) map[*ast.Identifier]Definition {
+	linter := &linter{definitions: make(map[*ast.Identifier]Definition)}
+	linter.program(program)
+	return linter.definitions
+}
+
+type linter struct {
+	diagnostics []Diagnostic
+	// resolved identifiers, if requested
+	definitions map[*ast.Identifier]Definition
+	// builtins defined besides the evaluator's
+	builtins map[string]*object.Builtin
+}
+
+func (l *linter) lookupBuiltin(name string) (*object.Builtin, bool) {
+	if builtin, ok := l.builtins[name]; ok {
+		return builtin, true
+	}
+	return evaluator.LookupBuiltin(name)
+}
+
+func (l *linter) program(program *ast.Program) {
+	scope := l.newScope(nil, nil, Definition{}, program.Statements)
+	l.statements(scope, program.Statements)
+	l.reportUnused(scope)
+}
+
+type scope struct {
+	parent   *scope
+	bindings map[string]*binding
+	// bindings in declaration order, for reporting unused bindings in order
+	declared []*binding
+}
+
+type binding struct {
+	definition Definition
+	position   token.Position
+	parameter  bool
+	used       bool
+	// the function literal bound to the name, if it is bound exactly once
+	function *ast.FunctionLiteral
+	// number of let statements binding the name in its scope
+	lets int
+	// the parameter a let statement rebinds, which names refer to until the
+	// let statement is evaluated
+	shadows *binding
+	bound   bool
+}
+
+func (l *linter) report(position token.Position, severity Severity, rule string, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Position: position,
+		Severity: severity,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// newScope declares the parameters and let bindings of a scope, reporting
+// any that shadow a name from an enclosing scope or a builtin. The
+// parameters are defined by declarer, giving the function or macro literal
+// or the pattern declaring them.
+func (l *linter) newScope(parent *scope, parameters []*ast.Identifier, declarer Definition, statements []ast.Statement) *scope {
+	scope := &scope{parent: parent, bindings: make(map[string]*binding)}
+	kind := "parameter"
+	if declarer.Pattern != nil {
+		kind = "binding"
+	}
+	for _, parameter := range parameters {
+		name := parameter.Value
+		if previous, ok := scope.bindings[name]; ok {
+			l.report(parameter.Token.Position, Error, Shadow, "duplicate %s %s, also declared at %s", kind, name, previous.position)
+			l.define(parameter, previous)
+			continue
+		}
+		l.checkShadowing(parent, name, parameter.Token.Position)
+		definition := declarer
+		definition.Name = parameter
+		binding := &binding{
+			definition: definition,
+			position:   parameter.Token.Position,
+			parameter:  true,
+		}
+		scope.declare(name, binding)
+		l.define(parameter, binding)
+	}
+	for _, let := range collectLets(statements) {
+		for _, identifier := range let.Names() {
+			name := identifier.Value
+			var shadows *binding
+			if existing, ok := scope.bindings[name]; ok && existing.parameter {
+				l.report(identifier.Token.Position, Warning, Shadow, "%s shadows the parameter at %s", name, existing.position)
+				shadows = existing
+			} else if ok {
+				existing.lets++
+				existing.function = nil
+				l.define(identifier, existing)
+				continue
+			} else {
+				l.checkShadowing(parent, name, identifier.Token.Position)
+			}
+			binding := &binding{
+				definition: Definition{Name: identifier, Let: let},
+				position:   identifier.Token.Position,
+				lets:       1,
+				shadows:    shadows,
+			}
+			if let.Pattern == nil {
+				binding.function, _ = let.Value.(*ast.FunctionLiteral)
+			}
+			scope.declare(name, binding)
+			l.define(identifier, binding)
+		}
+	}
+	return scope
+}
+
+// define records the binding an identifier refers to, if definitions were
+// requested.
+func (l *linter) define(identifier *ast.Identifier, binding *binding) {
+	if l.definitions != nil {
+		l.definitions[identifier] = binding.definition
+	}
+}
+
+func (l *linter) checkShadowing(parent *scope, name string, position token.Position) {
+	if outer := parent.lookup(name); outer != nil {
+		l.report(position, Warning, Shadow, "%s shadows the declaration at %s", name, outer.position)
+	} else if _, ok := l.lookupBuiltin(name); ok {
+		l.report(position, Warning, Shadow, "%s shadows the builtin function %s", name, name)
+	}
+}
+
+// collectLets finds the let statements belonging to a scope, including those
+// in if blocks but not those in nested function or macro literals or in
+// quoted code.
+func collectLets(statements []ast.Statement) []*ast.LetStatement {
+	lets := make([]*ast.LetStatement, 0)
+	for _, statement := range statements {
+		ast.Inspect(statement, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				lets = append(lets, node)
+			case *ast.FunctionLiteral, *ast.MacroLiteral:
+				return false
+			case *ast.CallExpression:
+				return !isCallTo(node, "quote")
+			}
+			return true
+		})
+	}
+	return lets
+}
+
+// isCallTo reports whether a call is to the function with the given name.
+func isCallTo(call *ast.CallExpression, name string) bool {
+	identifier, ok := call.Function.(*ast.Identifier)
+	return ok && identifier.Value == name
+}
+
+func (s *scope) declare(name string, binding *binding) {
+	s.bindings[name] = binding
+	s.declared = append(s.declared, binding)
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.parent {
+		if binding, ok := s.bindings[name]; ok {
+			if binding.shadows != nil && !binding.bound {
+				return binding.shadows
+			}
+			return binding
+		}
+	}
+	return nil
+}
+
+// reportUnused reports the unused bindings of a scope. In test programs,
+// top level functions named test_ are used by the tester, which runs them.
+func (l *linter) reportUnused(scope *scope) {
+	_, testing := l.builtins["test"]
+	for _, binding := range scope.declared {
+		name := binding.definition.Name.Value
+		if binding.used || strings.HasPrefix(name, "_") {
+			continue
+		}
+		if testing && scope.parent == nil && strings.HasPrefix(name, "test_") {
+			continue
+		}
+		if binding.definition.Pattern != nil {
+			l.report(binding.position, Warning, Unused, "%s is bound but not used", name)
+		} else if binding.parameter {
+			l.report(binding.position, Warning, Unused, "parameter %s is unused", name)
+		} else {
+			l.report(binding.position, Warning, Unused, "%s is declared but not used", name)
+		}
+	}
+}
+
+func (l *linter) statements(scope *scope, statements []ast.Statement) {
+	returned := false
+	for _, statement := range statements {
+		if returned {
+			l.report(ast.StatementPosition(statement), Warning, Unreachable, "unreachable code")
+			returned = false
+		}
+		l.statement(scope, statement)
+		if _, ok := statement.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+func (l *linter) statement(scope *scope, statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		l.expression(scope, statement.Value)
+		for _, identifier := range statement.Names() {
+			if binding, ok := scope.bindings[identifier.Value]; ok {
+				binding.bound = true
+			}
+		}
+	case *ast.ReturnStatement:
+		l.expression(scope, statement.ReturnValue)
+	case *ast.ExpressionStatement:
+		l.expression(scope, statement.Expression)
+	case *ast.BlockStatement:
+		l.block(scope, statement)
+	}
+}
+
+func (l *linter) block(scope *scope, block *ast.BlockStatement) {
+	if block != nil {
+		l.statements(scope, block.Statements)
+	}
+}
+
+func (l *linter) expression(scope *scope, expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.Identifier:
+		l.identifier(scope, expression)
+	case *ast.InterpolatedString:
+		l.expressions(scope, expression.Parts)
+	case *ast.PrefixExpression:
+		l.expression(scope, expression.Right)
+	case *ast.InfixExpression:
+		l.expression(scope, expression.Left)
+		l.expression(scope, expression.Right)
+	case *ast.IfExpression:
+		if truthy, ok := constantTruth(expression.Condition); ok {
+			l.report(expression.Token.Position, Warning, ConstantCondition, "if condition is always %t", truthy)
+		}
+		l.expression(scope, expression.Condition)
+		l.block(scope, expression.Consequence)
+		l.block(scope, expression.Alternative)
+	case *ast.FunctionLiteral:
+		statements := make([]ast.Statement, 0)
+		if expression.Body != nil {
+			statements = expression.Body.Statements
+		}
+		inner := l.newScope(scope, parameterNames(expression), Definition{Function: expression}, statements)
+		for _, parameter := range expression.Parameters {
+			l.expression(inner, parameter.Default)
+		}
+		l.statements(inner, statements)
+		l.reportUnused(inner)
+	case *ast.MacroLiteral:
+		statements := make([]ast.Statement, 0)
+		if expression.Body != nil {
+			statements = expression.Body.Statements
+		}
+		inner := l.newScope(scope, identifiers(expression.Parameters), Definition{Macro: expression}, statements)
+		l.statements(inner, statements)
+		l.reportUnused(inner)
+	case *ast.CallExpression:
+		if isCallTo(expression, "quote") {
+			l.quoted(scope, expression.Arguments)
+			return
+		}
+		l.expression(scope, expression.Function)
+		l.expressions(scope, expression.Arguments)
+		l.checkArity(scope, expression)
+	case *ast.SpreadExpression:
+		l.expression(scope, expression.Value)
+	case *ast.NamedArgument:
+		// the name is a parameter of the function called, checked by
+		// checkArity, not a reference
+		l.expression(scope, expression.Value)
+	case *ast.ArrayExpression:
+		l.expressions(scope, expression.Elements)
+	case *ast.HashExpression:
+		for _, entry := range expression.Entries {
+			l.expression(scope, entry.Key)
+			l.expression(scope, entry.Value)
+		}
+	case *ast.IndexExpression:
+		l.expression(scope, expression.Left)
+		l.expression(scope, expression.Index)
+	case *ast.SliceExpression:
+		l.expression(scope, expression.Left)
+		l.expression(scope, expression.Start)
+		l.expression(scope, expression.End)
+		l.expression(scope, expression.Step)
+	case *ast.MatchExpression:
+		l.expression(scope, expression.Value)
+		for _, arm := range expression.Arms {
+			inner := l.newScope(scope, ast.Bindings(arm.Pattern), Definition{Pattern: arm.Pattern}, nil)
+			l.expression(inner, arm.Guard)
+			l.expression(inner, arm.Body)
+			l.reportUnused(inner)
+		}
+	}
+}
+
+// parameterNames returns the names bound by the parameters of a function
+// literal, including those in patterns and the rest parameter.
+func parameterNames(function *ast.FunctionLiteral) []*ast.Identifier {
+	names := make([]*ast.Identifier, 0, len(function.Parameters)+1)
+	for _, parameter := range function.Parameters {
+		names = append(names, parameter.Names()...)
+	}
+	if function.Rest != nil {
+		names = append(names, function.Rest)
+	}
+	return names
+}
+
+// identifiers returns pointers to the parameters of a macro literal.
+func identifiers(parameters []ast.Identifier) []*ast.Identifier {
+	pointers := make([]*ast.Identifier, len(parameters))
+	for i := range parameters {
+		pointers[i] = &parameters[i]
+	}
+	return pointers
+}
+
+func (l *linter) expressions(scope *scope, expressions []ast.Expression) {
+	for _, expression := range expressions {
+		l.expression(scope, expression)
+	}
+}
+
+// quoted checks the arguments of a call to quote. The quoted code is not
+// evaluated where it is written, so only the arguments of the calls to
+// unquote in it are checked.
+func (l *linter) quoted(scope *scope, arguments []ast.Expression) {
+	for _, argument := range arguments {
+		ast.Inspect(argument, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && isCallTo(call, "unquote") {
+				l.expressions(scope, call.Arguments)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (l *linter) identifier(scope *scope, identifier *ast.Identifier) {
+	if binding := scope.lookup(identifier.Value); binding != nil {
+		binding.used = true
+		l.define(identifier, binding)
+		return
+	}
+	if _, ok := l.lookupBuiltin(identifier.Value); !ok {
+		l.report(identifier.Token.Position, Error, Undefined, "undefined: %s", identifier.Value)
+	}
+}
+
+// checkArity reports calls by name to a function literal or builtin with the
+// wrong number of arguments, or with named arguments that match no
+// parameter. Calls to names bound to anything else, such as parameters or
+// names bound more than once, are not checked. The number of arguments is
+// not checked for calls spreading an array.
+func (l *linter) checkArity(scope *scope, call *ast.CallExpression) {
+	identifier, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	var function *ast.FunctionLiteral
+	minimum, maximum := 0, object.Variadic
+	if binding := scope.lookup(identifier.Value); binding != nil {
+		if function = binding.function; function == nil {
+			return
+		}
+		maximum = len(function.Parameters)
+		for _, parameter := range function.Parameters {
+			if parameter.Default == nil {
+				minimum++
+			}
+		}
+		if function.Rest != nil {
+			maximum = object.Variadic
+		}
+	} else if builtin, ok := l.lookupBuiltin(identifier.Value); ok {
+		minimum, maximum = builtin.Arity, builtin.Arity
+		if builtin.Arity == object.Variadic {
+			minimum = 0
+		}
+	} else {
+		return
+	}
+
+	spread := false
+	for _, argument := range call.Arguments {
+		switch argument := argument.(type) {
+		case *ast.SpreadExpression:
+			spread = true
+		case *ast.NamedArgument:
+			if function == nil {
+				l.report(argument.Name.Token.Position, Error, Arity, "%s does not take named arguments", identifier.Value)
+			} else if !hasParameter(function, argument.Name.Value) {
+				l.report(argument.Name.Token.Position, Error, Arity, "%s has no parameter named %s", identifier.Value, argument.Name.Value)
+			}
+		}
+	}
+	count := len(call.Arguments)
+	if spread || count >= minimum && (maximum == object.Variadic || count <= maximum) {
+		return
+	}
+	l.report(identifier.Token.Position, Error, Arity, "%s expects %s, got %d",
+		identifier.Value, describeArity(minimum, maximum), count)
+}
+
+// hasParameter reports whether a function literal has a parameter that can
+// be passed by name.
+func hasParameter(function *ast.FunctionLiteral, name string) bool {
+	for _, parameter := range function.Parameters {
+		if parameter.Name != nil && parameter.Name.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// describeArity describes the number of arguments a function takes.
+func describeArity(minimum int, maximum int) string {
+	switch {
+	case maximum == object.Variadic:
+		return "at least " + plural(minimum, "argument")
+	case minimum == maximum:
+		return plural(minimum, "argument")
+	default:
+		return fmt.Sprintf("%d to %s", minimum, plural(maximum, "argument"))
+	}
+}
+
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// constantTruth reports whether a condition always has the same truthiness,
+// following the rules of the evaluator.
+func constantTruth(condition ast.Expression) (truthy bool, ok bool) {
+	switch condition := condition.(type) {
+	case *ast.BooleanLiteral:
+		return condition.Value, true
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return true, true
+	case *ast.StringLiteral, *ast.InterpolatedString, *ast.ArrayExpression, *ast.HashExpression, *ast.FunctionLiteral:
+		return false, true
+	case *ast.PrefixExpression:
+		if condition.Operator == "!" {
+			truthy, ok := constantTruth(condition.Right)
+			return !truthy, ok
+		}
+		if condition.Operator == "-" {
+			switch condition.Right.(type) {
+			case *ast.IntegerLiteral, *ast.FloatLiteral:
+				return true, true
+			}
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,243 @@
+package lint
+
+import (
+	"testing"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x);", nil},
+		{
+			"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10);",
+			nil,
+		},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f();", nil},
+		{"puts(y);", []string{"1:6: error: undefined: y (undefined)"}},
+		{"let f = fn() { z }; f();", []string{"1:16: error: undefined: z (undefined)"}},
+		{"let f = fn(a, _b) { 1 }; f(1, 2);", []string{"1:12: warning: parameter a is unused (unused)"}},
+		{
+			"let f = fn() { let x = 1; 2 }; f();",
+			[]string{"1:20: warning: x is declared but not used (unused)"},
+		},
+		{"let unused = 1;", []string{"1:5: warning: unused is declared but not used (unused)"}},
+		{"let _unused = 1;", nil},
+		{
+			"let f = fn(x) { let x = 2; x }; f(1);",
+			[]string{
+				"1:12: warning: parameter x is unused (unused)",
+				"1:21: warning: x shadows the parameter at 1:12 (shadow)",
+			},
+		},
+		{
+			"let f = fn(x) { let x = x + 1; x }; f(1);",
+			[]string{"1:21: warning: x shadows the parameter at 1:12 (shadow)"},
+		},
+		{
+			"let f = fn() { if (true) { let y = 1; } y }; f();",
+			[]string{"1:16: warning: if condition is always true (constant-condition)"},
+		},
+		{
+			"let x = 1; let f = fn(x) { x }; f(x);",
+			[]string{"1:23: warning: x shadows the declaration at 1:5 (shadow)"},
+		},
+		{
+			"let f = fn(len) { len }; f(1);",
+			[]string{"1:12: warning: len shadows the builtin function len (shadow)"},
+		},
+		{"let x = 1; let x = x + 1; x;", nil},
+		{"let f = fn(a, a) { a }; f(1, 2);", []string{"1:15: error: duplicate parameter a, also declared at 1:12 (shadow)"}},
+		{
+			"let add = fn(a, b) { a + b }; add(1); add(1, 2, 3); add(1, 2);",
+			[]string{
+				"1:31: error: add expects 2 arguments, got 1 (arity)",
+				"1:39: error: add expects 2 arguments, got 3 (arity)",
+			},
+		},
+		{
+			"len(); puts(); puts(1, 2); first([1], 2);",
+			[]string{
+				"1:1: error: len expects 1 argument, got 0 (arity)",
+				"1:28: error: first expects 1 argument, got 2 (arity)",
+			},
+		},
+		{"let f = fn() { 1 }; let f = fn(a) { a }; f(1);", nil},
+		{
+			"let f = fn() { return 1; puts(2); return 3; }; f();",
+			[]string{"1:26: warning: unreachable code (unreachable)"},
+		},
+		{
+			"if (0) { 1 }; if (!true) { 2 }; if (\"\") { 3 }; if (-1) { 4 }; if (x) { 5 };",
+			[]string{
+				"1:1: warning: if condition is always true (constant-condition)",
+				"1:15: warning: if condition is always false (constant-condition)",
+				"1:33: warning: if condition is always false (constant-condition)",
+				"1:48: warning: if condition is always true (constant-condition)",
+				"1:67: error: undefined: x (undefined)",
+			},
+		},
+		{
+			"if (0.5) { 1 }; if (-1.5) { 2 };",
+			[]string{
+				"1:1: warning: if condition is always true (constant-condition)",
+				"1:17: warning: if condition is always true (constant-condition)",
+			},
+		},
+		{
+			`let name = "x"; "${name}"; {name: [1][0:n]};`,
+			[]string{"1:41: error: undefined: n (undefined)"},
+		},
+		{
+			"let unless = macro(c, x, y) { quote(if (!unquote(c)) { unquote(x) } else { z }) }; unless(true, 1, 2);",
+			[]string{"1:26: warning: parameter y is unused (unused)"},
+		},
+		{
+			"let v = [1]; match (v) { [h, ...t] if h > 0 => t, {k, j: [a, a]} => k + z, _ => h };",
+			[]string{
+				"1:59: warning: a is bound but not used (unused)",
+				"1:62: error: duplicate binding a, also declared at 1:59 (shadow)",
+				"1:73: error: undefined: z (undefined)",
+				"1:81: error: undefined: h (undefined)",
+			},
+		},
+		{
+			"let f = fn([a, b], {c}) { let [d, ...e] = a; c + d }; f([1, 2], {});",
+			[]string{
+				"1:16: warning: parameter b is unused (unused)",
+				"1:38: warning: e is declared but not used (unused)",
+			},
+		},
+		{
+			"let f = fn(a, b = a, ...c) { c }; f(); f(1); f(1, 2, 3); f(...[1]); f(1, d: 2); puts(e: 1);",
+			[]string{
+				"1:15: warning: parameter b is unused (unused)",
+				"1:35: error: f expects at least 1 argument, got 0 (arity)",
+				"1:74: error: f has no parameter named d (arity)",
+				"1:86: error: puts does not take named arguments (arity)",
+			},
+		},
+		{
+			"let g = fn(a, b = 1) { a + b }; g(); g(1, 2, 3); g(b: 1, a: z);",
+			[]string{
+				"1:33: error: g expects 1 to 2 arguments, got 0 (arity)",
+				"1:38: error: g expects 1 to 2 arguments, got 3 (arity)",
+				"1:61: error: undefined: z (undefined)",
+			},
+		},
+		{"let f = fn(a) { a }; let f = fn(b) { b }; puts(f(b: 2));", nil},
+		{"let q = fn(x) { x(k: 1) }; q(fn(k) { k });", nil},
+		{"let h = first([fn(k) { k }]); h(k: 1); h(1, 2);", nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Source(tt.input, nil)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("%q: expected %d diagnostics, got %d: %v", tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, diagnostic := range diagnostics {
+			if diagnostic.String() != tt.expected[i] {
+				t.Errorf("%q: expected %q, got %q", tt.input, tt.expected[i], diagnostic.String())
+			}
+		}
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	builtins := map[string]*object.Builtin{"check": {Arity: 1}}
+	diagnostics, err := Source("check(true); check(1, 2); fn(check) { check };", builtins)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{
+		"1:14: error: check expects 1 argument, got 2 (arity)",
+		"1:30: warning: check shadows the builtin function check (shadow)",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, diagnostic := range diagnostics {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], diagnostic.String())
+		}
+	}
+}
+
+func TestTestFunctions(t *testing.T) {
+	input := "let test_add = fn() { 1 }; let helper = 1; let f = fn() { let test_inner = 1; 2 }; f();"
+	expected := []string{
+		"1:32: warning: helper is declared but not used (unused)",
+		"1:63: warning: test_inner is declared but not used (unused)",
+	}
+	builtins := map[string]*object.Builtin{"test": {Arity: 2}}
+	diagnostics, err := Source(input, builtins)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, diagnostic := range diagnostics {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], diagnostic.String())
+		}
+	}
+	// outside test programs, test_ functions are not run
+	if diagnostics, _ := Source(input, nil); len(diagnostics) != 3 {
+		t.Errorf("expected 3 diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, err := Source("let = 1;", nil); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	input := "let x = 1; let f = fn(a) { let x = a; x + len(a) }; f(x); let x = 2;"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	definitions := Definitions(program)
+
+	// each identifier by position, mapped to the position of its definition
+	expected := map[string]string{
+		"1:5":  "1:5",
+		"1:16": "1:16",
+		"1:23": "1:23",
+		"1:32": "1:32",
+		"1:36": "1:23",
+		"1:39": "1:32",
+		"1:47": "1:23",
+		"1:53": "1:16",
+		"1:55": "1:5",
+		"1:63": "1:5",
+	}
+	actual := make(map[string]string)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok {
+			if definition, ok := definitions[identifier]; ok {
+				actual[identifier.Token.Position.String()] = definition.Name.Token.Position.String()
+			}
+		}
+		return true
+	})
+	if len(actual) != len(expected) {
+		t.Errorf("expected %d definitions, got %d: %v", len(expected), len(actual), actual)
+	}
+	for position, definition := range expected {
+		if actual[position] != definition {
+			t.Errorf("identifier at %s: expected definition at %s, got %q", position, definition, actual[position])
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"danielmcm.com/interpreterbook/lint"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/tester"
+)
+
+// runLint implements `monkey lint [files]`, printing the diagnostics for
+// each file. Standard input is checked if no files are given. The exit code
+// is 1 if anything was reported.
+func runLint(args []string) int {
+	if len(args) == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return lintSource("<stdin>", string(source))
+	}
+
+	status := 0
+	for _, path := range args {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		if lintSource(path, string(source)) != 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+func lintSource(path string, source string) int {
+	var builtins map[string]*object.Builtin
+	if tester.IsTestFile(path) {
+		builtins = tester.Builtins()
+	}
+	diagnostics, err := lint.Source(source, builtins)
+	if err != nil {
+		printFileErrors(path, err)
+		return 1
+	}
+	for _, diagnostic := range diagnostics {
+		fmt.Printf("%s:%s\n", path, diagnostic)
+	}
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/lint"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/token"
+)
+
+// document is an open text document and the results of analysing it.
+type document struct {
+	text  string
+	lines []string
+	// the program is partial if there are parse errors
+	program     *ast.Program
+	parseErrors []error
+	definitions map[*ast.Identifier]lint.Definition
+	// builtins defined for the document besides the evaluator's
+	builtins map[string]*object.Builtin
+}
+
+func newDocument(text string, builtins map[string]*object.Builtin) *document {
+	parser := parser.New(lexer.New(text))
+	program := parser.ParseProgram()
+	return &document{
+		text:        text,
+		lines:       strings.Split(text, "\n"),
+		program:     program,
+		parseErrors: parser.Errors(),
+		definitions: lint.Definitions(program),
+		builtins:    builtins,
+	}
+}
+
+// lookupBuiltin returns the builtin with the given name, from those defined
+// for the document or the evaluator's.
+func (d *document) lookupBuiltin(name string) (*object.Builtin, bool) {
+	if builtin, ok := d.builtins[name]; ok {
+		return builtin, true
+	}
+	return evaluator.LookupBuiltin(name)
+}
+
+// builtinNames returns the sorted names of the builtins defined for the
+// document and the evaluator's.
+func (d *document) builtinNames() []string {
+	names := evaluator.BuiltinNames()
+	for name := range d.builtins {
+		if _, ok := evaluator.LookupBuiltin(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diagnostics returns the parse errors of the document, or the problems
+// found by the linter if it could be parsed.
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	for _, err := range d.parseErrors {
+		position, _ := parser.ErrorPosition(err)
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.wordRange(position),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  strings.TrimPrefix(err.Error(), position.String()+": "),
+		})
+	}
+	if len(d.parseErrors) > 0 {
+		return diagnostics
+	}
+
+	for _, problem := range lint.Program(d.program, d.builtins) {
+		severity := SeverityWarning
+		if problem.Severity == lint.Error {
+			severity = SeverityError
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.wordRange(problem.Position),
+			Severity: severity,
+			Code:     problem.Rule,
+			Source:   "monkey",
+			Message:  problem.Message,
+		})
+	}
+	return diagnostics
+}
+
+// identifierAt returns the identifier at or immediately before a position.
+func (d *document) identifierAt(position Position) *ast.Identifier {
+	target := d.tokenPosition(position)
+	var found *ast.Identifier
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok {
+			start := identifier.Token.Position
+			end := start.Column + len([]rune(identifier.Value))
+			if start.Line == target.Line && start.Column <= target.Column && target.Column <= end {
+				found = identifier
+			}
+		}
+		return found == nil
+	})
+	return found
+}
+
+// protocolPosition converts a position in the source to a protocol
+// position, clamping it to the end of the document.
+func (d *document) protocolPosition(position token.Position) Position {
+	line := position.Line - 1
+	if line < 0 {
+		return Position{}
+	}
+	if line >= len(d.lines) {
+		return d.end()
+	}
+	runes := []rune(d.lines[line])
+	column := position.Column - 1
+	if column > len(runes) {
+		column = len(runes)
+	} else if column < 0 {
+		column = 0
+	}
+	return Position{Line: line, Character: len(utf16.Encode(runes[:column]))}
+}
+
+// tokenPosition converts a protocol position to a position in the source.
+func (d *document) tokenPosition(position Position) token.Position {
+	if position.Line < 0 || position.Line >= len(d.lines) {
+		return token.Position{Line: position.Line + 1, Column: 1}
+	}
+	column, units := 0, 0
+	for _, char := range d.lines[position.Line] {
+		if units >= position.Character {
+			break
+		}
+		units += len(utf16.Encode([]rune{char}))
+		column++
+	}
+	return token.Position{Line: position.Line + 1, Column: column + 1}
+}
+
+// end returns the position at the end of the document.
+func (d *document) end() Position {
+	last := len(d.lines) - 1
+	return Position{Line: last, Character: len(utf16.Encode([]rune(d.lines[last])))}
+}
+
+// wordRange returns the range of the identifier or number starting at a
+// position, or of the single character there.
+func (d *document) wordRange(position token.Position) Range {
+	start := d.protocolPosition(position)
+	length := 1
+	if line := position.Line - 1; line >= 0 && line < len(d.lines) {
+		runes := []rune(d.lines[line])
+		if column := position.Column - 1; column >= 0 && column < len(runes) {
+			length = 0
+			for _, char := range runes[column:] {
+				if char != '_' && !unicode.IsLetter(char) && !unicode.IsDigit(char) {
+					break
+				}
+				length++
+			}
+			length = max(length, 1)
+		}
+	}
+	end := d.protocolPosition(token.Position{Line: position.Line, Column: position.Column + length})
+	return Range{Start: start, End: end}
+}
+
+// identifierRange returns the range covered by an identifier.
+func (d *document) identifierRange(identifier *ast.Identifier) Range {
+	start := identifier.Token.Position
+	end := token.Position{Line: start.Line, Column: start.Column + len([]rune(identifier.Value))}
+	return Range{Start: d.protocolPosition(start), End: d.protocolPosition(end)}
+}
@@ -0,0 +1,406 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/format"
+	"danielmcm.com/interpreterbook/lint"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/tester"
+	"danielmcm.com/interpreterbook/token"
+	"danielmcm.com/interpreterbook/transport"
+)
+
+// ErrNoShutdown is returned by Serve if the client exits without first
+// requesting a shutdown.
+var ErrNoShutdown = errors.New("exit without shutdown request")
+
+// Server is a language server for Monkey, communicating with a single
+// client. Documents are synchronised in full on every change.
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: make(map[string]*document),
+	}
+}
+
+// handler handles a request or notification, returning the result to send
+// in reply to a request.
+type handler func(server *Server, params json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":                  (*Server).initialize,
+		"initialized":                 ignore,
+		"shutdown":                    (*Server).requestShutdown,
+		"textDocument/didOpen":        (*Server).didOpen,
+		"textDocument/didChange":      (*Server).didChange,
+		"textDocument/didClose":       (*Server).didClose,
+		"textDocument/hover":          (*Server).hover,
+		"textDocument/definition":     (*Server).definition,
+		"textDocument/documentSymbol": (*Server).documentSymbol,
+		"textDocument/completion":     (*Server).completion,
+		"textDocument/formatting":     (*Server).formatting,
+	}
+}
+
+// Serve handles messages until the client sends an exit notification or
+// closes the input.
+func (server *Server) Serve() error {
+	for {
+		content, err := transport.ReadMessage(server.reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var message incoming
+		if err := json.Unmarshal(content, &message); err != nil {
+			if err := server.reply(json.RawMessage("null"), nil, &ResponseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if message.Method == "exit" {
+			if !server.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		if err := server.handle(message); err != nil {
+			return err
+		}
+	}
+}
+
+func (server *Server) handle(message incoming) error {
+	handle, ok := handlers[message.Method]
+	if message.ID == nil {
+		if ok {
+			// errors handling notifications cannot be reported
+			handle(server, message.Params)
+		}
+		return nil
+	}
+
+	if !ok {
+		return server.reply(*message.ID, nil, &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not found", message.Method)})
+	}
+	if server.shutdown {
+		return server.reply(*message.ID, nil, &ResponseError{Code: codeInvalidRequest, Message: "server is shutting down"})
+	}
+	result, err := handle(server, message.Params)
+	if err != nil {
+		var responseErr *ResponseError
+		if !errors.As(err, &responseErr) {
+			responseErr = &ResponseError{Code: codeInternalError, Message: err.Error()}
+		}
+		return server.reply(*message.ID, nil, responseErr)
+	}
+	return server.reply(*message.ID, result, nil)
+}
+
+func (server *Server) reply(id json.RawMessage, result interface{}, responseErr *ResponseError) error {
+	message := response{JSONRPC: "2.0", ID: id, Error: responseErr}
+	if responseErr == nil {
+		content, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		message.Result = content
+	}
+	return transport.WriteMessage(server.writer, message)
+}
+
+func (server *Server) notify(method string, params interface{}) error {
+	return transport.WriteMessage(server.writer, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func ignore(server *Server, params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+func decodeParams(params json.RawMessage, value interface{}) error {
+	if err := json.Unmarshal(params, value); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// document returns an open document.
+func (server *Server) document(uri string) (*document, error) {
+	document, ok := server.documents[uri]
+	if !ok {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	return document, nil
+}
+
+func (server *Server) initialize(params json.RawMessage) (interface{}, error) {
+	result := InitializeResult{ServerInfo: ServerInfo{Name: "monkey"}}
+	result.Capabilities = ServerCapabilities{
+		TextDocumentSync:           1,
+		HoverProvider:              true,
+		DefinitionProvider:         true,
+		DocumentSymbolProvider:     true,
+		DocumentFormattingProvider: true,
+	}
+	return result, nil
+}
+
+func (server *Server) requestShutdown(params json.RawMessage) (interface{}, error) {
+	server.shutdown = true
+	return nil, nil
+}
+
+func (server *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var open DidOpenTextDocumentParams
+	if err := decodeParams(params, &open); err != nil {
+		return nil, err
+	}
+	return nil, server.update(open.TextDocument.URI, open.TextDocument.Text)
+}
+
+func (server *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var change DidChangeTextDocumentParams
+	if err := decodeParams(params, &change); err != nil {
+		return nil, err
+	}
+	if len(change.ContentChanges) == 0 {
+		return nil, nil
+	}
+	text := change.ContentChanges[len(change.ContentChanges)-1].Text
+	return nil, server.update(change.TextDocument.URI, text)
+}
+
+func (server *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var close DidCloseTextDocumentParams
+	if err := decodeParams(params, &close); err != nil {
+		return nil, err
+	}
+	delete(server.documents, close.TextDocument.URI)
+	return nil, server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         close.TextDocument.URI,
+		Diagnostics: make([]Diagnostic, 0),
+	})
+}
+
+// update analyses the new text of a document and publishes its diagnostics.
+// Test files are checked with the builtins the tester defines.
+func (server *Server) update(uri string, text string) error {
+	var builtins map[string]*object.Builtin
+	if tester.IsTestFile(uri) {
+		builtins = tester.Builtins()
+	}
+	document := newDocument(text, builtins)
+	server.documents[uri] = document
+	return server.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: document.diagnostics(),
+	})
+}
+
+func (server *Server) hover(params json.RawMessage) (interface{}, error) {
+	var hover TextDocumentPositionParams
+	if err := decodeParams(params, &hover); err != nil {
+		return nil, err
+	}
+	document, err := server.document(hover.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	identifier := document.identifierAt(hover.Position)
+	if identifier == nil {
+		return nil, nil
+	}
+
+	var description string
+	if definition, ok := document.definitions[identifier]; ok {
+		description = describeDefinition(definition)
+	} else if builtin, ok := document.lookupBuiltin(identifier.Value); ok {
+		description = describeBuiltin(identifier.Value, builtin)
+	} else {
+		return nil, nil
+	}
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + description + "\n```"},
+		Range:    document.identifierRange(identifier),
+	}, nil
+}
+
+// describeDefinition describes a let binding by its value, a parameter by
+// the function or macro declaring it, and a pattern binding by its pattern.
+// A name destructured by a let statement is described by the whole
+// statement.
+func describeDefinition(definition lint.Definition) string {
+	if definition.Pattern != nil {
+		return fmt.Sprintf("(binding) %s in %s", definition.Name.Value, format.Node(definition.Pattern))
+	}
+	if definition.Let == nil {
+		if definition.Macro != nil {
+			names := make([]string, len(definition.Macro.Parameters))
+			for i, parameter := range definition.Macro.Parameters {
+				names[i] = parameter.Value
+			}
+			return fmt.Sprintf("(parameter) %s of %s", definition.Name.Value, signature("macro", names))
+		}
+		return fmt.Sprintf("(parameter) %s of %s", definition.Name.Value, functionSignature(definition.Function))
+	}
+	name := definition.Name.Value
+	if definition.Let.Pattern != nil {
+		name = format.Node(definition.Let.Pattern)
+	}
+	if function, ok := definition.Let.Value.(*ast.FunctionLiteral); ok {
+		return fmt.Sprintf("let %s = %s", name, functionSignature(function))
+	}
+	value := format.Node(definition.Let.Value)
+	if lines := strings.SplitN(value, "\n", 2); len(lines) > 1 {
+		value = lines[0] + " …"
+	}
+	return fmt.Sprintf("let %s = %s", name, value)
+}
+
+func functionSignature(function *ast.FunctionLiteral) string {
+	names := make([]string, len(function.Parameters), len(function.Parameters)+1)
+	for i, parameter := range function.Parameters {
+		if parameter.Pattern != nil {
+			names[i] = format.Node(parameter.Pattern)
+		} else {
+			names[i] = parameter.Name.Value
+		}
+		if parameter.Default != nil {
+			names[i] += " = " + format.Node(parameter.Default)
+		}
+	}
+	if function.Rest != nil {
+		names = append(names, "..."+function.Rest.Value)
+	}
+	return signature("fn", names)
+}
+
+func signature(keyword string, parameters []string) string {
+	return fmt.Sprintf("%s(%s)", keyword, strings.Join(parameters, ", "))
+}
+
+func describeBuiltin(name string, builtin *object.Builtin) string {
+	if builtin.Arity == object.Variadic {
+		return fmt.Sprintf("(builtin) %s: function of any number of arguments", name)
+	}
+	noun := "arguments"
+	if builtin.Arity == 1 {
+		noun = "argument"
+	}
+	return fmt.Sprintf("(builtin) %s: function of %d %s", name, builtin.Arity, noun)
+}
+
+func (server *Server) definition(params json.RawMessage) (interface{}, error) {
+	var lookup TextDocumentPositionParams
+	if err := decodeParams(params, &lookup); err != nil {
+		return nil, err
+	}
+	document, err := server.document(lookup.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	identifier := document.identifierAt(lookup.Position)
+	if identifier == nil {
+		return nil, nil
+	}
+	definition, ok := document.definitions[identifier]
+	if !ok {
+		return nil, nil
+	}
+	return Location{URI: lookup.TextDocument.URI, Range: document.identifierRange(definition.Name)}, nil
+}
+
+// documentSymbol lists the top level let statements of a document.
+func (server *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var symbols DocumentSymbolParams
+	if err := decodeParams(params, &symbols); err != nil {
+		return nil, err
+	}
+	document, err := server.document(symbols.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DocumentSymbol, 0)
+	for _, statement := range document.program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		// each name destructured by a let statement is a variable
+		for _, name := range let.Names() {
+			symbol := DocumentSymbol{
+				Name:           name.Value,
+				Kind:           SymbolVariable,
+				SelectionRange: document.identifierRange(name),
+			}
+			if function, ok := let.Value.(*ast.FunctionLiteral); ok && let.Pattern == nil {
+				symbol.Kind = SymbolFunction
+				symbol.Detail = functionSignature(function)
+			}
+			symbol.Range = Range{Start: document.protocolPosition(let.Token.Position), End: symbol.SelectionRange.End}
+			result = append(result, symbol)
+		}
+	}
+	return result, nil
+}
+
+// completion offers the keywords and builtin functions, including those the
+// tester defines in test files.
+func (server *Server) completion(params json.RawMessage) (interface{}, error) {
+	var completion TextDocumentPositionParams
+	if err := decodeParams(params, &completion); err != nil {
+		return nil, err
+	}
+	document, err := server.document(completion.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]CompletionItem, 0)
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	for _, name := range document.builtinNames() {
+		builtin, _ := document.lookupBuiltin(name)
+		items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: describeBuiltin(name, builtin)})
+	}
+	return items, nil
+}
+
+// formatting replaces the whole document with its formatted text. No edits
+// are returned if the document cannot be parsed.
+func (server *Server) formatting(params json.RawMessage) (interface{}, error) {
+	var formatting DocumentFormattingParams
+	if err := decodeParams(params, &formatting); err != nil {
+		return nil, err
+	}
+	document, err := server.document(formatting.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := format.Source(document.text)
+	if err != nil || formatted == document.text {
+		return make([]TextEdit, 0), nil
+	}
+	return []TextEdit{{Range: Range{End: document.end()}, NewText: formatted}}, nil
+}
@@ -0,0 +1,362 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+
+	"danielmcm.com/interpreterbook/transport"
+)
+
+// testClient talks to a server running in another goroutine over pipes.
+type testClient struct {
+	t      *testing.T
+	writer *io.PipeWriter
+	reader *bufio.Reader
+	nextID int
+	// notifications received from the server while waiting for responses
+	notifications []incoming
+	done          chan error
+}
+
+func newTestClient(t *testing.T) *testClient {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	client := &testClient{t: t, writer: clientOut, reader: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		client.done <- err
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return client
+}
+
+// call sends a request and decodes its result, failing the test if an
+// error is returned.
+func (client *testClient) call(method string, params interface{}, result interface{}) {
+	client.t.Helper()
+	if err := client.request(method, params, result); err != nil {
+		client.t.Fatalf("%s: unexpected error %v", method, err)
+	}
+}
+
+func (client *testClient) request(method string, params interface{}, result interface{}) error {
+	client.t.Helper()
+	client.nextID++
+	id := client.nextID
+	if err := transport.WriteMessage(client.writer, request{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		client.t.Fatalf("%s: writing request: %v", method, err)
+	}
+	for {
+		message := client.read()
+		if message.ID == nil {
+			client.notifications = append(client.notifications, message)
+			continue
+		}
+		if string(*message.ID) != strconv.Itoa(id) {
+			client.t.Fatalf("%s: response for unexpected id %s", method, *message.ID)
+		}
+		if message.Error != nil {
+			return message.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(message.Result, result); err != nil {
+				client.t.Fatalf("%s: decoding result %s: %v", method, message.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (client *testClient) notify(method string, params interface{}) {
+	client.t.Helper()
+	if err := transport.WriteMessage(client.writer, notification{JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		client.t.Fatalf("%s: writing notification: %v", method, err)
+	}
+}
+
+func (client *testClient) read() incoming {
+	client.t.Helper()
+	content, err := transport.ReadMessage(client.reader)
+	if err != nil {
+		client.t.Fatalf("reading message: %v", err)
+	}
+	var message incoming
+	if err := json.Unmarshal(content, &message); err != nil {
+		client.t.Fatalf("decoding message %s: %v", content, err)
+	}
+	return message
+}
+
+// diagnostics waits for the next published diagnostics.
+func (client *testClient) diagnostics() PublishDiagnosticsParams {
+	client.t.Helper()
+	var message incoming
+	if len(client.notifications) > 0 {
+		message, client.notifications = client.notifications[0], client.notifications[1:]
+	} else {
+		message = client.read()
+	}
+	if message.Method != "textDocument/publishDiagnostics" {
+		client.t.Fatalf("expected diagnostics, got %s", message.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		client.t.Fatalf("decoding diagnostics: %v", err)
+	}
+	return params
+}
+
+func (client *testClient) open(uri string, text string) PublishDiagnosticsParams {
+	client.t.Helper()
+	client.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+	})
+	return client.diagnostics()
+}
+
+func initialisedClient(t *testing.T) *testClient {
+	client := newTestClient(t)
+	var result InitializeResult
+	client.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result)
+	if !result.Capabilities.HoverProvider || result.Capabilities.TextDocumentSync != 1 {
+		t.Fatalf("unexpected capabilities %+v", result.Capabilities)
+	}
+	client.notify("initialized", map[string]interface{}{})
+	return client
+}
+
+func position(line, character int) Position {
+	return Position{Line: line, Character: character}
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: position(line, character)}
+}
+
+const testURI = "file:///test.mk"
+
+func TestLifecycle(t *testing.T) {
+	client := initialisedClient(t)
+	if err := client.request("unknown/method", nil, nil); err == nil || err.(*ResponseError).Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	client.call("shutdown", nil, nil)
+	client.notify("exit", nil)
+	if err := <-client.done; err != nil {
+		t.Errorf("unexpected error from Serve: %v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	client := initialisedClient(t)
+	client.notify("exit", nil)
+	if err := <-client.done; err != ErrNoShutdown {
+		t.Errorf("expected ErrNoShutdown, got %v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	client := initialisedClient(t)
+
+	diagnostics := client.open(testURI, "let x = ;\nlet y = 1")
+	expected := []Diagnostic{
+		{Range: Range{Start: position(0, 8), End: position(0, 9)}, Severity: SeverityError, Source: "monkey", Message: `expected expression, got token ";"`},
+	}
+	checkDiagnostics(t, diagnostics, expected)
+
+	client.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let f = fn(a) {\n  \"é😀\" + missing\n};\nf(1, 2);"}},
+	})
+	expected = []Diagnostic{
+		{Range: Range{Start: position(0, 11), End: position(0, 12)}, Severity: SeverityWarning, Code: "unused", Source: "monkey", Message: "parameter a is unused"},
+		{Range: Range{Start: position(1, 10), End: position(1, 17)}, Severity: SeverityError, Code: "undefined", Source: "monkey", Message: "undefined: missing"},
+		{Range: Range{Start: position(3, 0), End: position(3, 1)}, Severity: SeverityError, Code: "arity", Source: "monkey", Message: "f expects 1 argument, got 2"},
+	}
+	checkDiagnostics(t, client.diagnostics(), expected)
+
+	client.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	checkDiagnostics(t, client.diagnostics(), nil)
+}
+
+func TestTestFileDiagnostics(t *testing.T) {
+	client := initialisedClient(t)
+	diagnostics := client.open("file:///a_test.mk", `test("x", fn() { assert_eq(1, 1) });`)
+	if len(diagnostics.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics for the tester builtins, got %+v", diagnostics.Diagnostics)
+	}
+}
+
+func checkDiagnostics(t *testing.T, actual PublishDiagnosticsParams, expected []Diagnostic) {
+	t.Helper()
+	if actual.URI != testURI {
+		t.Errorf("diagnostics for wrong document %s", actual.URI)
+	}
+	if len(actual.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %d: %+v", len(expected), len(actual.Diagnostics), actual.Diagnostics)
+	}
+	for i, diagnostic := range actual.Diagnostics {
+		if diagnostic != expected[i] {
+			t.Errorf("diagnostic %d: expected %+v, got %+v", i, expected[i], diagnostic)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	client := initialisedClient(t)
+	client.open(testURI, "let add = fn(a, b) { a + b };\nlet xs = [1, 2];\nadd(len(xs), 1);\nlet h = {\"long\": 1, \"key\": 2, \"list\": 3, \"that\": 4, \"will\": 5, \"wrap\": 6, \"over\": 7, \"lines\": 8};\nh")
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{2, 1, "let add = fn(a, b)"},
+		{2, 4, "(builtin) len: function of 1 argument"},
+		{2, 10, "let xs = [1, 2]"},
+		{0, 21, "(parameter) a of fn(a, b)"},
+		{4, 0, "let h = { …"},
+	}
+	for _, tt := range tests {
+		var hover *Hover
+		client.call("textDocument/hover", at(testURI, tt.line, tt.character), &hover)
+		if hover == nil {
+			t.Errorf("%d:%d: expected hover", tt.line, tt.character)
+			continue
+		}
+		expected := "```monkey\n" + tt.expected + "\n```"
+		if hover.Contents.Value != expected {
+			t.Errorf("%d:%d: expected %q, got %q", tt.line, tt.character, expected, hover.Contents.Value)
+		}
+	}
+
+	var hover *Hover
+	client.call("textDocument/hover", at(testURI, 1, 13), &hover)
+	if hover != nil {
+		t.Errorf("expected no hover on a literal, got %+v", hover)
+	}
+
+	// test files have the tester's builtins
+	client.open("file:///a_test.mk", `test("x", fn() { assert_eq(1, 1) });`)
+	client.call("textDocument/hover", at("file:///a_test.mk", 0, 18), &hover)
+	if expected := "```monkey\n(builtin) assert_eq: function of any number of arguments\n```"; hover == nil || hover.Contents.Value != expected {
+		t.Errorf("expected hover %q, got %+v", expected, hover)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	client := initialisedClient(t)
+	client.open(testURI, "let x = 1;\nlet f = fn(x) { x };\nf(x); len(x)")
+
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{2, 0, &Range{Start: position(1, 4), End: position(1, 5)}},
+		{2, 2, &Range{Start: position(0, 4), End: position(0, 5)}},
+		{1, 16, &Range{Start: position(1, 11), End: position(1, 12)}},
+		{0, 4, &Range{Start: position(0, 4), End: position(0, 5)}},
+		{2, 7, nil},
+	}
+	for _, tt := range tests {
+		var location *Location
+		client.call("textDocument/definition", at(testURI, tt.line, tt.character), &location)
+		if tt.expected == nil {
+			if location != nil {
+				t.Errorf("%d:%d: expected no definition, got %+v", tt.line, tt.character, location)
+			}
+			continue
+		}
+		if location == nil || location.URI != testURI || location.Range != *tt.expected {
+			t.Errorf("%d:%d: expected %+v, got %+v", tt.line, tt.character, tt.expected, location)
+		}
+	}
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	client := initialisedClient(t)
+	client.open(testURI, "let x = 1;\nlet add = fn(a, b) { let inner = 1; a + b };\nputs(x);")
+
+	var symbols []DocumentSymbol
+	client.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &symbols)
+	expected := []DocumentSymbol{
+		{Name: "x", Kind: SymbolVariable, Range: Range{Start: position(0, 0), End: position(0, 5)}, SelectionRange: Range{Start: position(0, 4), End: position(0, 5)}},
+		{Name: "add", Detail: "fn(a, b)", Kind: SymbolFunction, Range: Range{Start: position(1, 0), End: position(1, 7)}, SelectionRange: Range{Start: position(1, 4), End: position(1, 7)}},
+	}
+	if len(symbols) != len(expected) {
+		t.Fatalf("expected %d symbols, got %+v", len(expected), symbols)
+	}
+	for i, symbol := range symbols {
+		if symbol != expected[i] {
+			t.Errorf("symbol %d: expected %+v, got %+v", i, expected[i], symbol)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	client := initialisedClient(t)
+	client.open(testURI, "")
+
+	var items []CompletionItem
+	client.call("textDocument/completion", at(testURI, 0, 0), &items)
+	labels := make(map[string]CompletionItemKind)
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	for label, kind := range map[string]CompletionItemKind{"let": CompletionKeyword, "fn": CompletionKeyword, "len": CompletionFunction, "puts": CompletionFunction} {
+		if labels[label] != kind {
+			t.Errorf("expected completion %s of kind %d, got %d", label, kind, labels[label])
+		}
+	}
+	if _, ok := labels["assert"]; ok {
+		t.Errorf("expected no completion of assert outside test files")
+	}
+
+	client.open("file:///a_test.mk", "")
+	client.call("textDocument/completion", at("file:///a_test.mk", 0, 0), &items)
+	labels = make(map[string]CompletionItemKind)
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	for _, label := range []string{"assert", "assert_eq", "assert_throws", "test", "len"} {
+		if labels[label] != CompletionFunction {
+			t.Errorf("expected completion %s in a test file", label)
+		}
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	client := initialisedClient(t)
+	params := DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: testURI}}
+
+	client.open(testURI, "let   x=1\nx")
+	var edits []TextEdit
+	client.call("textDocument/formatting", params, &edits)
+	expected := TextEdit{Range: Range{End: position(1, 1)}, NewText: "let x = 1;\nx;\n"}
+	if len(edits) != 1 || edits[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, edits)
+	}
+
+	client.open(testURI, "let x = 1;\n")
+	client.call("textDocument/formatting", params, &edits)
+	if len(edits) != 0 {
+		t.Errorf("expected no edits for formatted source, got %+v", edits)
+	}
+
+	client.open(testURI, "let = 1;")
+	client.call("textDocument/formatting", params, &edits)
+	if len(edits) != 0 {
+		t.Errorf("expected no edits for invalid source, got %+v", edits)
+	}
+}
+
+func TestDocumentNotOpen(t *testing.T) {
+	client := initialisedClient(t)
+	err := client.request("textDocument/hover", at("file:///other.mk", 0, 0), nil)
+	if responseErr, ok := err.(*ResponseError); !ok || responseErr.Code != codeInvalidParams {
+		t.Errorf("expected invalid params error, got %v", err)
+	}
+}
@@ -8,7 +8,28 @@ import (
 	"danielmcm.com/interpreterbook/repl"
 )
 
+// commands maps each subcommand of the monkey binary to a function taking
+// the remaining arguments and returning the exit code.
+var commands = map[string]func(args []string) int{
+	"dap":   runDAP,
+	"fmt":   runFmt,
+	"lint":  runLint,
+	"lsp":   runLSP,
+	"parse": runParse,
+	"run":   runRun,
+	"test":  runTest,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(command(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,244 @@
+package object
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+// HashKey is a digest of a hashable object. Objects that are Equal have the
+// same HashKey, but distinct objects may collide.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as hash keys. The
+// second result is false when the object holds values that are not hashable,
+// such as an array containing a function.
+type Hashable interface {
+	Object
+	HashKey() (HashKey, bool)
+}
+
+func HashKeyFromObject(obj Object) (HashKey, bool) {
+	hashable, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, false
+	}
+	return hashable.HashKey()
+}
+
+func IsHashable(obj Object) bool {
+	_, ok := HashKeyFromObject(obj)
+	return ok
+}
+
+func (null *Null) HashKey() (HashKey, bool) {
+	return HashKey{Type: NULL_OBJ}, true
+}
+
+func (integer *Integer) HashKey() (HashKey, bool) {
+	return HashKey{Type: INTEGER_OBJ, Value: uint64(integer.Value)}, true
+}
+
+// HashKey gives floats with integer values the HashKey of the equal
+// integer, as they are Equal. NaN, which is not equal to itself, is not
+// hashable.
+func (float *Float) HashKey() (HashKey, bool) {
+	if integer, ok := floatInteger(float.Value); ok {
+		return (&Integer{Value: integer}).HashKey()
+	}
+	if math.IsNaN(float.Value) {
+		return HashKey{}, false
+	}
+	return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(float.Value)}, true
+}
+
+func (boolean *Boolean) HashKey() (HashKey, bool) {
+	if boolean.Value {
+		return HashKey{Type: BOOLEAN_OBJ, Value: 1}, true
+	}
+	return HashKey{Type: BOOLEAN_OBJ, Value: 0}, true
+}
+
+func (str *String) HashKey() (HashKey, bool) {
+	digest := fnv.New64a()
+	digest.Write([]byte(str.Value))
+	return HashKey{Type: STRING_OBJ, Value: digest.Sum64()}, true
+}
+
+func (arr *Array) HashKey() (HashKey, bool) {
+	digest := fnv.New64a()
+	for _, elem := range arr.Elements {
+		key, ok := HashKeyFromObject(elem)
+		if !ok {
+			return HashKey{}, false
+		}
+		writeHashKey(digest, key)
+	}
+	return HashKey{Type: ARRAY_OBJ, Value: digest.Sum64()}, true
+}
+
+// HashKey combines the digests of every entry so that hashes with the same
+// entries in a different order, which are Equal, hash identically.
+func (hash *Hash) HashKey() (HashKey, bool) {
+	var value uint64
+	for _, pair := range hash.pairs {
+		valueKey, ok := HashKeyFromObject(pair.Value)
+		if !ok {
+			return HashKey{}, false
+		}
+		digest := fnv.New64a()
+		writeHashKey(digest, pair.hashKey)
+		writeHashKey(digest, valueKey)
+		value += digest.Sum64()
+	}
+	return HashKey{Type: HASH_OBJ, Value: value}, true
+}
+
+func writeHashKey(digest io.Writer, key HashKey) {
+	var buf [8]byte
+	digest.Write([]byte(key.Type))
+	binary.LittleEndian.PutUint64(buf[:], key.Value)
+	digest.Write(buf[:])
+}
+
+type HashPair struct {
+	Key     Object
+	Value   Object
+	hashKey HashKey
+}
+
+// Hash maps hashable keys to values, remembering the order in which keys
+// were first inserted. Keys with colliding HashKeys share a bucket and are
+// told apart with Equal. The zero value is an empty hash ready to use.
+type Hash struct {
+	pairs   []HashPair
+	buckets map[HashKey][]int
+}
+
+func NewHash() *Hash {
+	return &Hash{buckets: make(map[HashKey][]int)}
+}
+
+// lookup returns the digest of key and its position in pairs, or -1 if the
+// key is not present. The final result is false if the key is not hashable.
+func (hash *Hash) lookup(key Object) (HashKey, int, bool) {
+	hashKey, ok := HashKeyFromObject(key)
+	if !ok {
+		return HashKey{}, -1, false
+	}
+	for _, i := range hash.buckets[hashKey] {
+		if Equal(hash.pairs[i].Key, key) {
+			return hashKey, i, true
+		}
+	}
+	return hashKey, -1, true
+}
+
+func (hash *Hash) Get(key Object) (Object, bool) {
+	if _, i, _ := hash.lookup(key); i >= 0 {
+		return hash.pairs[i].Value, true
+	}
+	return nil, false
+}
+
+// Set stores a value for the key, returning false if the key is not
+// hashable. Replacing the value of an existing key keeps its original
+// position.
+func (hash *Hash) Set(key Object, val Object) bool {
+	hashKey, i, ok := hash.lookup(key)
+	if !ok {
+		return false
+	}
+	if i >= 0 {
+		hash.pairs[i].Value = val
+		return true
+	}
+	if hash.buckets == nil {
+		hash.buckets = make(map[HashKey][]int)
+	}
+	hash.buckets[hashKey] = append(hash.buckets[hashKey], len(hash.pairs))
+	hash.pairs = append(hash.pairs, HashPair{Key: key, Value: val, hashKey: hashKey})
+	return true
+}
+
+func (hash *Hash) Delete(key Object) {
+	hashKey, i, _ := hash.lookup(key)
+	if i < 0 {
+		return
+	}
+	hash.removeFromBucket(hashKey, i)
+	if len(hash.buckets[hashKey]) == 0 {
+		delete(hash.buckets, hashKey)
+	}
+	hash.pairs = append(hash.pairs[:i:i], hash.pairs[i+1:]...)
+	// Shift the positions of every later pair down by one
+	for j := i; j < len(hash.pairs); j++ {
+		bucket := hash.buckets[hash.pairs[j].hashKey]
+		for k, pos := range bucket {
+			if pos == j+1 {
+				bucket[k] = j
+			}
+		}
+	}
+}
+
+func (hash *Hash) removeFromBucket(hashKey HashKey, i int) {
+	bucket := hash.buckets[hashKey]
+	for k, pos := range bucket {
+		if pos == i {
+			hash.buckets[hashKey] = append(bucket[:k:k], bucket[k+1:]...)
+			return
+		}
+	}
+}
+
+func (hash *Hash) Len() int {
+	return len(hash.pairs)
+}
+
+// Pairs returns the entries in insertion order. The slice must not be
+// modified.
+func (hash *Hash) Pairs() []HashPair {
+	return hash.pairs
+}
+
+func (hash *Hash) Copy() *Hash {
+	result := &Hash{
+		pairs:   make([]HashPair, len(hash.pairs)),
+		buckets: make(map[HashKey][]int, len(hash.buckets)),
+	}
+	copy(result.pairs, hash.pairs)
+	for key, bucket := range hash.buckets {
+		result.buckets[key] = append([]int(nil), bucket...)
+	}
+	return result
+}
+
+func (hash *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+func (hash *Hash) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, pair := range hash.pairs {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if str, ok := pair.Key.(*String); ok {
+			out.WriteString("\"")
+			out.WriteString(str.Value)
+			out.WriteString("\"")
+		} else {
+			out.WriteString(pair.Key.Inspect())
+		}
+		out.WriteString(": ")
+		out.WriteString(pair.Value.Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
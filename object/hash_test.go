@@ -0,0 +1,118 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+// collidingKey always hashes to the same HashKey, and is only Equal to
+// itself.
+type collidingKey struct {
+	name string
+}
+
+func (key *collidingKey) Type() ObjectType {
+	return "COLLIDING"
+}
+func (key *collidingKey) Inspect() string {
+	return key.name
+}
+func (key *collidingKey) HashKey() (HashKey, bool) {
+	return HashKey{Type: "COLLIDING", Value: 42}, true
+}
+
+func TestHashCollisions(t *testing.T) {
+	a, b, c := &collidingKey{"a"}, &collidingKey{"b"}, &collidingKey{"c"}
+	hash := NewHash()
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(c, &Integer{Value: 3})
+	hash.Set(b, &Integer{Value: 20})
+
+	if hash.Len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", hash.Len())
+	}
+	testHashGet(t, hash, a, 1)
+	testHashGet(t, hash, b, 20)
+	testHashGet(t, hash, c, 3)
+
+	hash.Delete(a)
+	if _, ok := hash.Get(a); ok {
+		t.Fatalf("expected deleted key to be missing")
+	}
+	testHashGet(t, hash, b, 20)
+	testHashGet(t, hash, c, 3)
+	if hash.Inspect() != "{b: 20, c: 3}" {
+		t.Fatalf("unexpected Inspect output %s", hash.Inspect())
+	}
+}
+
+func TestHashStructuralKeys(t *testing.T) {
+	hash := &Hash{}
+	key := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}
+	if !hash.Set(key, &Integer{Value: 1}) {
+		t.Fatalf("expected array key to be hashable")
+	}
+	equalKey := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}
+	testHashGet(t, hash, equalKey, 1)
+
+	unhashable := &Array{Elements: []Object{&Builtin{}}}
+	if hash.Set(unhashable, &Integer{Value: 2}) {
+		t.Fatalf("expected array containing a builtin to be unhashable")
+	}
+	if hash.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", hash.Len())
+	}
+}
+
+func TestHashFloatKeys(t *testing.T) {
+	hash := &Hash{}
+	hash.Set(&Float{Value: 1.5}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 2}, &Integer{Value: 2})
+	hash.Set(&Float{Value: 2}, &Integer{Value: 20})
+	hash.Set(&Float{Value: math.Copysign(0, -1)}, &Integer{Value: 3})
+
+	// floats with integer values are the same keys as the integers
+	if hash.Len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", hash.Len())
+	}
+	testHashGet(t, hash, &Float{Value: 1.5}, 1)
+	testHashGet(t, hash, &Integer{Value: 2}, 20)
+	testHashGet(t, hash, &Integer{Value: 0}, 3)
+	if _, ok := hash.Get(&Float{Value: 1 << 63}); ok {
+		t.Fatalf("expected 2^63 not to match any integer key")
+	}
+	if hash.Set(&Float{Value: math.NaN()}, &Integer{Value: 4}) {
+		t.Fatalf("expected NaN to be unhashable")
+	}
+}
+
+func TestHashRecordKeys(t *testing.T) {
+	hash := &Hash{}
+	key := NewRecord([]string{"x", "y"}, []Object{&Integer{Value: 1}, &Float{Value: 2.5}})
+	if !hash.Set(key, &Integer{Value: 1}) {
+		t.Fatalf("expected record key to be hashable")
+	}
+	testHashGet(t, hash, NewRecord([]string{"y", "x"}, []Object{&Float{Value: 2.5}, &Float{Value: 1}}), 1)
+	if _, ok := hash.Get(NewRecord([]string{"x", "z"}, []Object{&Integer{Value: 1}, &Float{Value: 2.5}})); ok {
+		t.Fatalf("expected a record with other fields to be a different key")
+	}
+	if hash.Set(NewRecord([]string{"f"}, []Object{&Builtin{}}), &Integer{Value: 2}) {
+		t.Fatalf("expected record holding a builtin to be unhashable")
+	}
+	if key.Inspect() != "record{x: 1, y: 2.5}" {
+		t.Fatalf("unexpected Inspect output %s", key.Inspect())
+	}
+}
+
+func testHashGet(t *testing.T, hash *Hash, key Object, expected int64) {
+	t.Helper()
+	val, ok := hash.Get(key)
+	if !ok {
+		t.Fatalf("hash missing key %s", key.Inspect())
+	}
+	integer, ok := val.(*Integer)
+	if !ok || integer.Value != expected {
+		t.Fatalf("expected %s to map to %d, got %s", key.Inspect(), expected, val.Inspect())
+	}
+}
@@ -3,6 +3,11 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"danielmcm.com/interpreterbook/ast"
@@ -13,13 +18,17 @@ type ObjectType string
 const (
 	NULL_OBJ         = "NULL"
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	RECORD_OBJ       = "RECORD"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
 )
 
 type Object interface {
@@ -29,7 +38,82 @@ type Object interface {
 
 type Environment struct {
 	store map[string]Object
+	// slots hold the bindings of the names the resolver laid out for the
+	// environment, with nil for those not yet bound
+	slots []Object
+	names []string
 	outer *Environment
+	hooks *Hooks
+	// output is where the puts builtin writes, or nil for standard output
+	output io.Writer
+}
+
+// Hooks are called by the evaluator as it runs a program, for tools such as
+// debuggers. Any of them may be nil. They are set on an environment and
+// apply to evaluation in it and every environment enclosed by it after
+// they are set.
+type Hooks struct {
+	// Statement is called before each statement other than a block is
+	// evaluated. Returning an error stops evaluation with that error.
+	Statement func(statement ast.Statement, env *Environment) error
+	// Expression is called before each expression is evaluated. Returning an
+	// error stops evaluation with that error.
+	Expression func(expression ast.Expression, env *Environment) error
+	// Call is called when a function or builtin is called, after its
+	// arguments are evaluated. The function it returns is called when the
+	// call returns.
+	Call func(call *ast.CallExpression, function Object, args []Object) func()
+	// Branch is called when an if expression's condition has been
+	// evaluated, reporting whether the consequence will be evaluated.
+	Branch func(expression *ast.IfExpression, consequence bool)
+}
+
+// JoinHooks returns hooks calling each of the given hooks in turn, so that
+// several tools can follow the same evaluation. A Statement or Expression
+// hook returning an error stops the others being called.
+func JoinHooks(hooks ...*Hooks) *Hooks {
+	return &Hooks{
+		Statement: func(statement ast.Statement, env *Environment) error {
+			for _, h := range hooks {
+				if h.Statement != nil {
+					if err := h.Statement(statement, env); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Expression: func(expression ast.Expression, env *Environment) error {
+			for _, h := range hooks {
+				if h.Expression != nil {
+					if err := h.Expression(expression, env); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Call: func(call *ast.CallExpression, function Object, args []Object) func() {
+			returns := make([]func(), 0, len(hooks))
+			for _, h := range hooks {
+				if h.Call != nil {
+					returns = append(returns, h.Call(call, function, args))
+				}
+			}
+			return func() {
+				for i := len(returns) - 1; i >= 0; i-- {
+					returns[i]()
+				}
+			}
+		},
+		Branch: func(expression *ast.IfExpression, consequence bool) {
+			for _, h := range hooks {
+				if h.Branch != nil {
+					h.Branch(expression, consequence)
+				}
+			}
+		},
+	}
 }
 
 func NewEnvironment() *Environment {
@@ -40,22 +124,120 @@ func NewEnvironment() *Environment {
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.hooks = outer.hooks
+	env.output = outer.output
 	return env
 }
 
+// NewSlotEnvironment creates an environment enclosed by outer with a slot
+// for each of the names, as laid out by the resolver for a function call or
+// match arm. Names without slots can still be bound.
+func NewSlotEnvironment(outer *Environment, names []string) *Environment {
+	return &Environment{slots: make([]Object, len(names)), names: names, outer: outer, hooks: outer.hooks, output: outer.output}
+}
+
 func (env *Environment) Get(name string) (Object, bool) {
-	val, ok := env.store[name]
-	if !ok && env.outer != nil {
-		return env.outer.Get(name)
+	for ; env != nil; env = env.outer {
+		if val, ok := env.store[name]; ok {
+			return val, true
+		}
+		for i, slotName := range env.names {
+			if slotName == name && env.slots[i] != nil {
+				return env.slots[i], true
+			}
+		}
 	}
-	return val, ok
+	return nil, false
 }
 
 func (env *Environment) Set(name string, val Object) Object {
+	for i, slotName := range env.names {
+		if slotName == name {
+			env.slots[i] = val
+			return val
+		}
+	}
+	if env.store == nil {
+		env.store = make(map[string]Object)
+	}
 	env.store[name] = val
 	return val
 }
 
+// GetSlot returns the value in a slot of the environment depth levels out
+// from this one, or false if it has not been bound or there is no such
+// slot.
+func (env *Environment) GetSlot(depth int, slot int) (Object, bool) {
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	if env == nil || slot >= len(env.slots) {
+		return nil, false
+	}
+	val := env.slots[slot]
+	return val, val != nil
+}
+
+// SetSlot binds a value in a slot of this environment, returning false if
+// there is no such slot.
+func (env *Environment) SetSlot(slot int, val Object) bool {
+	if slot >= len(env.slots) {
+		return false
+	}
+	env.slots[slot] = val
+	return true
+}
+
+// Names returns the names bound in this environment, but not those in the
+// environments enclosing it, sorted.
+func (env *Environment) Names() []string {
+	names := make([]string, 0, len(env.store)+len(env.slots))
+	for name := range env.store {
+		names = append(names, name)
+	}
+	for i, name := range env.names {
+		if env.slots[i] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Outer returns the environment enclosing this one, or nil.
+func (env *Environment) Outer() *Environment {
+	return env.outer
+}
+
+// SetHooks sets the hooks for evaluation in this environment and the
+// environments it encloses that are created afterwards, which copy them so
+// that finding the hooks for a node is a single field read. Nil removes
+// them.
+func (env *Environment) SetHooks(hooks *Hooks) {
+	env.hooks = hooks
+}
+
+// Hooks returns the hooks for evaluation in this environment, or nil.
+func (env *Environment) Hooks() *Hooks {
+	return env.hooks
+}
+
+// SetOutput sets where the puts builtin writes when called in this
+// environment and the environments it encloses that are created
+// afterwards, as for SetHooks. Nil restores standard output.
+func (env *Environment) SetOutput(output io.Writer) {
+	env.output = output
+}
+
+// Output returns where the puts builtin writes when called in this
+// environment.
+func (env *Environment) Output() io.Writer {
+	if env.output == nil {
+		return os.Stdout
+	}
+	return env.output
+}
+
 type Null struct{}
 
 func (null *Null) Type() ObjectType {
@@ -76,6 +258,33 @@ func (integer *Integer) Inspect() string {
 	return fmt.Sprintf("%d", integer.Value)
 }
 
+type Float struct {
+	Value float64
+}
+
+func (float *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect prints the shortest form of the float that reads back as it,
+// with a fraction or exponent so that it does not look like an integer.
+func (float *Float) Inspect() string {
+	text := strconv.FormatFloat(float.Value, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eIN") {
+		text += ".0"
+	}
+	return text
+}
+
+// floatInteger returns the integer equal to a float, if there is one.
+func floatInteger(value float64) (int64, bool) {
+	// NaN fails every comparison, and the infinities are out of range
+	if value != math.Trunc(value) || value < math.MinInt64 || value >= 1<<63 {
+		return 0, false
+	}
+	return int64(value), true
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -122,99 +331,6 @@ func (arr *Array) Inspect() string {
 	return out.String()
 }
 
-type HashKey struct {
-	Type ObjectType
-	str  string
-	num  int64
-}
-
-func HashKeyFromString(str string) HashKey {
-	return HashKey{Type: STRING_OBJ, str: str}
-}
-func HashKeyFromInt(integer int64) HashKey {
-	return HashKey{Type: INTEGER_OBJ, num: integer}
-}
-func HashKeyFromBool(boolean bool) HashKey {
-	key := HashKey{Type: BOOLEAN_OBJ}
-	if boolean {
-		key.num = 1
-	}
-	return key
-}
-func HashKeyFromObject(obj Object) (HashKey, bool) {
-	switch obj := obj.(type) {
-	case *String:
-		return HashKeyFromString(obj.Value), true
-	case *Integer:
-		return HashKeyFromInt(obj.Value), true
-	case *Boolean:
-		return HashKeyFromBool(obj.Value), true
-	default:
-		return HashKey{}, false
-	}
-}
-
-func (key *HashKey) AsString() (string, bool) {
-	if key.Type == STRING_OBJ {
-		return key.str, true
-	}
-	return "", false
-}
-
-func (key *HashKey) AsInteger() (int64, bool) {
-	if key.Type == INTEGER_OBJ {
-		return key.num, true
-	}
-	return 0, false
-}
-
-func (key *HashKey) AsBoolean() (bool, bool) {
-	if key.Type == BOOLEAN_OBJ {
-		if key.num == 1 {
-			return true, true
-		} else {
-			return false, true
-		}
-	}
-	return false, false
-}
-
-type Hash struct {
-	Entries map[HashKey]Object
-}
-
-func (hash *Hash) Type() ObjectType {
-	return HASH_OBJ
-}
-func (hash *Hash) Inspect() string {
-	var out bytes.Buffer
-	out.WriteString("{")
-	first := true
-	for key, elem := range hash.Entries {
-		if !first {
-			out.WriteString(", ")
-		}
-		if str, ok := key.AsString(); ok {
-			out.WriteString("\"")
-			out.WriteString(str)
-			out.WriteString("\"")
-		} else if num, ok := key.AsInteger(); ok {
-			out.WriteString(fmt.Sprintf("%d", num))
-		} else if bool, ok := key.AsBoolean(); ok {
-			if bool {
-				out.WriteString("true")
-			} else {
-				out.WriteString("false")
-			}
-		}
-		out.WriteString(": ")
-		out.WriteString(elem.Inspect())
-		first = false
-	}
-	out.WriteString("}")
-	return out.String()
-}
-
 type ReturnValue struct {
 	Value Object
 }
@@ -227,9 +343,14 @@ func (returnValue *ReturnValue) Inspect() string {
 }
 
 type Function struct {
-	Parameters []string
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters []ast.Parameter
+	// Rest is the parameter taking any further arguments, or nil
+	Rest *ast.Identifier
+	Body *ast.BlockStatement
+	// Slots are the names laid out by the resolver for the environment of
+	// a call
+	Slots []string
+	Env   *Environment
 }
 
 func (fn *Function) Type() ObjectType {
@@ -237,17 +358,32 @@ func (fn *Function) Type() ObjectType {
 }
 func (fn *Function) Inspect() string {
 	var out bytes.Buffer
+	params := make([]string, len(fn.Parameters), len(fn.Parameters)+1)
+	for i, param := range fn.Parameters {
+		params[i] = param.String()
+	}
+	if fn.Rest != nil {
+		params = append(params, "..."+fn.Rest.Value)
+	}
 	out.WriteString("fn(")
-	out.WriteString(strings.Join(fn.Parameters, ", "))
+	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
 	out.WriteString(fn.Body.String())
 	return out.String()
 }
 
-type BuiltinFunction func(args ...Object) (Object, error)
+// BuiltinFunction is the implementation of a builtin, given the
+// environment it is called in and its arguments.
+type BuiltinFunction func(env *Environment, args ...Object) (Object, error)
+
+// Variadic is the Arity of builtins taking any number of arguments.
+const Variadic = -1
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// Arity is the number of arguments the builtin takes, or Variadic. It is
+	// checked by Fn, and used by tools such as the linter.
+	Arity int
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -256,3 +392,108 @@ func (b *Builtin) Type() ObjectType {
 func (b *Builtin) Inspect() string {
 	return "builtin function"
 }
+
+// Quote is unevaluated code, returned by quote.
+type Quote struct {
+	Node ast.Node
+}
+
+func (quote *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+func (quote *Quote) Inspect() string {
+	return "QUOTE(" + quote.Node.String() + ")"
+}
+
+// Macro is a macro defined by a top-level let statement, which is expanded
+// before the program is evaluated.
+type Macro struct {
+	Parameters []string
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (macro *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+func (macro *Macro) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(macro.Parameters, ", "))
+	out.WriteString(") ")
+	out.WriteString(macro.Body.String())
+	return out.String()
+}
+
+// Equal reports whether two objects are structurally equal. Integers and
+// floats are equal when they have the same value. Arrays are equal when
+// their elements are equal in order; hashes are equal when they hold the
+// same keys with equal values, regardless of insertion order, and records
+// when they have the same fields with equal values.
+func Equal(left Object, right Object) bool {
+	switch left := left.(type) {
+	case *Null:
+		_, ok := right.(*Null)
+		return ok
+	case *Integer:
+		switch right := right.(type) {
+		case *Integer:
+			return left.Value == right.Value
+		case *Float:
+			integer, ok := floatInteger(right.Value)
+			return ok && left.Value == integer
+		}
+		return false
+	case *Float:
+		switch right := right.(type) {
+		case *Float:
+			return left.Value == right.Value
+		case *Integer:
+			return Equal(right, left)
+		}
+		return false
+	case *Boolean:
+		right, ok := right.(*Boolean)
+		return ok && left.Value == right.Value
+	case *String:
+		right, ok := right.(*String)
+		return ok && left.Value == right.Value
+	case *Array:
+		right, ok := right.(*Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for i, elem := range left.Elements {
+			if !Equal(elem, right.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Record:
+		right, ok := right.(*Record)
+		if !ok || len(left.names) != len(right.names) {
+			return false
+		}
+		for i, name := range left.names {
+			val, ok := right.Field(name)
+			if !ok || !Equal(left.values[i], val) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		right, ok := right.(*Hash)
+		if !ok || left.Len() != right.Len() {
+			return false
+		}
+		for _, pair := range left.pairs {
+			val, ok := right.Get(pair.Key)
+			if !ok || !Equal(pair.Value, val) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
@@ -0,0 +1,72 @@
+package object
+
+import (
+	"bytes"
+	"hash/fnv"
+)
+
+// Record is an immutable value with named fields, kept in the order they
+// were given. Records can be hash keys when their field values can.
+type Record struct {
+	names  []string
+	values []Object
+}
+
+// NewRecord creates a record with a field for each name, which must be
+// distinct, holding the value at the same index.
+func NewRecord(names []string, values []Object) *Record {
+	return &Record{names: names, values: values}
+}
+
+// Field returns the value of the named field, or false if the record has
+// no such field.
+func (record *Record) Field(name string) (Object, bool) {
+	for i, fieldName := range record.names {
+		if fieldName == name {
+			return record.values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of the record's fields, in order.
+func (record *Record) Names() []string {
+	return append([]string(nil), record.names...)
+}
+
+func (record *Record) Type() ObjectType {
+	return RECORD_OBJ
+}
+func (record *Record) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("record{")
+	for i, name := range record.names {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(name)
+		out.WriteString(": ")
+		out.WriteString(record.values[i].Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// HashKey combines the digests of every field, like the HashKey of a hash,
+// so that records with the same fields in a different order, which are
+// Equal, hash identically.
+func (record *Record) HashKey() (HashKey, bool) {
+	var value uint64
+	for i, name := range record.names {
+		valueKey, ok := HashKeyFromObject(record.values[i])
+		if !ok {
+			return HashKey{}, false
+		}
+		nameKey, _ := (&String{Value: name}).HashKey()
+		digest := fnv.New64a()
+		writeHashKey(digest, nameKey)
+		writeHashKey(digest, valueKey)
+		value += digest.Sum64()
+	}
+	return HashKey{Type: RECORD_OBJ, Value: value}, true
+}
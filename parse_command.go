@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+// runParse implements `monkey parse [-json] [file]`, printing the syntax
+// tree of a program, or of standard input if no file is given.
+func runParse(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey parse [-json] [file]")
+		return 2
+	}
+
+	path := "<stdin>"
+	var source []byte
+	var err error
+	if flags.NArg() == 0 {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		path = flags.Arg(0)
+		source, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	parser := parser.New(lexer.New(string(source)))
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		printFileErrors(path, errors.Join(errs...))
+		return 1
+	}
+	if !*asJSON {
+		fmt.Print(program.String())
+		return 0
+	}
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
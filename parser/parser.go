@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"danielmcm.com/interpreterbook/ast"
 	"danielmcm.com/interpreterbook/lexer"
@@ -16,6 +17,8 @@ type Parser struct {
 	currentToken token.Token
 	peekToken    token.Token
 	errors       []error
+	// number of braces enclosing currentToken
+	depth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -27,9 +30,13 @@ type (
 )
 
 type ParseError struct {
-	reason string
+	Position token.Position
+	reason   string
 }
 
+// maxErrors is the number of errors reported before parsing is abandoned.
+const maxErrors = 10
+
 const (
 	_ int = iota
 	LOWEST
@@ -55,7 +62,9 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET: INDEX,
 }
 
-func getPrecedence(tokenType token.TokenType) int {
+// Precedence returns how tightly an infix or postfix operator token binds,
+// or LOWEST for other tokens.
+func Precedence(tokenType token.TokenType) int {
 	if precedence, ok := precedences[tokenType]; ok {
 		return precedence
 	}
@@ -69,13 +78,17 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.infixParseFns = make(map[token.TokenType]infixParseFn)
 	parser.registerPrefix(token.IDENT, parser.parseIdentifier)
 	parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+	parser.registerPrefix(token.FLOAT, parser.parseFloatLiteral)
 	parser.registerPrefix(token.TRUE, parser.parseBooleanLiteral)
 	parser.registerPrefix(token.FALSE, parser.parseBooleanLiteral)
 	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
+	parser.registerPrefix(token.INTERPOLATED_STRING, parser.parseInterpolatedString)
 	parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
 	parser.registerPrefix(token.IF, parser.parseIfExpression)
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionalLiteral)
+	parser.registerPrefix(token.MACRO, parser.parseMacroLiteral)
+	parser.registerPrefix(token.MATCH, parser.parseMatchExpression)
 	parser.registerPrefix(token.LBRACKET, parser.parseArrayExpression)
 	parser.registerPrefix(token.LBRACE, parser.parseHashExpression)
 	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
@@ -91,7 +104,6 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
 
 	// Populate current and peek token
-	// todo handle error
 	parser.nextToken()
 	parser.nextToken()
 
@@ -106,43 +118,127 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func (parser *Parser) nextToken() error {
+// nextToken advances to the next token. Tokenisation errors are recorded,
+// and the lexer's ILLEGAL token takes the place of the malformed one.
+func (parser *Parser) nextToken() {
 	parser.currentToken = parser.peekToken
+	switch parser.currentToken.Type {
+	case token.LBRACE:
+		parser.depth++
+	case token.RBRACE:
+		if parser.depth > 0 {
+			parser.depth--
+		}
+	}
 	newToken, err := parser.lexer.NextToken()
 	if err != nil {
-		return err
+		parser.addError(err)
 	}
 	parser.peekToken = newToken
-	return nil
 }
 
 func (parser *Parser) Errors() []error {
 	return parser.errors
 }
 
+// addError records an error, ignoring any at the same position as the
+// previous error since they are usually caused by it.
+func (parser *Parser) addError(err error) {
+	if len(parser.errors) > maxErrors {
+		return
+	}
+	position, ok := ErrorPosition(err)
+	if count := len(parser.errors); ok && count > 0 {
+		if previous, ok := ErrorPosition(parser.errors[count-1]); ok && previous == position {
+			return
+		}
+	}
+	if len(parser.errors) == maxErrors {
+		err = ParseError{Position: position, reason: "too many errors"}
+	}
+	parser.errors = append(parser.errors, err)
+}
+
+// ErrorPosition returns the position of a parse or tokenisation error.
+func ErrorPosition(err error) (token.Position, bool) {
+	var errParse ParseError
+	if errors.As(err, &errParse) {
+		return errParse.Position, true
+	}
+	var errLexer *lexer.Error
+	if errors.As(err, &errLexer) {
+		return errLexer.Position, true
+	}
+	return token.Position{}, false
+}
+
+// ParseProgram parses statements until the end of the input. After an error
+// the parser skips to the next statement in the same block, or at the top
+// level, so that several errors can be reported at once.
 func (parser *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for !parser.currentTokenIs(token.EOF) {
+	for !parser.currentTokenIs(token.EOF) && len(parser.errors) <= maxErrors {
+		start := parser.currentToken
 		statement, err := parser.ParseStatement()
-		tokenErr := parser.nextToken()
-		if err == nil {
-			program.Statements = append(program.Statements, statement)
-			err = tokenErr
-		}
 		if err != nil {
-			parser.errors = append(parser.errors, err)
-			var errParse ParseError
-			if !errors.As(err, &errParse) {
-				break
-			}
+			parser.addError(err)
+			parser.synchronise(start, 0)
+			continue
 		}
+		program.Statements = append(program.Statements, statement)
+		parser.nextToken()
 	}
 
 	return program
 }
 
+// synchronise skips tokens following an error in the statement starting at
+// start, which is nested in depth braces, stopping at the beginning of the
+// next statement at the same depth: after a semicolon or closing brace, or
+// at a let or return keyword. In a block, it also stops at the brace closing
+// the block.
+func (parser *Parser) synchronise(start token.Token, depth int) {
+	for !parser.currentTokenIs(token.EOF) {
+		if parser.depth < depth {
+			return
+		}
+		if parser.depth == depth && parser.currentToken != start && parser.isStatementKeyword() {
+			return
+		}
+		previous := parser.currentToken.Type
+		parser.nextToken()
+		if parser.depth != depth {
+			continue
+		}
+		if previous == token.SEMICOLON {
+			return
+		}
+		if previous == token.RBRACE && !parser.continuesExpression() {
+			return
+		}
+	}
+}
+
+func (parser *Parser) isStatementKeyword() bool {
+	return parser.currentTokenIs(token.LET) || parser.currentTokenIs(token.RETURN)
+}
+
+// continuesExpression reports whether the current token can continue an
+// expression ending in a closing brace, as in `if (x) {} else {}` or
+// `fn() {}()`.
+func (parser *Parser) continuesExpression() bool {
+	if parser.currentTokenIs(token.ELSE) || parser.currentTokenIs(token.SEMICOLON) {
+		return true
+	}
+	return Precedence(parser.currentToken.Type) > LOWEST
+}
+
+func (parser *Parser) errorAt(position token.Position, format string, args ...interface{}) ParseError {
+	return ParseError{Position: position, reason: fmt.Sprintf(format, args...)}
+}
+
 func (parser *Parser) ParseStatement() (ast.Statement, error) {
 	switch parser.currentToken.Type {
 	case token.LET:
@@ -154,21 +250,29 @@ func (parser *Parser) ParseStatement() (ast.Statement, error) {
 	}
 }
 
+// ParseLetStatement parses let name = value, or let followed by an array
+// or hash pattern destructuring the value.
 func (parser *Parser) ParseLetStatement() (*ast.LetStatement, error) {
 	statement := &ast.LetStatement{Token: parser.currentToken}
 
-	if err := parser.expectPeek(token.IDENT); err != nil {
-		return nil, err
+	if parser.peekTokenIs(token.LBRACKET) || parser.peekTokenIs(token.LBRACE) {
+		parser.nextToken()
+		pattern, err := parser.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		statement.Pattern = pattern
+	} else {
+		if err := parser.expectPeek(token.IDENT); err != nil {
+			return nil, err
+		}
+		statement.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
 	}
 
-	statement.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
-
 	if err := parser.expectPeek(token.ASSIGN); err != nil {
 		return nil, err
 	}
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	parser.nextToken()
 
 	expr, err := parser.ParseExpression(LOWEST)
 	if err != nil {
@@ -177,18 +281,14 @@ func (parser *Parser) ParseLetStatement() (*ast.LetStatement, error) {
 	statement.Value = expr
 
 	if parser.peekTokenIs(token.SEMICOLON) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 	}
 	return statement, nil
 }
 
 func (parser *Parser) ParseReturnStatement() (*ast.ReturnStatement, error) {
 	statement := &ast.ReturnStatement{Token: parser.currentToken}
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	parser.nextToken()
 
 	expr, err := parser.ParseExpression(LOWEST)
 	if err != nil {
@@ -197,9 +297,7 @@ func (parser *Parser) ParseReturnStatement() (*ast.ReturnStatement, error) {
 	statement.ReturnValue = expr
 
 	if parser.peekTokenIs(token.SEMICOLON) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 	}
 	return statement, nil
 }
@@ -213,21 +311,19 @@ func (parser *Parser) ParseExpressionStatement() (*ast.ExpressionStatement, erro
 	statement.Expression = expr
 
 	for parser.peekTokenIs(token.SEMICOLON) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 	}
 	return statement, nil
 }
 
 func (parser *Parser) ParseExpression(precedence int) (ast.Expression, error) {
 	if parser.currentToken.Type == token.EOF {
-		return nil, ParseError{reason: "unexpected end of file, expected expression"}
+		return nil, parser.errorAt(parser.currentToken.Position, "unexpected end of file, expected expression")
 	}
 	prefix := parser.prefixParseFns[parser.currentToken.Type]
 
 	if prefix == nil {
-		return nil, ParseError{reason: fmt.Sprintf("expected expression, got token %q", parser.currentToken.Literal)}
+		return nil, parser.errorAt(parser.currentToken.Position, "expected expression, got token %q", parser.currentToken.Literal)
 	}
 
 	leftExpr, err := prefix()
@@ -235,14 +331,12 @@ func (parser *Parser) ParseExpression(precedence int) (ast.Expression, error) {
 		return nil, err
 	}
 
-	for !parser.peekTokenIs(token.SEMICOLON) && precedence < getPrecedence(parser.peekToken.Type) {
+	for !parser.peekTokenIs(token.SEMICOLON) && precedence < Precedence(parser.peekToken.Type) {
 		infix := parser.infixParseFns[parser.peekToken.Type]
 		if infix == nil {
-			return nil, ParseError{reason: fmt.Sprintf("cannot parse infix expression for operator %q", parser.peekToken.Literal)}
-		}
-		if err := parser.nextToken(); err != nil {
-			return nil, err
+			return nil, parser.errorAt(parser.peekToken.Position, "cannot parse infix expression for operator %q", parser.peekToken.Literal)
 		}
+		parser.nextToken()
 		infixExpr, err := infix(leftExpr)
 		if err != nil {
 			return nil, err
@@ -257,13 +351,36 @@ func (parser *Parser) parseIdentifier() (ast.Expression, error) {
 }
 
 func (parser *Parser) parseIntegerLiteral() (ast.Expression, error) {
-	value, err := strconv.ParseInt(parser.currentToken.Literal, 10, 64)
+	digits := strings.ReplaceAll(parser.currentToken.Literal, "_", "")
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	value, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
-		return nil, err
+		return nil, parser.errorAt(parser.currentToken.Position, "integer literal %s out of range", parser.currentToken.Literal)
 	}
 	return &ast.IntegerLiteral{Token: parser.currentToken, Value: value}, nil
 }
 
+func (parser *Parser) parseFloatLiteral() (ast.Expression, error) {
+	value, err := strconv.ParseFloat(strings.ReplaceAll(parser.currentToken.Literal, "_", ""), 64)
+	if err != nil {
+		return nil, parser.errorAt(parser.currentToken.Position, "float literal %s out of range", parser.currentToken.Literal)
+	}
+	return &ast.FloatLiteral{Token: parser.currentToken, Value: value}, nil
+}
+
 func (parser *Parser) parseBooleanLiteral() (ast.Expression, error) {
 	return &ast.BooleanLiteral{
 		Token: parser.currentToken,
@@ -275,14 +392,92 @@ func (parser *Parser) parseStringLiteral() (ast.Expression, error) {
 	return &ast.StringLiteral{Token: parser.currentToken, Value: parser.currentToken.Literal}, nil
 }
 
+func (parser *Parser) parseInterpolatedString() (ast.Expression, error) {
+	expr := &ast.InterpolatedString{Token: parser.currentToken}
+	position := parser.currentToken.Position
+	parts, err := lexer.SplitInterpolatedString(parser.currentToken.Literal)
+	if err != nil {
+		return nil, parser.errorAt(position, "%s", err)
+	}
+	positions := interpolationPositions(parser.currentToken)
+	for _, part := range parts {
+		if !part.IsExpression {
+			text := &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: part.Text, Position: position},
+				Value: part.Text,
+			}
+			expr.Parts = append(expr.Parts, text)
+			continue
+		}
+		sourcePosition := position
+		if len(positions) > 0 {
+			sourcePosition, positions = positions[0], positions[1:]
+		}
+		embedded, err := parseEmbeddedExpression(part.Source, sourcePosition)
+		if err != nil {
+			return nil, err
+		}
+		expr.Parts = append(expr.Parts, embedded)
+	}
+	return expr, nil
+}
+
+// interpolationPositions returns the positions of the sources of the
+// expressions embedded in an interpolated string token. They are found in
+// the token's source text, as the literal of a triple quoted string has been
+// dedented.
+func interpolationPositions(literal token.Token) []token.Position {
+	delimiter := `"`
+	if strings.HasPrefix(literal.Raw, `"""`) {
+		delimiter = `"""`
+	}
+	if len(literal.Raw) < 2*len(delimiter) {
+		return nil
+	}
+	parts, err := lexer.SplitInterpolatedString(literal.Raw[len(delimiter) : len(literal.Raw)-len(delimiter)])
+	if err != nil {
+		return nil
+	}
+	positions := make([]token.Position, 0, len(parts))
+	for _, part := range parts {
+		if part.IsExpression {
+			positions = append(positions, literal.Position.Advance(literal.Raw[:len(delimiter)+part.Offset]))
+		}
+	}
+	return positions
+}
+
+// parseEmbeddedExpression parses the source of a ${...} interpolation, found
+// at position, which must contain exactly one expression.
+func parseEmbeddedExpression(source string, position token.Position) (ast.Expression, error) {
+	parser := New(lexer.NewAt(source, position))
+	if parser.currentTokenIs(token.EOF) {
+		return nil, ParseError{Position: position, reason: "empty interpolation in string literal"}
+	}
+	expr, err := parser.ParseExpression(LOWEST)
+	if len(parser.errors) > 0 {
+		err = parser.errors[0]
+	}
+	if err != nil {
+		errPosition, ok := ErrorPosition(err)
+		if !ok {
+			errPosition = position
+		}
+		reason := strings.TrimPrefix(err.Error(), errPosition.String()+": ")
+		return nil, ParseError{Position: errPosition, reason: fmt.Sprintf("in string interpolation: %s", reason)}
+	}
+	if !parser.peekTokenIs(token.EOF) {
+		return nil, ParseError{Position: parser.peekToken.Position, reason: fmt.Sprintf("unexpected token %s in string interpolation, expected }", parser.peekToken.Literal)}
+	}
+	return expr, nil
+}
+
 func (parser *Parser) parsePrefixExpression() (ast.Expression, error) {
 	expr := &ast.PrefixExpression{
 		Token:    parser.currentToken,
 		Operator: parser.currentToken.Literal,
 	}
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	parser.nextToken()
 	right, err := parser.ParseExpression(PREFIX)
 	if err != nil {
 		return nil, err
@@ -297,10 +492,8 @@ func (parser *Parser) parseInfixExpression(left ast.Expression) (ast.Expression,
 		Operator: parser.currentToken.Literal,
 		Left:     left,
 	}
-	precedence := getPrecedence(parser.currentToken.Type)
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	precedence := Precedence(parser.currentToken.Type)
+	parser.nextToken()
 
 	right, err := parser.ParseExpression(precedence)
 	if err != nil {
@@ -311,9 +504,7 @@ func (parser *Parser) parseInfixExpression(left ast.Expression) (ast.Expression,
 }
 
 func (parser *Parser) parseGroupedExpression() (ast.Expression, error) {
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	parser.nextToken()
 
 	expr, err := parser.ParseExpression(LOWEST)
 	if err != nil {
@@ -326,24 +517,25 @@ func (parser *Parser) parseGroupedExpression() (ast.Expression, error) {
 	return expr, nil
 }
 
+// parseBlockStatement parses the statements of a block. Errors in them are
+// recorded, skipping to the next statement in the block, so that they do
+// not hide errors later in the block.
 func (parser *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 	block := &ast.BlockStatement{Token: parser.currentToken}
 	block.Statements = []ast.Statement{}
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	depth := parser.depth
+	parser.nextToken()
 
-	for !parser.currentTokenIs(token.RBRACE) && !parser.currentTokenIs(token.EOF) {
+	for !parser.currentTokenIs(token.RBRACE) && !parser.currentTokenIs(token.EOF) && len(parser.errors) <= maxErrors {
+		start := parser.currentToken
 		statement, err := parser.ParseStatement()
-		if err == nil {
-			block.Statements = append(block.Statements, statement)
-		} else {
-			return nil, err
-		}
-
-		if err := parser.nextToken(); err != nil {
-			return nil, err
+		if err != nil {
+			parser.addError(err)
+			parser.synchronise(start, depth)
+			continue
 		}
+		block.Statements = append(block.Statements, statement)
+		parser.nextToken()
 	}
 
 	return block, nil
@@ -355,9 +547,7 @@ func (parser *Parser) parseIfExpression() (ast.Expression, error) {
 	if err := parser.expectPeek(token.LPAREN); err != nil {
 		return nil, err
 	}
-	if err := parser.nextToken(); err != nil {
-		return nil, err
-	}
+	parser.nextToken()
 
 	condExpr, err := parser.ParseExpression(LOWEST)
 	if err != nil {
@@ -378,9 +568,7 @@ func (parser *Parser) parseIfExpression() (ast.Expression, error) {
 	expr.Consequence = consequence
 
 	if parser.peekTokenIs(token.ELSE) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 		if err := parser.expectPeek(token.LBRACE); err != nil {
 			return nil, err
 		}
@@ -395,55 +583,116 @@ func (parser *Parser) parseIfExpression() (ast.Expression, error) {
 }
 
 func (parser *Parser) parseFunctionalLiteral() (ast.Expression, error) {
-	expr := &ast.FunctionLiteral{Token: parser.currentToken, Parameters: make([]ast.Identifier, 0)}
+	expr := &ast.FunctionLiteral{Token: parser.currentToken}
+	parameters, rest, err := parser.parseParameters(true)
+	if err != nil {
+		return nil, err
+	}
+	expr.Parameters = parameters
+	expr.Rest = rest
+	if expr.Body, err = parser.parseBody(); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
 
-	if err := parser.expectPeek(token.LPAREN); err != nil {
+func (parser *Parser) parseMacroLiteral() (ast.Expression, error) {
+	expr := &ast.MacroLiteral{Token: parser.currentToken}
+	parameters, _, err := parser.parseParameters(false)
+	if err != nil {
+		return nil, err
+	}
+	expr.Parameters = make([]ast.Identifier, len(parameters))
+	for i, parameter := range parameters {
+		expr.Parameters[i] = *parameter.Name
+	}
+	if expr.Body, err = parser.parseBody(); err != nil {
 		return nil, err
 	}
+	return expr, nil
+}
+
+// parseParameters parses the parameters following fn or macro. Parameters
+// are names, or if extended is set, array and hash patterns that may have
+// a default value, followed by a ...name rest parameter. Once a parameter
+// has a default, those after it must too.
+func (parser *Parser) parseParameters(extended bool) ([]ast.Parameter, *ast.Identifier, error) {
+	parameters := make([]ast.Parameter, 0)
+	var rest *ast.Identifier
+	if err := parser.expectPeek(token.LPAREN); err != nil {
+		return nil, nil, err
+	}
+	defaults := false
 	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(token.RPAREN) {
-		if err := parser.expectPeek(token.IDENT); err != nil {
-			return nil, err
+		if extended && parser.peekTokenIs(token.ELLIPSIS) {
+			parser.nextToken()
+			if err := parser.expectPeek(token.IDENT); err != nil {
+				return nil, nil, err
+			}
+			rest = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+			break
 		}
-		expr.Parameters = append(expr.Parameters, ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal})
-		if parser.peekTokenIs(token.COMMA) {
-			if err := parser.nextToken(); err != nil {
-				return nil, err
+
+		var parameter ast.Parameter
+		position := parser.peekToken.Position
+		if extended && (parser.peekTokenIs(token.LBRACKET) || parser.peekTokenIs(token.LBRACE)) {
+			parser.nextToken()
+			pattern, err := parser.parsePattern()
+			if err != nil {
+				return nil, nil, err
 			}
+			parameter.Pattern = pattern
+		} else {
+			if err := parser.expectPeek(token.IDENT); err != nil {
+				return nil, nil, err
+			}
+			parameter.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+		}
+		if extended && parser.peekTokenIs(token.ASSIGN) {
+			parser.nextToken()
+			parser.nextToken()
+			value, err := parser.ParseExpression(LOWEST)
+			if err != nil {
+				return nil, nil, err
+			}
+			parameter.Default = value
+			defaults = true
+		} else if defaults {
+			return nil, nil, parser.errorAt(position, "parameter %s without a default follows a parameter with one", parameter)
+		}
+		parameters = append(parameters, parameter)
+
+		if parser.peekTokenIs(token.COMMA) {
+			parser.nextToken()
 		} else {
 			break
 		}
 	}
 	if err := parser.expectPeek(token.RPAREN); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return parameters, rest, nil
+}
 
+// parseBody parses the block following the parameters of fn or macro.
+func (parser *Parser) parseBody() (*ast.BlockStatement, error) {
 	if err := parser.expectPeek(token.LBRACE); err != nil {
 		return nil, err
 	}
-	body, err := parser.parseBlockStatement()
-	if err != nil {
-		return nil, err
-	}
-	expr.Body = body
-
-	return expr, nil
+	return parser.parseBlockStatement()
 }
 
 func (parser *Parser) parseExpressionList(endToken token.TokenType) ([]ast.Expression, error) {
 	result := make([]ast.Expression, 0)
 	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(endToken) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 		arg, err := parser.ParseExpression(LOWEST)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, arg)
 		if parser.peekTokenIs(token.COMMA) {
-			if err := parser.nextToken(); err != nil {
-				return nil, err
-			}
+			parser.nextToken()
 		} else {
 			break
 		}
@@ -455,7 +704,7 @@ func (parser *Parser) parseExpressionList(endToken token.TokenType) ([]ast.Expre
 }
 
 func (parser *Parser) parseCallExpression(function ast.Expression) (ast.Expression, error) {
-	args, err := parser.parseExpressionList(token.RPAREN)
+	args, err := parser.parseCallArguments()
 	if err != nil {
 		return nil, err
 	}
@@ -463,6 +712,55 @@ func (parser *Parser) parseCallExpression(function ast.Expression) (ast.Expressi
 	return expr, nil
 }
 
+// parseCallArguments parses the arguments of a call: expressions, ...value
+// spreading an array, and name: value arguments, which must come last.
+func (parser *Parser) parseCallArguments() ([]ast.Expression, error) {
+	args := make([]ast.Expression, 0)
+	named := make(map[string]bool)
+	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(token.RPAREN) {
+		parser.nextToken()
+		start := parser.currentToken
+		isNamed := parser.currentTokenIs(token.IDENT) && parser.peekTokenIs(token.COLON)
+		if !isNamed && len(named) > 0 {
+			return nil, parser.errorAt(start.Position, "positional argument after named argument")
+		}
+		var arg ast.Expression
+		var err error
+		switch {
+		case parser.currentTokenIs(token.ELLIPSIS):
+			spread := &ast.SpreadExpression{Token: start}
+			parser.nextToken()
+			spread.Value, err = parser.ParseExpression(LOWEST)
+			arg = spread
+		case isNamed:
+			if named[start.Literal] {
+				return nil, parser.errorAt(start.Position, "duplicate named argument %s", start.Literal)
+			}
+			named[start.Literal] = true
+			argument := &ast.NamedArgument{Name: &ast.Identifier{Token: start, Value: start.Literal}}
+			parser.nextToken()
+			parser.nextToken()
+			argument.Value, err = parser.ParseExpression(LOWEST)
+			arg = argument
+		default:
+			arg, err = parser.ParseExpression(LOWEST)
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if parser.peekTokenIs(token.COMMA) {
+			parser.nextToken()
+		} else {
+			break
+		}
+	}
+	if err := parser.expectPeek(token.RPAREN); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
 func (parser *Parser) parseArrayExpression() (ast.Expression, error) {
 	elements, err := parser.parseExpressionList(token.RBRACKET)
 	if err != nil {
@@ -476,9 +774,7 @@ func (parser *Parser) parseHashExpression() (ast.Expression, error) {
 	expr := ast.HashExpression{Token: parser.currentToken}
 	entries := make([]ast.HashEntry, 0)
 	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(token.RBRACE) {
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 		key, err := parser.ParseExpression(LOWEST)
 		if err != nil {
 			return nil, err
@@ -487,18 +783,14 @@ func (parser *Parser) parseHashExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		if err := parser.nextToken(); err != nil {
-			return nil, err
-		}
+		parser.nextToken()
 		val, err := parser.ParseExpression(LOWEST)
 		if err != nil {
 			return nil, err
 		}
 		entries = append(entries, ast.HashEntry{Key: key, Value: val})
 		if parser.peekTokenIs(token.COMMA) {
-			if err := parser.nextToken(); err != nil {
-				return nil, err
-			}
+			parser.nextToken()
 		} else {
 			break
 		}
@@ -510,22 +802,247 @@ func (parser *Parser) parseHashExpression() (ast.Expression, error) {
 	return &expr, nil
 }
 
-func (parser *Parser) parseIndexExpression(array ast.Expression) (ast.Expression, error) {
-	expr := &ast.IndexExpression{Token: parser.currentToken, Left: array}
-	if err := parser.nextToken(); err != nil {
+// parseMatchExpression parses match (value) { pattern [if guard] => body,
+// ... }, which may have a trailing comma after the last arm.
+func (parser *Parser) parseMatchExpression() (ast.Expression, error) {
+	expr := &ast.MatchExpression{Token: parser.currentToken}
+	if err := parser.expectPeek(token.LPAREN); err != nil {
+		return nil, err
+	}
+	parser.nextToken()
+	value, err := parser.ParseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	expr.Value = value
+	if err := parser.expectPeek(token.RPAREN); err != nil {
+		return nil, err
+	}
+	if err := parser.expectPeek(token.LBRACE); err != nil {
+		return nil, err
+	}
+
+	expr.Arms = make([]ast.MatchArm, 0)
+	for !parser.peekTokenIs(token.RBRACE) {
+		parser.nextToken()
+		arm, err := parser.parseMatchArm()
+		if err != nil {
+			return nil, err
+		}
+		expr.Arms = append(expr.Arms, arm)
+		if !parser.peekTokenIs(token.COMMA) {
+			break
+		}
+		parser.nextToken()
+	}
+	if err := parser.expectPeek(token.RBRACE); err != nil {
+		return nil, err
+	}
+	if len(expr.Arms) == 0 {
+		return nil, parser.errorAt(expr.Token.Position, "match expression has no arms")
+	}
+	return expr, nil
+}
+
+func (parser *Parser) parseMatchArm() (ast.MatchArm, error) {
+	var arm ast.MatchArm
+	pattern, err := parser.parsePattern()
+	if err != nil {
+		return arm, err
+	}
+	arm.Pattern = pattern
+	if parser.peekTokenIs(token.IF) {
+		parser.nextToken()
+		parser.nextToken()
+		guard, err := parser.ParseExpression(LOWEST)
+		if err != nil {
+			return arm, err
+		}
+		arm.Guard = guard
+	}
+	if err := parser.expectPeek(token.ARROW); err != nil {
+		return arm, err
+	}
+	parser.nextToken()
+	body, err := parser.ParseExpression(LOWEST)
+	if err != nil {
+		return arm, err
+	}
+	arm.Body = body
+	return arm, nil
+}
+
+// parsePattern parses a pattern starting at the current token: _, a name,
+// an integer, string or boolean literal, an array pattern or a hash
+// pattern.
+func (parser *Parser) parsePattern() (ast.Pattern, error) {
+	switch parser.currentToken.Type {
+	case token.IDENT:
+		if parser.currentToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: parser.currentToken}, nil
+		}
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}}, nil
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+		value, err := parser.prefixParseFns[parser.currentToken.Type]()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.LiteralPattern{Value: value}, nil
+	case token.MINUS:
+		minus := parser.currentToken
+		if parser.peekTokenIs(token.FLOAT) {
+			parser.nextToken()
+		} else if err := parser.expectPeek(token.INT); err != nil {
+			return nil, err
+		}
+		value, err := parser.prefixParseFns[parser.currentToken.Type]()
+		if err != nil {
+			return nil, err
+		}
+		var number *token.Token
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			value.Value, number = -value.Value, &value.Token
+		case *ast.FloatLiteral:
+			value.Value, number = -value.Value, &value.Token
+		}
+		number.Literal = "-" + number.Literal
+		number.Position = minus.Position
+		return &ast.LiteralPattern{Value: value}, nil
+	case token.LBRACKET:
+		return parser.parseArrayPattern()
+	case token.LBRACE:
+		return parser.parseHashPattern()
+	case token.EOF:
+		return nil, parser.errorAt(parser.currentToken.Position, "unexpected end of file, expected pattern")
+	}
+	return nil, parser.errorAt(parser.currentToken.Position, "expected pattern, got token %q", parser.currentToken.Literal)
+}
+
+// parseArrayPattern parses [pattern, ...], which may end with ...name to
+// bind the remaining elements.
+func (parser *Parser) parseArrayPattern() (ast.Pattern, error) {
+	pattern := &ast.ArrayPattern{Token: parser.currentToken, Elements: make([]ast.Pattern, 0)}
+	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(token.RBRACKET) {
+		parser.nextToken()
+		if parser.currentTokenIs(token.ELLIPSIS) {
+			if err := parser.expectPeek(token.IDENT); err != nil {
+				return nil, err
+			}
+			pattern.Rest = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+			break
+		}
+		element, err := parser.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		pattern.Elements = append(pattern.Elements, element)
+		if parser.peekTokenIs(token.COMMA) {
+			parser.nextToken()
+		} else {
+			break
+		}
+	}
+	if err := parser.expectPeek(token.RBRACKET); err != nil {
 		return nil, err
 	}
-	index, err := parser.ParseExpression(LOWEST)
+	return pattern, nil
+}
+
+// parseHashPattern parses {key: pattern, ...}, where a key is a literal or
+// a name standing for its string, and name alone is short for name: name.
+func (parser *Parser) parseHashPattern() (ast.Pattern, error) {
+	pattern := &ast.HashPattern{Token: parser.currentToken, Entries: make([]ast.HashPatternEntry, 0)}
+	for parser.currentTokenIs(token.COMMA) || !parser.peekTokenIs(token.RBRACE) {
+		parser.nextToken()
+		var key ast.Expression
+		var err error
+		switch parser.currentToken.Type {
+		case token.IDENT:
+			key = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+		case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+			key, err = parser.prefixParseFns[parser.currentToken.Type]()
+		default:
+			err = parser.errorAt(parser.currentToken.Position, "expected hash pattern key, got token %q", parser.currentToken.Literal)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := ast.HashPatternEntry{Key: key}
+		if identifier, ok := key.(*ast.Identifier); ok && !parser.peekTokenIs(token.COLON) {
+			entry.Value = &ast.BindingPattern{Name: &ast.Identifier{Token: identifier.Token, Value: identifier.Value}}
+		} else {
+			if err := parser.expectPeek(token.COLON); err != nil {
+				return nil, err
+			}
+			parser.nextToken()
+			if entry.Value, err = parser.parsePattern(); err != nil {
+				return nil, err
+			}
+		}
+		pattern.Entries = append(pattern.Entries, entry)
+		if parser.peekTokenIs(token.COMMA) {
+			parser.nextToken()
+		} else {
+			break
+		}
+	}
+	if err := parser.expectPeek(token.RBRACE); err != nil {
+		return nil, err
+	}
+	return pattern, nil
+}
+
+func (parser *Parser) parseIndexExpression(array ast.Expression) (ast.Expression, error) {
+	bracket := parser.currentToken
+	parser.nextToken()
+	var start ast.Expression
+	if !parser.currentTokenIs(token.COLON) {
+		index, err := parser.ParseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+		if parser.peekTokenIs(token.RBRACKET) {
+			parser.nextToken()
+			return &ast.IndexExpression{Token: bracket, Left: array, Index: index}, nil
+		}
+		if err := parser.expectPeek(token.COLON); err != nil {
+			return nil, err
+		}
+		start = index
+	}
+
+	expr := &ast.SliceExpression{Token: bracket, Left: array, Start: start}
+	end, err := parser.parseSliceBound()
 	if err != nil {
 		return nil, err
 	}
-	expr.Index = index
+	expr.End = end
+	if parser.peekTokenIs(token.COLON) {
+		parser.nextToken()
+		step, err := parser.parseSliceBound()
+		if err != nil {
+			return nil, err
+		}
+		expr.Step = step
+	}
 	if err := parser.expectPeek(token.RBRACKET); err != nil {
 		return nil, err
 	}
 	return expr, nil
 }
 
+// parseSliceBound parses the optional expression following a colon in a
+// slice, returning nil if it is omitted.
+func (parser *Parser) parseSliceBound() (ast.Expression, error) {
+	if parser.peekTokenIs(token.COLON) || parser.peekTokenIs(token.RBRACKET) {
+		return nil, nil
+	}
+	parser.nextToken()
+	return parser.ParseExpression(LOWEST)
+}
+
 func (parser *Parser) currentTokenIs(tokenType token.TokenType) bool {
 	return parser.currentToken.Type == tokenType
 }
@@ -536,17 +1053,15 @@ func (parser *Parser) peekTokenIs(tokenType token.TokenType) bool {
 
 func (parser *Parser) expectPeek(tokenType token.TokenType) error {
 	if parser.peekTokenIs(tokenType) {
-		if err := parser.nextToken(); err != nil {
-			return err
-		}
+		parser.nextToken()
 		return nil
 	} else if parser.peekToken.Type != token.EOF {
-		return ParseError{reason: fmt.Sprintf("unexpected token %s, expected %s", parser.peekToken.Literal, tokenType)}
+		return parser.errorAt(parser.peekToken.Position, "unexpected token %s, expected %s", parser.peekToken.Literal, tokenType)
 	} else {
-		return ParseError{reason: fmt.Sprintf("unexpected end of file, expected %s", tokenType)}
+		return parser.errorAt(parser.peekToken.Position, "unexpected end of file, expected %s", tokenType)
 	}
 }
 
 func (parseError ParseError) Error() string {
-	return parseError.reason
+	return fmt.Sprintf("%s: %s", parseError.Position, parseError.reason)
 }
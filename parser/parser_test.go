@@ -137,6 +137,82 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	testIntegerLiteral(t, statement.Expression, 5)
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"007", 7},
+		{"1_000_000", 1000000},
+		{"0x1F", 31},
+		{"0XFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"0b1111_0000", 240},
+		{"0x7fff_ffff_ffff_ffff", 9223372036854775807},
+	}
+
+	for _, test := range tests {
+		lexer := lexer.New(test.input)
+		parser := New(lexer)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		testIntegerLiteral(t, statement.Expression, test.expected)
+	}
+}
+
+func TestIntegerLiteralOutOfRange(t *testing.T) {
+	for _, input := range []string{"9223372036854775808", "0x8000_0000_0000_0000"} {
+		lexer := lexer.New(input)
+		parser := New(lexer)
+		parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) == 0 || !strings.Contains(errors[0].Error(), "out of range") {
+			t.Errorf("expected %s to be out of range, got errors %v", input, errors)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"0.25", 0.25},
+		{"1e3", 1000},
+		{"2.5E-3", 0.0025},
+		{"1_000.000_5", 1000.0005},
+	}
+
+	for _, test := range tests {
+		parser := New(lexer.New(test.input))
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		float, ok := statement.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Errorf("expected FloatLiteral, got %T", statement.Expression)
+			continue
+		}
+		if float.Value != test.expected || float.String() != test.input {
+			t.Errorf("expected %s to be %g, got %g (%s)", test.input, test.expected, float.Value, float.String())
+		}
+	}
+
+	parser := New(lexer.New("1e400"))
+	parser.ParseProgram()
+	if errors := parser.Errors(); len(errors) == 0 || errors[0].Error() != "1:1: float literal 1e400 out of range" {
+		t.Errorf("expected 1e400 to be out of range, got errors %v", errors)
+	}
+}
+
 func TestBooleanLiteralExpression(t *testing.T) {
 	input := "true;false;"
 
@@ -175,6 +251,60 @@ func TestStringLiteralExpression(t *testing.T) {
 	testStringLiteral(t, statement.Expression, "hello")
 }
 
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${b} c"`, `"a ${b} c";` + "\n"},
+		{`"${1 + 2 * x}"`, `"${(1 + (2 * x))}";` + "\n"},
+		{`"${f(1)[0]}!"`, `"${(f(1)[0])}!";` + "\n"},
+		{`"${"${x}"}"`, `"${"${x}"}";` + "\n"},
+	}
+
+	for _, test := range tests {
+		lexer := lexer.New(test.input)
+		parser := New(lexer)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := statement.Expression.(*ast.InterpolatedString); !ok {
+			t.Fatalf("Expected InterpolatedString, got %T", statement.Expression)
+		}
+		if program.String() != test.expected {
+			t.Fatalf("Expected `%s`, got `%s`", test.expected, program.String())
+		}
+	}
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		pattern string
+	}{
+		{`"${}"`, "empty interpolation"},
+		{`"${1 +}"`, "in string interpolation"},
+		{`"${1 2}"`, "unexpected token 2 in string interpolation"},
+		{`"${x} \q"`, "unknown escape sequence"},
+		{`let s = "ab ${1 +} c";`, "1:18: in string interpolation: unexpected end of file"},
+		{"let s = \"\"\"\n  x ${y z}\n  \"\"\";", "2:9: unexpected token z in string interpolation"},
+		{`"é ${x}${1 2}"`, "1:12: unexpected token 2"},
+		{`let s = "${"\q"}"`, "1:12: in string interpolation: unknown escape sequence"},
+	}
+
+	for _, test := range tests {
+		lexer := lexer.New(test.input)
+		parser := New(lexer)
+		parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) == 0 || !strings.Contains(errors[0].Error(), test.pattern) {
+			t.Errorf("expected parsing %s to fail with %q, got %v", test.input, test.pattern, errors)
+		}
+	}
+}
+
 func TestArrayExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -360,6 +490,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a * add(b + c, d - e) * f", "((a * add((b + c), (d - e))) * f);\n"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d);\n"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])));\n"},
+		{"a[-1]", "(a[(-1)]);\n"},
+		{"a[1 + 1:b * 2]", "(a[(1 + 1):(b * 2)]);\n"},
+		{"a[:][1:][:2][::][::-1]", "(((((a[:])[1:])[:2])[:])[::(-1)]);\n"},
+		{"a[1:2:3] + b[x:]", "((a[1:2:3]) + (b[x:]));\n"},
 	}
 
 	for _, test := range tests {
@@ -467,7 +601,7 @@ func TestFunctionLiteral(t *testing.T) {
 		}
 
 		for i, param := range fnLit.Parameters {
-			if !testIdentifier(t, &param, test.params[i]) {
+			if !testIdentifier(t, param.Name, test.params[i]) {
 				return
 			}
 		}
@@ -569,6 +703,274 @@ func TestIndexExpression(t *testing.T) {
 	}
 }
 
+func TestSliceExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		start interface{}
+		end   interface{}
+		step  interface{}
+	}{
+		{"a[1:2]", 1, 2, nil},
+		{"a[:2]", nil, 2, nil},
+		{"a[1:]", 1, nil, nil},
+		{"a[:]", nil, nil, nil},
+		{"a[::]", nil, nil, nil},
+		{"a[x:y:z]", "x", "y", "z"},
+		{"a[::3]", nil, nil, 3},
+		{"a[1::3]", 1, nil, 3},
+	}
+
+	for _, test := range tests {
+		lexer := lexer.New(test.input)
+		parser := New(lexer)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+
+		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Expected expression statement, got %T", program.Statements[0])
+		}
+
+		expr, ok := statement.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("Expected SliceExpression, got %T", statement.Expression)
+		}
+
+		if !testLiteralExpression(t, expr.Left, "a") {
+			return
+		}
+		bounds := []struct {
+			name     string
+			actual   ast.Expression
+			expected interface{}
+		}{
+			{"start", expr.Start, test.start},
+			{"end", expr.End, test.end},
+			{"step", expr.Step, test.step},
+		}
+		for _, bound := range bounds {
+			if bound.expected == nil {
+				if bound.actual != nil {
+					t.Fatalf("%s: expected no %s, got %s", test.input, bound.name, bound.actual.String())
+				}
+			} else if !testLiteralExpression(t, bound.actual, bound.expected) {
+				return
+			}
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one" }`, `match (x) { 1 => "one" }`},
+		{
+			`match (x) { -1 => a, "s" => b, true => c, _ => d, }`,
+			`match (x) { -1 => a, "s" => b, true => c, _ => d }`,
+		},
+		{`match (f(x)) { n if n > 1 => n * 2 }`, `match (f(x)) { n if (n > 1) => (n * 2) }`},
+		{`match (x) { 1.5 => a, -2.5e3 => b, {0.5: v} => v }`, `match (x) { 1.5 => a, -2.5e3 => b, {0.5: v} => v }`},
+		{`match (x) { [] => 0, [a, [b, _]] => a, [h, ...t] => t, [...all] => all }`, `match (x) { [] => 0, [a, [b, _]] => a, [h, ...t] => t, [...all] => all }`},
+		{`match (x) { {} => 0, {"k": 1, 2: v, name, age: [y]} => y }`, `match (x) { {} => 0, {"k": 1, 2: v, name, age: [y]} => y }`},
+	}
+
+	for _, test := range tests {
+		parser := New(lexer.New(test.input))
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+
+		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Expected expression statement, got %T", program.Statements[0])
+		}
+		if _, ok := statement.Expression.(*ast.MatchExpression); !ok {
+			t.Fatalf("Expected MatchExpression, got %T", statement.Expression)
+		}
+		if statement.Expression.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, statement.Expression.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) {}`, "1:1: match expression has no arms"},
+		{`match (x) { 1 + 2 => 3 }`, "1:15: unexpected token +, expected =>"},
+		{`match (x) { [...a, b] => b }`, "1:18: unexpected token ,, expected ]"},
+		{`match (x) { {[a]: a} => a }`, "1:14: expected hash pattern key, got token \"[\""},
+		{`match (x) { fn => 1 }`, "1:13: expected pattern, got token \"fn\""},
+	}
+	for _, test := range errorTests {
+		parser := New(lexer.New(test.input))
+		parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) == 0 || errors[0].Error() != test.expected {
+			t.Errorf("parsing %q: expected error %q, got %v", test.input, test.expected, errors)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = arr;`, `let [a, b, ...rest] = arr;`},
+		{`let {name, age: years} = person;`, `let {name, age: years} = person;`},
+		{`let [[x, _], {"k": [y]}] = z;`, `let [[x, _], {"k": [y]}] = z;`},
+		{`fn([a, b], {c}, d) { a }`, `fn([a, b], {c}, d) { a; };`},
+	}
+
+	for _, test := range tests {
+		parser := New(lexer.New(test.input))
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+		if program.String() != test.expected+"\n" {
+			t.Errorf("expected %q, got %q", test.expected, program.String())
+		}
+	}
+
+	parser := New(lexer.New(`let [a] = b;`))
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Name != nil {
+		t.Errorf("expected a destructuring let statement to have no name, got %s", let.Name)
+	}
+	if _, ok := let.Pattern.(*ast.ArrayPattern); !ok {
+		t.Errorf("expected an ArrayPattern, got %T", let.Pattern)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, 1 + 2] = b;`, "1:11: unexpected token +, expected ]"},
+		{`let {[a]} = b;`, "1:6: expected hash pattern key, got token \"[\""},
+		{`macro([a]) { a }`, "1:7: unexpected token [, expected IDENT"},
+	}
+	for _, test := range errorTests {
+		parser := New(lexer.New(test.input))
+		parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) == 0 || errors[0].Error() != test.expected {
+			t.Errorf("parsing %q: expected error %q, got %v", test.input, test.expected, errors)
+		}
+	}
+}
+
+func TestParameterAndArgumentForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(x, y = 10) { x }`, `fn(x, y = 10) { x; }`},
+		{`fn(first, ...others) { others }`, `fn(first, ...others) { others; }`},
+		{`fn(...all) { all }`, `fn(...all) { all; }`},
+		{`fn([a, b] = [1, 2], c = a + b, ...d) { d }`, `fn([a, b] = [1, 2], c = (a + b), ...d) { d; }`},
+		{`f(...args)`, `f(...args)`},
+		{`f(1, ...xs, ...ys, y: 2, z: g(3))`, `f(1, ...xs, ...ys, y: 2, z: g(3))`},
+		{`f(a[1:2], ...[1, 2])`, `f((a[1:2]), ...[1, 2])`},
+	}
+
+	for _, test := range tests {
+		parser := New(lexer.New(test.input))
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+		checkProgramLen(t, program, 1)
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		if statement.Expression.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, statement.Expression.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(x = 1, y) { y }`, "1:11: parameter y without a default follows a parameter with one"},
+		{`fn(...a, b) { b }`, "1:8: unexpected token ,, expected )"},
+		{`macro(x = 1) { x }`, "1:9: unexpected token =, expected )"},
+		{`macro(...x) { x }`, "1:7: unexpected token ..., expected IDENT"},
+		{`f(x: 1, 2)`, "1:9: positional argument after named argument"},
+		{`f(x: 1, ...y)`, "1:9: positional argument after named argument"},
+		{`f(x: 1, x: 2)`, "1:9: duplicate named argument x"},
+	}
+	for _, test := range errorTests {
+		parser := New(lexer.New(test.input))
+		parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) == 0 || errors[0].Error() != test.expected {
+			t.Errorf("parsing %q: expected error %q, got %v", test.input, test.expected, errors)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements int
+	}{
+		{"let = 5; let y = 2;", []string{"1:5: unexpected token =, expected IDENT"}, 1},
+		{"let x = 1 +\nlet y = 2;\ny", []string{"2:1: expected expression, got token \"let\""}, 2},
+		{"let x = ; let y = ; let z = 3;", []string{"1:9: expected expression, got token \";\"", "1:19: expected expression, got token \";\""}, 1},
+		{"let f = fn() { let a = ; let b = 2; b };\nf()", []string{"1:24: expected expression, got token \";\""}, 2},
+		{"if (x) { 1 + } else { 2 }\n5", []string{"1:14: expected expression, got token \"}\""}, 2},
+		{
+			"let f = fn() {\n let a = ;\n let b = ;\n if (a) { let c = ; }\n b\n};\nf()",
+			[]string{"2:10: expected expression, got token \";\"", "3:10: expected expression, got token \";\"", "4:19: expected expression, got token \";\""},
+			2,
+		},
+		{"fn() { fn() { let = 1; 2 }; let y = ; y }", []string{"1:19: unexpected token =, expected IDENT", "1:37: expected expression, got token \";\""}, 1},
+		{"fn(1) { }\nfn(x) { x }", []string{"1:4: unexpected token 1, expected IDENT"}, 1},
+		{"let s = \"abc;\n", []string{"1:9: unterminated string literal"}, 0},
+		{"let n = 12abc; let m = 0x;\nm", []string{`1:9: invalid decimal literal "12abc"`, `1:24: invalid hexadecimal literal "0x", expected digits`}, 1},
+		{"let s = \"\\q\" + 1; s", []string{"1:9: unknown escape sequence \\q"}, 1},
+		{"[1, 2", []string{"1:6: unexpected end of file, expected ]"}, 0},
+	}
+
+	for _, test := range tests {
+		lexer := lexer.New(test.input)
+		parser := New(lexer)
+		program := parser.ParseProgram()
+		errors := parser.Errors()
+		if len(errors) != len(test.errors) {
+			t.Errorf("parsing %q: expected %d errors, got %d: %v", test.input, len(test.errors), len(errors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Error() != test.errors[i] {
+				t.Errorf("parsing %q: expected error %q, got %q", test.input, test.errors[i], err.Error())
+			}
+		}
+		if len(program.Statements) != test.statements {
+			t.Errorf("parsing %q: expected %d statements to be recovered, got %d: %s", test.input, test.statements, len(program.Statements), program.String())
+		}
+	}
+}
+
+func TestErrorLimit(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", maxErrors+5)
+	lexer := lexer.New(input)
+	parser := New(lexer)
+	parser.ParseProgram()
+	errors := parser.Errors()
+	if len(errors) != maxErrors+1 {
+		t.Fatalf("expected %d errors, got %d", maxErrors+1, len(errors))
+	}
+	last := errors[len(errors)-1].Error()
+	if !strings.Contains(last, "too many errors") {
+		t.Fatalf("expected last error to report too many errors, got %q", last)
+	}
+}
+
 func checkParserErrors(t *testing.T, parser *Parser) {
 	errors := parser.Errors()
 	if len(errors) > 0 {
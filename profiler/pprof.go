@@ -0,0 +1,201 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Field numbers of the messages in pprof's profile.proto.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+	lineColumn     = 3
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read
+// by pprof. Each sample counts the calls with a stack and the time spent in
+// the innermost function.
+func (profiler *Profiler) WritePprof(w io.Writer) error {
+	table := newStringTable()
+	var profile protobuf
+
+	for _, valueType := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var message protobuf
+		message.int(valueTypeType, table.index(valueType[0]))
+		message.int(valueTypeUnit, table.index(valueType[1]))
+		profile.message(profileSampleType, message)
+	}
+
+	// locations are numbered in the order they are first used
+	locations := make(map[location]uint64)
+	functions := make(map[*Function]bool)
+	var locationMessages, functionMessages []protobuf
+	for _, s := range profiler.samples {
+		frames := s.frames()
+		ids := make([]uint64, len(frames))
+		// pprof lists the innermost location first
+		for i, frame := range frames {
+			id, ok := locations[frame]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[frame] = id
+				var line protobuf
+				line.uint(lineFunctionID, frame.function.id)
+				line.int(lineLine, int64(frame.position.Line))
+				line.int(lineColumn, int64(frame.position.Column))
+				var message protobuf
+				message.uint(locationID, id)
+				message.message(locationLine, line)
+				locationMessages = append(locationMessages, message)
+			}
+			ids[len(ids)-1-i] = id
+
+			if !functions[frame.function] {
+				functions[frame.function] = true
+				var message protobuf
+				message.uint(functionID, frame.function.id)
+				message.int(functionName, table.index(frame.function.Name))
+				message.int(functionSystemName, table.index(frame.function.Name))
+				if frame.function.Position.Line > 0 {
+					message.int(functionFilename, table.index(profiler.filename))
+					message.int(functionStartLine, int64(frame.function.Position.Line))
+				}
+				functionMessages = append(functionMessages, message)
+			}
+		}
+
+		var message protobuf
+		message.packedUints(sampleLocationID, ids)
+		message.packedInts(sampleValue, []int64{int64(s.calls), s.self.Nanoseconds()})
+		profile.message(profileSample, message)
+	}
+	for _, message := range locationMessages {
+		profile.message(profileLocation, message)
+	}
+	for _, message := range functionMessages {
+		profile.message(profileFunction, message)
+	}
+
+	var periodType protobuf
+	periodType.int(valueTypeType, table.index("time"))
+	periodType.int(valueTypeUnit, table.index("nanoseconds"))
+	profile.message(profilePeriodType, periodType)
+	profile.int(profilePeriod, 1)
+	profile.int(profileTimeNanos, profiler.start.UnixNano())
+	profile.int(profileDurationNanos, profiler.duration.Nanoseconds())
+	for _, s := range table.strings {
+		profile.string(profileStringTable, s)
+	}
+
+	compressed := gzip.NewWriter(w)
+	if _, err := compressed.Write(profile); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// stringTable numbers strings in the order they are added, from the empty
+// string at 0 as pprof requires.
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (table *stringTable) index(s string) int64 {
+	if index, ok := table.indexes[s]; ok {
+		return index
+	}
+	index := int64(len(table.strings))
+	table.strings = append(table.strings, s)
+	table.indexes[s] = index
+	return index
+}
+
+// protobuf is an encoded protocol buffer message, holding just the wire
+// types needed for profiles.
+type protobuf []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (buffer *protobuf) varint(value uint64) {
+	for value >= 0x80 {
+		*buffer = append(*buffer, byte(value)|0x80)
+		value >>= 7
+	}
+	*buffer = append(*buffer, byte(value))
+}
+
+func (buffer *protobuf) key(field int, wireType int) {
+	buffer.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (buffer *protobuf) uint(field int, value uint64) {
+	buffer.key(field, wireVarint)
+	buffer.varint(value)
+}
+
+func (buffer *protobuf) int(field int, value int64) {
+	buffer.uint(field, uint64(value))
+}
+
+func (buffer *protobuf) bytes(field int, value []byte) {
+	buffer.key(field, wireBytes)
+	buffer.varint(uint64(len(value)))
+	*buffer = append(*buffer, value...)
+}
+
+func (buffer *protobuf) string(field int, value string) {
+	buffer.bytes(field, []byte(value))
+}
+
+func (buffer *protobuf) message(field int, message protobuf) {
+	buffer.bytes(field, message)
+}
+
+func (buffer *protobuf) packedUints(field int, values []uint64) {
+	var packed protobuf
+	for _, value := range values {
+		packed.varint(value)
+	}
+	buffer.bytes(field, packed)
+}
+
+func (buffer *protobuf) packedInts(field int, values []int64) {
+	var packed protobuf
+	for _, value := range values {
+		packed.varint(uint64(value))
+	}
+	buffer.bytes(field, packed)
+}
@@ -0,0 +1,340 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/token"
+)
+
+// Function holds the statistics of a function literal or builtin.
+type Function struct {
+	// Name is the name the function is bound to by a let statement, the
+	// name of a builtin, or fn@line:column for anonymous functions
+	Name string
+	// Position is where the function literal starts, and is zero for
+	// builtins
+	Position token.Position
+	Calls    int
+	// Total is the time spent in calls to the function, including the
+	// functions it calls. Time in recursive calls is only counted once.
+	Total time.Duration
+	// Self is the time spent in the function itself
+	Self time.Duration
+
+	id     uint64
+	active int
+}
+
+// CallSite holds the statistics of a call expression.
+type CallSite struct {
+	Call  *ast.CallExpression
+	Calls int
+	// Total is the time spent in calls made here, counting time in
+	// recursive calls once
+	Total time.Duration
+
+	active int
+}
+
+// Profiler records the time spent and calls made in each function and at
+// each call site while a program is evaluated, using evaluator hooks.
+type Profiler struct {
+	filename string
+	// the function literals in the program by their bodies, and the names
+	// they are bound to by let statements
+	literals  map[*ast.BlockStatement]*ast.FunctionLiteral
+	bindings  map[*ast.FunctionLiteral]string
+	functions map[interface{}]*Function
+	// main is the top level of the program
+	main      *Function
+	callSites map[*ast.CallExpression]*CallSite
+	stack     []frame
+	// samples in the order they were first recorded
+	samples  []*sample
+	start    time.Time
+	duration time.Duration
+
+	// now returns the current time, and is replaced by tests
+	now func() time.Time
+}
+
+// frame is a call being evaluated.
+type frame struct {
+	function *Function
+	call     *ast.CallExpression
+	sample   *sample
+	start    time.Time
+	// children is the time spent in calls made by this one
+	children time.Duration
+}
+
+// sample is the calls and self time of every call with the same stack.
+// Samples form a tree, each the child of the sample for the stack its call
+// was made from, so that a call finds its sample without comparing stacks.
+type sample struct {
+	parent   *sample
+	function *Function
+	// position is where the call was made in the parent's function
+	position token.Position
+	children map[location]*sample
+	calls    int
+	self     time.Duration
+	recorded bool
+}
+
+// location is a position in a function: where it calls the next function
+// on the stack, or its start for the innermost function. The column tells
+// apart calls made on the same line.
+type location struct {
+	function *Function
+	position token.Position
+}
+
+// New creates a profiler for a program read from filename, and starts its
+// clock.
+func New(filename string, program *ast.Program) *Profiler {
+	profiler := &Profiler{
+		filename:  filename,
+		literals:  make(map[*ast.BlockStatement]*ast.FunctionLiteral),
+		bindings:  make(map[*ast.FunctionLiteral]string),
+		functions: make(map[interface{}]*Function),
+		callSites: make(map[*ast.CallExpression]*CallSite),
+		now:       time.Now,
+	}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			profiler.literals[node.Body] = node
+		case *ast.LetStatement:
+			if function, ok := node.Value.(*ast.FunctionLiteral); ok && node.Name != nil {
+				profiler.bindings[function] = node.Name.Value
+			}
+		}
+		return true
+	})
+	profiler.main = &Function{Name: "main", Position: token.Position{Line: 1, Column: 1}, Calls: 1, id: 1}
+	profiler.start = profiler.now()
+	root := &sample{function: profiler.main, children: make(map[location]*sample)}
+	profiler.stack = []frame{{function: profiler.main, sample: root, start: profiler.start}}
+	return profiler
+}
+
+// Hooks returns the evaluator hooks that drive the profiler. They should be
+// set on the environment the program is evaluated in.
+func (profiler *Profiler) Hooks() *object.Hooks {
+	return &object.Hooks{Call: profiler.call}
+}
+
+func (profiler *Profiler) call(call *ast.CallExpression, called object.Object, args []object.Object) func() {
+	function := profiler.function(called)
+	if function == nil {
+		return func() {}
+	}
+	callSite := profiler.callSites[call]
+	if callSite == nil {
+		callSite = &CallSite{Call: call}
+		profiler.callSites[call] = callSite
+	}
+	function.Calls++
+	function.active++
+	callSite.Calls++
+	callSite.active++
+	parent := profiler.stack[len(profiler.stack)-1].sample
+	key := location{function: function, position: ast.ExpressionPosition(call)}
+	s, ok := parent.children[key]
+	if !ok {
+		s = &sample{parent: parent, function: function, position: key.position, children: make(map[location]*sample)}
+		parent.children[key] = s
+	}
+	profiler.stack = append(profiler.stack, frame{function: function, call: call, sample: s, start: profiler.now()})
+
+	return func() {
+		top := profiler.stack[len(profiler.stack)-1]
+		elapsed := profiler.now().Sub(top.start)
+		self := elapsed - top.children
+		profiler.record(top.sample, 1, self)
+		profiler.stack = profiler.stack[:len(profiler.stack)-1]
+		profiler.stack[len(profiler.stack)-1].children += elapsed
+
+		function.Self += self
+		if function.active == 1 {
+			function.Total += elapsed
+		}
+		function.active--
+		if callSite.active == 1 {
+			callSite.Total += elapsed
+		}
+		callSite.active--
+	}
+}
+
+// function returns the statistics for a called function, or nil if it
+// cannot be called.
+func (profiler *Profiler) function(called object.Object) *Function {
+	var key interface{}
+	switch called := called.(type) {
+	case *object.Function:
+		key = called.Body
+	case *object.Builtin:
+		key = called
+	default:
+		return nil
+	}
+	if function, ok := profiler.functions[key]; ok {
+		return function
+	}
+
+	function := &Function{id: uint64(len(profiler.functions) + 2)}
+	switch called := called.(type) {
+	case *object.Function:
+		function.Position = called.Body.Token.Position
+		literal, ok := profiler.literals[called.Body]
+		if ok {
+			function.Position = literal.Token.Position
+		}
+		function.Name = fmt.Sprintf("fn@%s", function.Position)
+		if name, ok := profiler.bindings[literal]; ok {
+			function.Name = name
+		}
+	case *object.Builtin:
+		function.Name = "builtin"
+		for _, name := range evaluator.BuiltinNames() {
+			if builtin, _ := evaluator.LookupBuiltin(name); builtin == called {
+				function.Name = name
+			}
+		}
+	}
+	profiler.functions[key] = function
+	return function
+}
+
+// record adds calls to a sample.
+func (profiler *Profiler) record(s *sample, calls int, self time.Duration) {
+	if !s.recorded {
+		s.recorded = true
+		profiler.samples = append(profiler.samples, s)
+	}
+	s.calls += calls
+	s.self += self
+}
+
+// frames returns the stack of a sample from the outermost function, with
+// the position each function calls the next at, or its start for the
+// innermost.
+func (s *sample) frames() []location {
+	depth := 0
+	for node := s; node != nil; node = node.parent {
+		depth++
+	}
+	frames := make([]location, depth)
+	position := s.function.Position
+	for node := s; node != nil; node = node.parent {
+		depth--
+		frames[depth] = location{function: node.function, position: position}
+		position = node.position
+	}
+	return frames
+}
+
+// Stop stops the clock, recording the time spent at the top level of the
+// program. It should be called once evaluation has finished.
+func (profiler *Profiler) Stop() {
+	main := profiler.stack[0]
+	profiler.duration = profiler.now().Sub(profiler.start)
+	profiler.main.Total = profiler.duration
+	profiler.main.Self = profiler.duration - main.children
+	profiler.record(main.sample, 1, profiler.main.Self)
+}
+
+// Functions returns the statistics of each function called, with the most
+// time spent in the function itself first.
+func (profiler *Profiler) Functions() []*Function {
+	functions := make([]*Function, 0, len(profiler.functions))
+	for _, function := range profiler.functions {
+		functions = append(functions, function)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Self != functions[j].Self {
+			return functions[i].Self > functions[j].Self
+		}
+		return functions[i].id < functions[j].id
+	})
+	return functions
+}
+
+// CallSites returns the statistics of each call site, ordered by where the
+// calls start.
+func (profiler *Profiler) CallSites() []*CallSite {
+	callSites := make([]*CallSite, 0, len(profiler.callSites))
+	for _, callSite := range profiler.callSites {
+		callSites = append(callSites, callSite)
+	}
+	sort.Slice(callSites, func(i, j int) bool {
+		a, b := ast.ExpressionPosition(callSites[i].Call), ast.ExpressionPosition(callSites[j].Call)
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return callSites
+}
+
+// WriteFolded writes the profile in the folded stack format used to draw
+// flame graphs: a line for each stack, giving the names of the functions on
+// it from the outermost and the time spent in the innermost in nanoseconds.
+func (profiler *Profiler) WriteFolded(w io.Writer) error {
+	totals := make(map[string]time.Duration)
+	stacks := make([]string, 0)
+	for _, s := range profiler.samples {
+		frames := s.frames()
+		names := make([]string, len(frames))
+		for i, frame := range frames {
+			names[i] = frame.function.Name
+		}
+		stack := strings.Join(names, ";")
+		if _, ok := totals[stack]; !ok {
+			stacks = append(stacks, stack)
+		}
+		totals[stack] += s.self
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, totals[stack].Nanoseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTable writes the statistics of each function, as ordered by
+// Functions, followed by those of each call site, as ordered by CallSites.
+// Times are in milliseconds.
+func (profiler *Profiler) WriteTable(w io.Writer) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%8s %10s %10s  %s\n", "calls", "self", "total", "function")
+	for _, function := range profiler.Functions() {
+		name := function.Name
+		if function.Position.Line > 0 {
+			name = fmt.Sprintf("%s %s", name, function.Position)
+		}
+		fmt.Fprintf(&out, "%8d %10s %10s  %s\n", function.Calls, milliseconds(function.Self), milliseconds(function.Total), name)
+	}
+	fmt.Fprintf(&out, "\n%8s %10s %10s  %s\n", "calls", "", "total", "call site")
+	for _, callSite := range profiler.CallSites() {
+		fmt.Fprintf(&out, "%8d %10s %10s  %s %s\n", callSite.Calls, "", milliseconds(callSite.Total), ast.ExpressionPosition(callSite.Call), callSite.Call.String())
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func milliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64)
+}
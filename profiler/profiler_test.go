@@ -0,0 +1,201 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+// profile evaluates a program with a clock advancing a millisecond each
+// time it is read.
+func profile(t *testing.T, input string) *Profiler {
+	t.Helper()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	var ticks time.Duration
+	clock := func() time.Time {
+		ticks += time.Millisecond
+		return time.Unix(0, 0).Add(ticks)
+	}
+	profiler := New("test.mk", program)
+	profiler.now = clock
+	profiler.start = clock()
+	profiler.stack[0].start = profiler.start
+
+	env := object.NewEnvironment()
+	env.SetHooks(profiler.Hooks())
+	if _, err := evaluator.Eval(program, env); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	profiler.Stop()
+	return profiler
+}
+
+// the calls are not in tail position, so that they are nested
+const program = `let inc = fn(x) { x + 1 };
+let twice = fn(x) { let y = inc(inc(x)); y };
+twice(1);
+len("abc");`
+
+func TestFunctions(t *testing.T) {
+	profiler := profile(t, program)
+	expected := []Function{
+		{Name: "twice", Calls: 1, Total: 5 * time.Millisecond, Self: 3 * time.Millisecond},
+		{Name: "inc", Calls: 2, Total: 2 * time.Millisecond, Self: 2 * time.Millisecond},
+		{Name: "len", Calls: 1, Total: time.Millisecond, Self: time.Millisecond},
+	}
+	functions := profiler.Functions()
+	if len(functions) != len(expected) {
+		t.Fatalf("expected %d functions, got %d", len(expected), len(functions))
+	}
+	for i, function := range functions {
+		want := expected[i]
+		if function.Name != want.Name || function.Calls != want.Calls || function.Total != want.Total || function.Self != want.Self {
+			t.Errorf("function %d: expected %+v, got %+v", i, want, *function)
+		}
+	}
+	if position := functions[0].Position.String(); position != "2:13" {
+		t.Errorf("expected twice at 2:13, got %s", position)
+	}
+
+	callSites := profiler.CallSites()
+	var sites []string
+	for _, callSite := range callSites {
+		sites = append(sites, callSite.Call.String())
+	}
+	if strings.Join(sites, " ") != "inc(inc(x)) inc(x) twice(1) len(\"abc\")" {
+		t.Errorf("wrong call sites %v", sites)
+	}
+	if callSites[1].Calls != 1 || callSites[1].Total != time.Millisecond {
+		t.Errorf("wrong statistics for inc(x): %+v", *callSites[1])
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	profiler := profile(t, `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + 0 } }; f(2);`)
+	function := profiler.Functions()[0]
+	if function.Calls != 3 || function.Total != 5*time.Millisecond || function.Self != 5*time.Millisecond {
+		t.Errorf("expected 3 calls taking 5ms, got %+v", *function)
+	}
+	anonymous := profile(t, `fn(x) { x }(1)`).Functions()[0]
+	if anonymous.Name != "fn@1:1" {
+		t.Errorf("expected fn@1:1, got %s", anonymous.Name)
+	}
+}
+
+func TestCallSitesOnOneLine(t *testing.T) {
+	profiler := profile(t, `let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(2);`)
+	var sites []string
+	for _, callSite := range profiler.CallSites() {
+		sites = append(sites, fmt.Sprintf("%s %s %d", ast.ExpressionPosition(callSite.Call), callSite.Call.String(), callSite.Calls))
+	}
+	if expected := "1:41 f((n - 1)) 1, 1:52 f((n - 2)) 1, 1:66 f(2) 1"; strings.Join(sites, ", ") != expected {
+		t.Errorf("wrong call sites.\nexpected=%s\ngot=%s", expected, strings.Join(sites, ", "))
+	}
+	// each call is a distinct stack, although both are on line 1
+	if count := len(profiler.samples); count != 4 {
+		t.Errorf("expected 4 samples, got %d", count)
+	}
+}
+
+func TestMultiLineCall(t *testing.T) {
+	profiler := profile(t, "let f = fn(a, b) { a + b };\nlet g = fn(x) { x };\nlet y = f(\n  g(1),\n  2\n); g(y) + g(y);")
+	var out bytes.Buffer
+	if err := profiler.WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `       1                 1.000  3:9 f(g(1), 2)
+       1                 1.000  4:3 g(1)
+       1                 1.000  6:4 g(y)
+       1                 1.000  6:11 g(y)
+`
+	if table := out.String(); !strings.HasSuffix(table, expected) {
+		t.Errorf("wrong call sites.\nexpected suffix=%q\ngot=%q", expected, table)
+	}
+	// the calls to g on line 6 are distinct stacks
+	if count := len(profiler.samples); count != 5 {
+		t.Errorf("expected 5 samples, got %d", count)
+	}
+}
+
+func TestTailRecursion(t *testing.T) {
+	// each call in tail position returns before the next starts, so the
+	// stack stays one call deep
+	profiler := profile(t, `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(2);`)
+	function := profiler.Functions()[0]
+	if function.Calls != 3 || function.Total != 3*time.Millisecond || function.Self != 3*time.Millisecond {
+		t.Errorf("expected 3 calls taking 3ms, got %+v", *function)
+	}
+	var out bytes.Buffer
+	if err := profiler.WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "main 4000000\nmain;f 3000000\n"; out.String() != expected {
+		t.Errorf("wrong folded stacks.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	var out bytes.Buffer
+	if err := profile(t, program).WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `main 3000000
+main;len 1000000
+main;twice 3000000
+main;twice;inc 2000000
+`
+	if out.String() != expected {
+		t.Errorf("wrong folded stacks.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	var out bytes.Buffer
+	if err := profile(t, program).WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"calls", "nanoseconds", "main", "twice", "inc", "len", "test.mk"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("expected %q in the string table", s)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var out bytes.Buffer
+	if err := profile(t, program).WriteTable(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `   calls       self      total  function
+       1      3.000      5.000  twice 2:13
+       2      2.000      2.000  inc 1:11
+       1      1.000      1.000  len
+
+   calls                 total  call site
+       1                 1.000  2:29 inc(inc(x))
+       1                 1.000  2:33 inc(x)
+       1                 5.000  3:1 twice(1)
+       1                 1.000  4:1 len("abc")
+`
+	if out.String() != expected {
+		t.Errorf("wrong table.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
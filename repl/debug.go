@@ -0,0 +1,195 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/debugger"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+const DEBUG_PROMPT = "(debug) "
+
+const debugHelp = `Commands:
+  step, s            run to the next statement, stepping into calls
+  next, n            run to the next statement in this function
+  out, o             run until the current function returns
+  continue, c        run until a breakpoint
+  break, b [line]    set a breakpoint, or list breakpoints
+  delete, d line     remove a breakpoint
+  print, p expr      evaluate an expression in the current frame
+  where, w           show the call stack
+  quit, q            stop the program
+`
+
+// debugSession debugs a program from the REPL, reading commands whenever
+// it stops.
+type debugSession struct {
+	scanner     *bufio.Scanner
+	out         io.Writer
+	lines       []string
+	debugger    *debugger.Debugger
+	breakpoints map[int]bool
+}
+
+// debugFile runs the program in path under the debugger, stopping before
+// its first statement.
+func debugFile(path string, scanner *bufio.Scanner, out io.Writer) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %s\n", err)
+		return
+	}
+	program, err := evaluator.Prepare(string(source), nil)
+	if err != nil {
+		printPrepareError(out, err)
+		return
+	}
+
+	session := &debugSession{
+		scanner:     scanner,
+		out:         out,
+		lines:       strings.Split(string(source), "\n"),
+		debugger:    debugger.New(true),
+		breakpoints: make(map[int]bool),
+	}
+	session.debugger.OnStop = session.stopped
+	fmt.Fprintf(out, "Debugging %s. Type help for commands.\n", path)
+
+	env := object.NewEnvironment()
+	env.SetOutput(out)
+	env.SetHooks(session.debugger.Hooks())
+	result, err := evaluator.Eval(program, env)
+	switch {
+	case err == debugger.ErrTerminated:
+		fmt.Fprintln(out, "Program stopped")
+	case err != nil:
+		fmt.Fprintf(out, "Error: %s\n", err)
+	default:
+		fmt.Fprintf(out, "Program finished: %s\n", result.Inspect())
+	}
+}
+
+// stopped shows where the program stopped and reads commands until one
+// resumes it.
+func (session *debugSession) stopped(stop debugger.Stop) debugger.Action {
+	position := ast.StatementPosition(stop.Frames[0].Statement)
+	fmt.Fprintf(session.out, "Stopped in %s (%s)\n", stop.Frames[0].Name, stop.Reason)
+	session.printLine(position.Line)
+
+	for {
+		fmt.Fprint(session.out, DEBUG_PROMPT)
+		if !session.scanner.Scan() {
+			return debugger.Terminate
+		}
+		command, argument, _ := strings.Cut(strings.TrimSpace(session.scanner.Text()), " ")
+		argument = strings.TrimSpace(argument)
+
+		switch command {
+		case "step", "s":
+			return debugger.StepIn
+		case "next", "n":
+			return debugger.StepOver
+		case "out", "o":
+			return debugger.StepOut
+		case "continue", "c":
+			return debugger.Continue
+		case "quit", "q":
+			return debugger.Terminate
+		case "break", "b":
+			session.setBreakpoint(argument, true)
+		case "delete", "d":
+			session.setBreakpoint(argument, false)
+		case "print", "p":
+			session.print(argument, stop.Frames[0].Env)
+		case "where", "w":
+			session.where(stop)
+		case "help", "h", "":
+			fmt.Fprint(session.out, debugHelp)
+		default:
+			fmt.Fprintf(session.out, "Unknown command %q. Type help for commands.\n", command)
+		}
+	}
+}
+
+func (session *debugSession) printLine(line int) {
+	if line >= 1 && line <= len(session.lines) {
+		fmt.Fprintf(session.out, "%4d | %s\n", line, session.lines[line-1])
+	}
+}
+
+// setBreakpoint adds or removes a breakpoint, or lists them if no line is
+// given when adding.
+func (session *debugSession) setBreakpoint(argument string, set bool) {
+	if argument == "" && set {
+		lines := session.breakpointLines()
+		if len(lines) == 0 {
+			fmt.Fprintln(session.out, "No breakpoints")
+		}
+		for _, line := range lines {
+			session.printLine(line)
+		}
+		return
+	}
+
+	line, err := strconv.Atoi(argument)
+	if err != nil || line < 1 || line > len(session.lines) {
+		fmt.Fprintf(session.out, "Invalid line %q\n", argument)
+		return
+	}
+	if set {
+		session.breakpoints[line] = true
+		fmt.Fprintf(session.out, "Breakpoint at line %d\n", line)
+	} else {
+		delete(session.breakpoints, line)
+		fmt.Fprintf(session.out, "Deleted breakpoint at line %d\n", line)
+	}
+
+	session.debugger.SetBreakpoints(session.breakpointLines())
+}
+
+func (session *debugSession) breakpointLines() []int {
+	lines := make([]int, 0, len(session.breakpoints))
+	for line := range session.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// print evaluates an expression in the environment of the current frame.
+func (session *debugSession) print(expression string, env *object.Environment) {
+	parser := parser.New(lexer.New(expression))
+	program := parser.ParseProgram()
+	if errors := parser.Errors(); len(errors) > 0 {
+		printParserErrors(session.out, errors)
+		return
+	}
+	result, err := evaluator.Eval(program, env)
+	if err != nil {
+		fmt.Fprintf(session.out, "Error: %s\n", err)
+		return
+	}
+	fmt.Fprintln(session.out, result.Inspect())
+}
+
+// where prints the call stack, innermost first.
+func (session *debugSession) where(stop debugger.Stop) {
+	for i, frame := range stop.Frames {
+		line := ast.StatementPosition(frame.Statement).Line
+		if frame.Call != nil {
+			fmt.Fprintf(session.out, "#%d %s at line %d\n", i, frame.Call.String(), line)
+		} else {
+			fmt.Fprintf(session.out, "#%d %s at line %d\n", i, frame.Name, line)
+		}
+	}
+}
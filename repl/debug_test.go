@@ -0,0 +1,65 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "program.mk")
+	source := `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let x = add(1, 2);
+add(x, 3)`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := []string{
+		":debug " + path,
+		"break 2",
+		"break 9",
+		"continue",
+		"where",
+		"print a + b",
+		"print missing",
+		"next",
+		"delete 2",
+		"out",
+		"p x",
+		"continue",
+		"1 + 1",
+	}
+	var out strings.Builder
+	Start(strings.NewReader(strings.Join(commands, "\n")), &out)
+
+	expected := []string{
+		"Debugging " + path + ". Type help for commands.",
+		"Stopped in main (entry)",
+		"   1 | let add = fn(a, b) {",
+		"(debug) Breakpoint at line 2",
+		`(debug) Invalid line "9"`,
+		"(debug) Stopped in add (breakpoint)",
+		"   2 | \tlet sum = a + b;",
+		"(debug) #0 add(1, 2) at line 2",
+		"#1 main at line 5",
+		"(debug) 3",
+		"(debug) Error: identifier not found: missing",
+		"(debug) Stopped in add (step)",
+		"   3 | \tsum",
+		"(debug) Deleted breakpoint at line 2",
+		"(debug) Stopped in main (step)",
+		"   6 | add(x, 3)",
+		"(debug) 3",
+		"(debug) Program finished: 6",
+		">> 2",
+		">> ",
+	}
+	if out.String() != ">> "+strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected=%s\ngot=%s", ">> "+strings.Join(expected, "\n"), out.String())
+	}
+}
@@ -4,11 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"danielmcm.com/interpreterbook/evaluator"
-	"danielmcm.com/interpreterbook/lexer"
 	"danielmcm.com/interpreterbook/object"
-	"danielmcm.com/interpreterbook/parser"
 )
 
 const PROMPT = ">> "
@@ -16,6 +15,8 @@ const PROMPT = ">> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	env.SetOutput(out)
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -25,25 +26,35 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
-		lexer := lexer.New(line)
-		parser := parser.New(lexer)
+		if path, ok := strings.CutPrefix(line, ":debug "); ok {
+			debugFile(strings.TrimSpace(path), scanner, out)
+			continue
+		}
 
-		program := parser.ParseProgram()
-		errors := parser.Errors()
-		if len(errors) > 0 {
-			printParserErrors(out, errors)
+		program, err := evaluator.Prepare(line, macroEnv)
+		if err != nil {
+			printPrepareError(out, err)
+			continue
+		}
+		result, err := evaluator.Eval(program, env)
+		if err == nil {
+			fmt.Fprintf(out, "%s\n", result.Inspect())
 		} else {
-			// fmt.Fprint(out, program.String())
-			result, err := evaluator.Eval(program, env)
-			if err == nil {
-				fmt.Fprintf(out, "%s\n", result.Inspect())
-			} else {
-				fmt.Fprintf(out, "Error: %s\n", err)
-			}
+			fmt.Fprintf(out, "Error: %s\n", err)
 		}
 	}
 }
 
+// printPrepareError prints the error from preparing a program: each of its
+// syntax errors, or the error expanding its macros.
+func printPrepareError(out io.Writer, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		printParserErrors(out, joined.Unwrap())
+		return
+	}
+	fmt.Fprintf(out, "Error: %s\n", err)
+}
+
 func printParserErrors(out io.Writer, errors []error) {
 	for _, err := range errors {
 		fmt.Fprintf(out, "Syntax error: %s\n", err)
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/profiler"
+)
+
+// runRun implements `monkey run [-profile file] file`, evaluating a
+// program. With -profile, a pprof profile is written to the file, the same
+// profile in folded stack format, for flame graphs, to the file with
+// .folded appended, and a table of the calls and time per function and per
+// call site to the file with .table appended.
+func runRun(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	profile := flags.String("profile", "", "write a pprof profile to `file`, folded stacks to file.folded and a table of functions and call sites to file.table")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey run [-profile file] file")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	program, err := evaluator.Prepare(string(source), nil)
+	if err != nil {
+		if _, ok := parser.ErrorPosition(err); ok {
+			printFileErrors(path, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+		return 1
+	}
+
+	env := object.NewEnvironment()
+	var profiled *profiler.Profiler
+	if *profile != "" {
+		profiled = profiler.New(path, program)
+		env.SetHooks(profiled.Hooks())
+	}
+	_, err = evaluator.Eval(program, env)
+	status := 0
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		status = 1
+	}
+
+	if profiled != nil {
+		profiled.Stop()
+		if err := writeProfile(*profile, profiled); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func writeProfile(path string, profiled *profiler.Profiler) error {
+	pprof, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer pprof.Close()
+	if err := profiled.WritePprof(pprof); err != nil {
+		return err
+	}
+	folded, err := os.Create(path + ".folded")
+	if err != nil {
+		return err
+	}
+	defer folded.Close()
+	if err := profiled.WriteFolded(folded); err != nil {
+		return err
+	}
+	table, err := os.Create(path + ".table")
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	if err := profiled.WriteTable(table); err != nil {
+		return err
+	}
+	if err := pprof.Close(); err != nil {
+		return err
+	}
+	if err := folded.Close(); err != nil {
+		return err
+	}
+	return table.Close()
+}
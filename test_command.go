@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"danielmcm.com/interpreterbook/coverage"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+	"danielmcm.com/interpreterbook/tester"
+)
+
+// runTest implements `monkey test [-v] [-cover] [paths]`, running the test
+// files given or found in the given directories, or the current directory
+// if none are given. Test files are named *_test.mk, and run as described
+// by tester.Run. Failed tests are always reported, and passed ones with -v.
+//
+// With -cover, the coverage of each file is printed, written in LCOV format
+// to the -coverprofile file, and with -annotate printed as an annotated
+// listing of the source.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	cover := flags.Bool("cover", false, "collect statement, branch and function coverage")
+	coverProfile := flags.String("coverprofile", "lcov.info", "write LCOV coverage to `file` when -cover is set")
+	annotate := flags.Bool("annotate", false, "print an annotated listing of the source when -cover is set")
+	verbose := flags.Bool("v", false, "report every test, not just failures")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files found")
+		return 1
+	}
+
+	var covered *coverage.Coverage
+	if *cover {
+		covered = coverage.New()
+	}
+	status := 0
+	for _, path := range files {
+		if !runTestFile(path, covered, *verbose) {
+			status = 1
+		}
+	}
+
+	if covered == nil {
+		return status
+	}
+	if *annotate {
+		// the listing starts with the summary of each file
+		if err := covered.WriteListing(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		for _, summary := range covered.Summaries() {
+			fmt.Println(summary)
+		}
+	}
+	out, err := os.Create(*coverProfile)
+	if err == nil {
+		err = covered.WriteLCOV(out)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return status
+}
+
+// findTestFiles returns the files given, and the test files in the
+// directories given and their subdirectories.
+func findTestFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && tester.IsTestFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// runTestFile runs a test file, counting its coverage if covered is not
+// nil, and reports whether its tests passed.
+func runTestFile(path string, covered *coverage.Coverage, verbose bool) bool {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("FAIL %s\n\t%s\n", path, err)
+		return false
+	}
+	program, err := evaluator.Prepare(string(source), nil)
+	if err != nil {
+		fmt.Printf("FAIL %s\n", path)
+		printTestError("\t", path, err)
+		return false
+	}
+
+	var hooks *object.Hooks
+	if covered != nil {
+		covered.Add(path, string(source), program)
+		hooks = covered.Hooks()
+	}
+	results, err := tester.Run(program, hooks)
+	if err != nil {
+		fmt.Printf("FAIL %s\n", path)
+		printTestError("\t", path, err)
+		return false
+	}
+
+	passed := true
+	for _, result := range results {
+		if result.Err == nil {
+			if verbose {
+				fmt.Printf("--- PASS: %s\n", result.Name)
+			}
+			continue
+		}
+		passed = false
+		fmt.Printf("--- FAIL: %s (%s:%s)\n", result.Name, path, result.Position)
+		printTestError("    ", path, result.Err)
+	}
+	if passed {
+		fmt.Printf("ok   %s (%d tests)\n", path, len(results))
+	} else {
+		fmt.Printf("FAIL %s\n", path)
+	}
+	return passed
+}
+
+// printTestError prints an error indented, prefixed with the path of the
+// file. Failed assertions and syntax errors give positions in the file,
+// and the rest of a multi-line failure is indented further.
+func printTestError(indent string, path string, err error) {
+	var failure *tester.Failure
+	if errors.As(err, &failure) {
+		lines := strings.Split(failure.Error(), "\n")
+		fmt.Printf("%s%s:%s\n", indent, path, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Printf("%s    %s\n", indent, line)
+		}
+		return
+	}
+	if _, ok := parser.ErrorPosition(err); ok {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Printf("%s%s:%s\n", indent, path, line)
+		}
+		return
+	}
+	fmt.Printf("%s%s: %s\n", indent, path, err)
+}
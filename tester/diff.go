@@ -0,0 +1,95 @@
+package tester
+
+import (
+	"fmt"
+	"strconv"
+
+	"danielmcm.com/interpreterbook/object"
+)
+
+// display shows a value as it would be written in Monkey, quoting strings.
+func display(value object.Object) string {
+	switch value := value.(type) {
+	case *object.String:
+		return strconv.Quote(value.Value)
+	case *object.Array:
+		out := "["
+		for i, element := range value.Elements {
+			if i > 0 {
+				out += ", "
+			}
+			out += display(element)
+		}
+		return out + "]"
+	case *object.Hash:
+		out := "{"
+		for i, pair := range value.Pairs() {
+			if i > 0 {
+				out += ", "
+			}
+			out += display(pair.Key) + ": " + display(pair.Value)
+		}
+		return out + "}"
+	default:
+		return value.Inspect()
+	}
+}
+
+// diff describes the differences between two values, giving the path to
+// each element of an array or hash that differs.
+func diff(path string, expected object.Object, actual object.Object) []string {
+	if object.Equal(expected, actual) {
+		return nil
+	}
+	at := ""
+	if path != "" {
+		at = path + ": "
+	}
+
+	switch expected := expected.(type) {
+	case *object.Array:
+		actual, ok := actual.(*object.Array)
+		if !ok {
+			break
+		}
+		differences := make([]string, 0)
+		for i := 0; i < max(len(expected.Elements), len(actual.Elements)); i++ {
+			element := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(actual.Elements):
+				differences = append(differences, fmt.Sprintf("%s: missing %s", element, display(expected.Elements[i])))
+			case i >= len(expected.Elements):
+				differences = append(differences, fmt.Sprintf("%s: unexpected %s", element, display(actual.Elements[i])))
+			default:
+				differences = append(differences, diff(element, expected.Elements[i], actual.Elements[i])...)
+			}
+		}
+		return differences
+	case *object.Hash:
+		actual, ok := actual.(*object.Hash)
+		if !ok {
+			break
+		}
+		differences := make([]string, 0)
+		for _, pair := range expected.Pairs() {
+			element := fmt.Sprintf("%s[%s]", path, display(pair.Key))
+			if value, ok := actual.Get(pair.Key); ok {
+				differences = append(differences, diff(element, pair.Value, value)...)
+			} else {
+				differences = append(differences, fmt.Sprintf("%s: missing %s", element, display(pair.Value)))
+			}
+		}
+		for _, pair := range actual.Pairs() {
+			if _, ok := expected.Get(pair.Key); !ok {
+				element := fmt.Sprintf("%s[%s]", path, display(pair.Key))
+				differences = append(differences, fmt.Sprintf("%s: unexpected %s", element, display(pair.Value)))
+			}
+		}
+		return differences
+	}
+
+	if display(expected) == display(actual) {
+		return []string{fmt.Sprintf("%sexpected %s %s, got %s %s", at, expected.Type(), display(expected), actual.Type(), display(actual))}
+	}
+	return []string{fmt.Sprintf("%sexpected %s, got %s", at, display(expected), display(actual))}
+}
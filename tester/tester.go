@@ -0,0 +1,245 @@
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/evaluator"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/token"
+)
+
+// Failure is an assertion that failed.
+type Failure struct {
+	Position token.Position
+	Message  string
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%s: %s", f.Position, f.Message)
+}
+
+// Result is the outcome of a test.
+type Result struct {
+	Name string
+	// Position is where the test function is bound or registered
+	Position token.Position
+	// Err is why the test failed, or nil if it passed. Failed assertions
+	// are reported as a *Failure.
+	Err error
+}
+
+// test is a test found in a program.
+type test struct {
+	name     string
+	position token.Position
+	function object.Object
+	call     *ast.CallExpression
+}
+
+// runner runs the tests of a program, providing the test builtins.
+type runner struct {
+	env   *object.Environment
+	tests []test
+	// call is the call to a test builtin being evaluated
+	call *ast.CallExpression
+}
+
+// Run evaluates a test program and then runs its tests: the functions
+// bound to names starting with test_ by top-level let statements, and the
+// functions registered with test("name", fn), in source order.
+//
+// Programs can use the assert(condition, [message]), assert_eq(actual,
+// expected, [message]) and assert_throws(fn, [substring]) builtins, which
+// fail with a *Failure. assert requires its condition to be true, and
+// assert_throws that calling fn returns an error other than a failure.
+//
+// The error returned is from evaluating the program itself, before running
+// any tests. Hooks, which may be nil, are set on the program's
+// environment.
+func Run(program *ast.Program, hooks *object.Hooks) ([]Result, error) {
+	r := &runner{env: object.NewEnvironment()}
+	if hooks == nil {
+		r.env.SetHooks(r.hooks())
+	} else {
+		r.env.SetHooks(object.JoinHooks(r.hooks(), hooks))
+	}
+	for name, builtin := range r.builtins() {
+		r.env.Set(name, builtin)
+	}
+
+	if _, err := evaluator.Eval(program, r.env); err != nil {
+		return nil, err
+	}
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, "test_") {
+			continue
+		}
+		function, ok := r.env.Get(let.Name.Value)
+		if _, isFunction := function.(*object.Function); !ok || !isFunction {
+			continue
+		}
+		call := &ast.CallExpression{Token: let.Name.Token, Function: let.Name}
+		r.tests = append(r.tests, test{name: let.Name.Value, position: let.Name.Token.Position, function: function, call: call})
+	}
+	sort.SliceStable(r.tests, func(i, j int) bool {
+		a, b := r.tests[i].position, r.tests[j].position
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	results := make([]Result, len(r.tests))
+	for i, test := range r.tests {
+		_, err := evaluator.Apply(test.call, test.function, nil, r.env)
+		results[i] = Result{Name: test.name, Position: test.position, Err: err}
+	}
+	return results, nil
+}
+
+// IsTestFile reports whether a path names a test file, which is run by
+// Run.
+func IsTestFile(path string) bool {
+	return strings.HasSuffix(path, "_test.mk")
+}
+
+// Builtins returns the builtins Run defines for test programs, by name, for
+// tools such as the linter. They can only be called in a run.
+func Builtins() map[string]*object.Builtin {
+	return (&runner{}).builtins()
+}
+
+func (r *runner) builtins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"assert":        {Fn: r.assert, Arity: object.Variadic},
+		"assert_eq":     {Fn: r.assertEq, Arity: object.Variadic},
+		"assert_throws": {Fn: r.assertThrows, Arity: object.Variadic},
+		"test":          {Fn: r.register, Arity: 2},
+	}
+}
+
+// hooks records calls to the test builtins, so that failures can give
+// their positions.
+func (r *runner) hooks() *object.Hooks {
+	return &object.Hooks{
+		Call: func(call *ast.CallExpression, function object.Object, args []object.Object) func() {
+			if _, ok := function.(*object.Builtin); ok {
+				r.call = call
+			}
+			return func() {}
+		},
+	}
+}
+
+// position returns the position of the call to a test builtin being
+// evaluated.
+func (r *runner) position() token.Position {
+	if identifier, ok := r.call.Function.(*ast.Identifier); ok {
+		return identifier.Token.Position
+	}
+	return r.call.Token.Position
+}
+
+func (r *runner) fail(format string, args ...interface{}) error {
+	return &Failure{Position: r.position(), Message: fmt.Sprintf(format, args...)}
+}
+
+// optionalString returns the optional string argument of an assertion at
+// index, or "" if it is not given.
+func optionalString(name string, args []object.Object, index int) (string, error) {
+	if len(args) < index || len(args) > index+1 {
+		return "", fmt.Errorf("`%s` received wrong number of arguments. expected %d or %d, got %d", name, index, index+1, len(args))
+	}
+	if len(args) == index {
+		return "", nil
+	}
+	str, ok := args[index].(*object.String)
+	if !ok {
+		return "", fmt.Errorf("`%s` argument of type %s not supported", name, args[index].Type())
+	}
+	return str.Value, nil
+}
+
+func (r *runner) assert(env *object.Environment, args ...object.Object) (object.Object, error) {
+	message, err := optionalString("assert", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if boolean, ok := args[0].(*object.Boolean); ok && boolean.Value {
+		return args[0], nil
+	}
+	if message == "" {
+		message = "assertion failed"
+	}
+	return nil, r.fail("%s", message)
+}
+
+func (r *runner) assertEq(env *object.Environment, args ...object.Object) (object.Object, error) {
+	message, err := optionalString("assert_eq", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	actual, expected := args[0], args[1]
+	if object.Equal(actual, expected) {
+		return actual, nil
+	}
+	if message == "" {
+		message = "values are not equal"
+	}
+	lines := []string{message, fmt.Sprintf("expected: %s", display(expected)), fmt.Sprintf("actual:   %s", display(actual))}
+	if expected.Type() == actual.Type() && (expected.Type() == object.ARRAY_OBJ || expected.Type() == object.HASH_OBJ) {
+		lines = append(lines, "differences:")
+		for _, difference := range diff("", expected, actual) {
+			lines = append(lines, "  "+difference)
+		}
+	}
+	return nil, r.fail("%s", strings.Join(lines, "\n"))
+}
+
+func (r *runner) assertThrows(env *object.Environment, args ...object.Object) (object.Object, error) {
+	substring, err := optionalString("assert_throws", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch args[0].(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return nil, fmt.Errorf("`assert_throws` argument of type %s not supported", args[0].Type())
+	}
+	call, position := r.call, r.position()
+	_, err = evaluator.Apply(call, args[0], nil, r.env)
+	r.call = call
+	var failure *Failure
+	switch {
+	case errors.As(err, &failure):
+		return nil, err
+	case err == nil:
+		return nil, &Failure{Position: position, Message: "expected an error, but none was returned"}
+	case !strings.Contains(err.Error(), substring):
+		return nil, &Failure{Position: position, Message: fmt.Sprintf("expected an error containing %q, got %q", substring, err.Error())}
+	}
+	return &object.String{Value: err.Error()}, nil
+}
+
+func (r *runner) register(env *object.Environment, args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("`test` received wrong number of arguments. expected 2, got %d", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("`test` argument of type %s not supported", args[0].Type())
+	}
+	if _, ok := args[1].(*object.Function); !ok {
+		return nil, fmt.Errorf("`test` argument of type %s not supported", args[1].Type())
+	}
+	position := r.position()
+	call := &ast.CallExpression{
+		Token:    r.call.Token,
+		Function: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name.Value, Position: position}, Value: name.Value},
+	}
+	r.tests = append(r.tests, test{name: name.Value, position: position, function: args[1], call: call})
+	return evaluator.NULL, nil
+}
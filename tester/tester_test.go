@@ -0,0 +1,124 @@
+package tester
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"danielmcm.com/interpreterbook/ast"
+	"danielmcm.com/interpreterbook/lexer"
+	"danielmcm.com/interpreterbook/object"
+	"danielmcm.com/interpreterbook/parser"
+)
+
+func run(t *testing.T, input string, hooks *object.Hooks) ([]Result, error) {
+	t.Helper()
+	parser := parser.New(lexer.New(input))
+	program := parser.ParseProgram()
+	if errs := parser.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	return Run(program, hooks)
+}
+
+func TestRun(t *testing.T) {
+	input := `let double = fn(x) { x * 2 };
+test("registered", fn() { assert_eq(double(2), 4) });
+let test_fails = fn() {
+	assert(double(1) == 3, "one doubled");
+};
+let test_not_a_function = 1;
+let helper = fn() { assert(false) };
+let test_throws = fn() {
+	let message = assert_throws(fn() { double(true) }, "not supported");
+	assert_eq(message, "operator * not supported on x (BOOLEAN true) and 2 (INTEGER 2)");
+	assert_throws(fn() { 1 });
+};
+test("error", fn() { double() });`
+
+	calls := 0
+	hooks := &object.Hooks{Call: func(call *ast.CallExpression, function object.Object, args []object.Object) func() {
+		calls++
+		return func() {}
+	}}
+	results, err := run(t, input, hooks)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls == 0 {
+		t.Errorf("expected the hooks given to be called")
+	}
+
+	expected := []struct {
+		name     string
+		position string
+		err      string
+	}{
+		{"registered", "2:1", ""},
+		{"test_fails", "3:5", "4:2: one doubled"},
+		{"test_throws", "8:5", "11:2: expected an error, but none was returned"},
+		{"error", "13:1", "function with 1 parameters called with 0 arguments: missing x"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), results)
+	}
+	for i, result := range results {
+		want := expected[i]
+		err := ""
+		if result.Err != nil {
+			err = result.Err.Error()
+		}
+		if result.Name != want.name || result.Position.String() != want.position || err != want.err {
+			t.Errorf("result %d: expected %s at %s failing with %q, got %s at %s failing with %q",
+				i, want.name, want.position, want.err, result.Name, result.Position, err)
+		}
+	}
+	var failure *Failure
+	if !errors.As(results[1].Err, &failure) || errors.As(results[3].Err, &failure) {
+		t.Errorf("expected only failed assertions to be reported as failures")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert(1 == 2);", "1:1: assertion failed"},
+		{"assert(1);", "1:1: assertion failed"},
+		{"let x = 1;\n  assert_eq(x, 2, \"x\");", "2:3: x\nexpected: 2\nactual:   1"},
+		{`assert_eq("1", 1);`, "1:1: values are not equal\nexpected: 1\nactual:   \"1\""},
+		{"assert_throws(fn() { assert(false) });", "1:22: assertion failed"},
+		{"assert();", "`assert` received wrong number of arguments. expected 1 or 2, got 0"},
+		{"assert(true, 1);", "`assert` argument of type INTEGER not supported"},
+		{`test(1, fn() {});`, "`test` argument of type INTEGER not supported"},
+		{"let ok = fn() { 5 };\nassert_throws(ok());", "`assert_throws` argument of type INTEGER not supported"},
+		{`let ok = fn() { 5 }; assert_throws(ok(), "boom");`, "`assert_throws` argument of type INTEGER not supported"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.input, nil)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	input := `assert_eq([1, [2, 3], {"a": "b", "c": 1}, 4], [1, [2, 4], {"a": "c", "d": 1}]);`
+	_, err := run(t, input, nil)
+	expected := []string{
+		"1:1: values are not equal",
+		`expected: [1, [2, 4], {"a": "c", "d": 1}]`,
+		`actual:   [1, [2, 3], {"a": "b", "c": 1}, 4]`,
+		"differences:",
+		"  [1][1]: expected 4, got 3",
+		`  [2]["a"]: expected "c", got "b"`,
+		`  [2]["d"]: missing 1`,
+		`  [2]["c"]: unexpected 1`,
+		"  [3]: unexpected 4",
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("wrong diff.\nexpected=%s\ngot=%v", strings.Join(expected, "\n"), err)
+	}
+}
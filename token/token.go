@@ -1,10 +1,44 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Position Position
+	// Raw is the source text of a string literal, including its quotes, so
+	// that tools can print it as it was written. It is empty for other
+	// tokens.
+	Raw string
+}
+
+// Position is the location of a token in the source, counting lines and
+// columns (in characters) from 1.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (position Position) String() string {
+	return fmt.Sprintf("%d:%d", position.Line, position.Column)
+}
+
+// Advance returns the position following text that starts at position.
+func (position Position) Advance(text string) Position {
+	for _, char := range text {
+		if char == '\n' {
+			position.Line++
+			position.Column = 1
+		} else {
+			position.Column++
+		}
+	}
+	return position
 }
 
 // TokenType constants
@@ -14,9 +48,15 @@ const (
 
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
+	// A string literal containing ${...} interpolations, with escape
+	// sequences left unprocessed
+	INTERPOLATED_STRING = "INTERPOLATED_STRING"
 
 	ASSIGN   = "="
+	ARROW    = "=>"
+	ELLIPSIS = "..."
 	PLUS     = "+"
 	MINUS    = "-"
 	BANG     = "!"
@@ -46,6 +86,8 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
 )
 
 var keywords = map[string]TokenType{
@@ -56,6 +98,18 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
+	"match":  MATCH,
+}
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 func LookupIdentifier(identifier string) TokenType {